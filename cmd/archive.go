@@ -0,0 +1,77 @@
+// Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/alerting/alerts-nws/pkg/archive"
+	"github.com/spf13/cobra"
+)
+
+var archiveDir string
+
+// archiveCmd represents the archive command
+var archiveCmd = &cobra.Command{
+	Use:   "archive",
+	Short: "Write alerts as CAP files",
+	Run: func(cmd *cobra.Command, args []string) {
+		// Generate config.
+		conf := archive.Config{
+			Brokers:     brokers,
+			Group:       group,
+			StoredTopic: storedTopic,
+			RawTopic:    rawTopic,
+			Archive:     &archive.Archive{Dir: archiveDir},
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan bool)
+
+		go func() {
+			defer close(done)
+			if err := archive.Run(ctx, conf); err != nil {
+				if err != context.Canceled {
+					log.Fatal(err)
+				}
+			}
+		}()
+
+		wait := make(chan os.Signal, 1)
+		signal.Notify(wait, syscall.SIGINT, syscall.SIGTERM)
+		<-wait // Wait for SIGINT or SIGTERM
+		log.Println("Signal received, terminating...")
+		cancel() // Stop the processor
+		<-done
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(archiveCmd)
+
+	archiveCmd.Flags().StringVarP(&group, "group", "g", "", "Group")
+	archiveCmd.MarkFlagRequired("group")
+
+	archiveCmd.Flags().StringVar(&storedTopic, "stored-topic", "", "Stored alerts topic, of the alerts to archive")
+	archiveCmd.MarkFlagRequired("stored-topic")
+	archiveCmd.Flags().StringVar(&rawTopic, "raw-topic", "", "Topic of the fetched bytes of alerts, written as is instead of re-serialising")
+
+	archiveCmd.Flags().StringVarP(&archiveDir, "dir", "d", "", "Directory to write the alerts to")
+	archiveCmd.MarkFlagRequired("dir")
+}
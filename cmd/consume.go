@@ -20,102 +20,93 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/alerting/alerts-nws/pkg/consume"
-	capxml "github.com/alerting/alerts/pkg/cap/xml"
-	shp "github.com/jonas-p/go-shp"
+	"github.com/alerting/alerts-nws/pkg/gauges"
+	"github.com/alerting/alerts-nws/pkg/shorttext"
+	"github.com/alerting/alerts-nws/pkg/zones"
 	"github.com/spf13/cobra"
 )
 
 var polygonsUGCC string
 var polygonsUGCZ string
 
-var formatCounty = "C"
-var formatPublicZone = "Z"
-
 var system string
-
-func getPolygons(filename, format string) (map[string]*capxml.Polygon, error) {
-	// Load shapefiles
-	reader, err := shp.OpenZip(filename)
-	if err != nil {
-		return nil, err
-	}
-	defer reader.Close()
-
-	polygons := make(map[string]*capxml.Polygon)
-	for reader.Next() {
-		_, shape := reader.Shape()
-		pshape := shape.(*shp.Polygon)
-
-		polygon := &capxml.Polygon{
-			Type:        "Polygon",
-			Coordinates: make([][][]float64, 1),
-		}
-		polygon.Coordinates[0] = make([][]float64, pshape.NumPoints)
-
-		for i, coord := range pshape.Points {
-			polygon.Coordinates[0][pshape.NumPoints-int32(i)-1] = []float64{coord.X, coord.Y}
-		}
-
-		// STATE, TYPE, ZONE
-		// https://www.weather.gov/media/alert/CAP_v12_guide_05-16-2017.pdf
-		// https://www.nws.noaa.gov/emwin/winugc.htm
-		polygons[reader.Attribute(0)+format+reader.Attribute(4)] = polygon
-	}
-
-	return polygons, nil
-}
+var derivedThreshold float64
+var gaugesFile string
+var eventsTopic string
+var changesTopic string
+var pendingTimeout time.Duration
+var expiredTopic string
+var storedTopic string
+var policyStatuses map[string]string
+var policyMessageTypes map[string]string
+var policyRouteTopic string
+var abbreviations map[string]string
 
 // consumeCmd represents the consume command
 var consumeCmd = &cobra.Command{
 	Use:   "consume",
 	Short: "Consume alerts",
 	Run: func(cmd *cobra.Command, args []string) {
-		polygons := make(map[string]*capxml.Polygon)
-
-		if polygonsUGCC != "" {
-			log.Println("Loading UGC-C polygons...")
-			countyPolygons, err := getPolygons(polygonsUGCC, formatCounty)
-			if err != nil {
-				log.Fatal(err)
-			}
-
-			// Merge into 1
-			for k, polygon := range countyPolygons {
-				polygons[k] = polygon
-			}
+		store, err := zones.NewStore(polygonsUGCC, polygonsUGCZ)
+		if err != nil {
+			log.Fatal(err)
 		}
 
-		if polygonsUGCZ != "" {
-			log.Println("Loading UGC-Z polygons...")
-			publicZonePolygons, err := getPolygons(polygonsUGCZ, formatPublicZone)
+		riverGauges := make(map[string]*gauges.Gauge)
+		if gaugesFile != "" {
+			log.Println("Loading river gauges...")
+			riverGauges, err = gauges.Load(gaugesFile)
 			if err != nil {
 				log.Fatal(err)
 			}
-
-			// Merge into 1
-			for k, polygon := range publicZonePolygons {
-				polygons[k] = polygon
-			}
 		}
 
-		log.Println("Done loading polygons")
+		policy := consume.DefaultPolicy()
+		policy.RouteTopic = policyRouteTopic
+		if err := policy.SetStatuses(policyStatuses); err != nil {
+			log.Fatal(err)
+		}
+		if err := policy.SetMessageTypes(policyMessageTypes); err != nil {
+			log.Fatal(err)
+		}
+		if err := policy.Validate(); err != nil {
+			log.Fatal(err)
+		}
 
 		// Generate config.
 		conf := consume.Config{
-			Brokers:       brokers,
-			Topic:         topic,
-			RetryTopic:    retryTopic,
-			Group:         group,
-			Delay:         delay,
-			AlertsService: alertsService,
-			FetchTopic:    fetchTopic,
-			Polygons:      polygons,
-			System:        system,
+			Brokers:          brokers,
+			Topic:            topic,
+			RetryTopic:       retryTopic,
+			Group:            group,
+			Delay:            delay,
+			AlertsService:    alertsService,
+			FetchTopic:       fetchTopic,
+			Zones:            store,
+			DerivedThreshold: derivedThreshold,
+			Gauges:           riverGauges,
+			EventsTopic:      eventsTopic,
+			ChangesTopic:     changesTopic,
+			PendingTimeout:   pendingTimeout,
+			ExpiredTopic:     expiredTopic,
+			StoredTopic:      storedTopic,
+			ShortText:        shorttext.NewRenderer(abbreviations),
+			Policy:           policy,
+			System:           system,
 		}
 
 		ctx, cancel := context.WithCancel(context.Background())
+
+		// Reload the shapefiles when they change
+		go func() {
+			if err := store.Watch(ctx); err != nil && err != context.Canceled {
+				log.Println("Unable to watch shapefiles:", err)
+			}
+		}()
+
 		done := make(chan bool)
 		go func() {
 			defer close(done)
@@ -151,8 +142,22 @@ func init() {
 	consumeCmd.Flags().StringVarP(&fetchTopic, "fetch-topic", "f", "", "Alerts topic")
 	consumeCmd.MarkFlagRequired("fetch-topic")
 
+	consumeCmd.Flags().StringVarP(&eventsTopic, "events-topic", "e", "", "VTEC event updates topic")
+	consumeCmd.Flags().StringVarP(&changesTopic, "changes-topic", "c", "", "Alert changes topic")
+	consumeCmd.Flags().StringToStringVar(&policyStatuses, "policy-status", map[string]string{}, "Action (store, route, drop) by status (ex. test=drop)")
+	consumeCmd.Flags().StringToStringVar(&policyMessageTypes, "policy-message-type", map[string]string{}, "Action (store, route, drop) by message type (ex. ack=route)")
+	consumeCmd.Flags().StringVar(&policyRouteTopic, "policy-route-topic", "", "Topic for routed alerts")
+
+	consumeCmd.Flags().StringVar(&storedTopic, "stored-topic", "", "Stored alerts topic")
+	consumeCmd.Flags().StringVarP(&expiredTopic, "expired-topic", "x", "", "Alert expired topic")
+	consumeCmd.Flags().DurationVar(&pendingTimeout, "pending-timeout", 10*time.Minute, "How long to hold alerts waiting for their references (0 to disable)")
+
 	consumeCmd.Flags().StringVar(&polygonsUGCC, "ugc-c", "polygons/ugc-c.zip", "UGC-C polygons")
 	consumeCmd.Flags().StringVar(&polygonsUGCZ, "ugc-z", "polygons/ugc-z.zip", "UGC-Z polygons")
+	consumeCmd.Flags().StringVar(&gaugesFile, "gauges", "", "River gauges (CSV of NWSLI, lat, lon, river name)")
+	consumeCmd.Flags().Float64Var(&derivedThreshold, "derived-threshold", 0.1, "Fraction of a zone an alert's polygon must cover to derive its UGC")
+
+	consumeCmd.Flags().StringToStringVar(&abbreviations, "abbreviation", map[string]string{}, "Abbreviations used in the short texts, in addition to the defaults (ex. Thunderstorm=Tstm; empty to remove)")
 
 	// We need the alerts service
 	consumeCmd.MarkFlagRequired("alerts-service")
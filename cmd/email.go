@@ -0,0 +1,122 @@
+// Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/alerting/alerts-nws/pkg/email"
+	"github.com/spf13/cobra"
+)
+
+var recipientsFile string
+var smtpAddr string
+var smtpUsername string
+var smtpPassword string
+var emailFrom string
+var requireTLS bool
+var digestInterval time.Duration
+var textTemplate string
+var htmlTemplate string
+
+// emailCmd represents the email command
+var emailCmd = &cobra.Command{
+	Use:   "email",
+	Short: "Email stored alerts",
+	Run: func(cmd *cobra.Command, args []string) {
+		recipients, err := email.LoadRecipients(recipientsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		templates, err := email.LoadTemplates(textTemplate, htmlTemplate)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		smtp := &email.SMTP{
+			Addr:       smtpAddr,
+			Username:   smtpUsername,
+			Password:   smtpPassword,
+			From:       emailFrom,
+			RequireTLS: requireTLS,
+		}
+		if err := smtp.Validate(); err != nil {
+			log.Fatal(err)
+		}
+
+		// Generate config.
+		conf := email.Config{
+			Brokers:     brokers,
+			Group:       group,
+			StoredTopic: storedTopic,
+			Mailer: &email.Mailer{
+				Recipients:     recipients,
+				SMTP:           smtp,
+				Templates:      templates,
+				DigestInterval: digestInterval,
+			},
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan bool)
+
+		go func() {
+			defer close(done)
+			if err := email.Run(ctx, conf); err != nil {
+				if err != context.Canceled {
+					log.Fatal(err)
+				}
+			}
+		}()
+
+		wait := make(chan os.Signal, 1)
+		signal.Notify(wait, syscall.SIGINT, syscall.SIGTERM)
+		<-wait // Wait for SIGINT or SIGTERM
+		log.Println("Signal received, terminating...")
+		cancel() // Stop the processor
+		<-done
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(emailCmd)
+
+	emailCmd.Flags().StringVarP(&group, "group", "g", "", "Group")
+	emailCmd.MarkFlagRequired("group")
+
+	emailCmd.Flags().StringVar(&storedTopic, "stored-topic", "", "Stored alerts topic")
+	emailCmd.MarkFlagRequired("stored-topic")
+
+	emailCmd.Flags().StringVar(&recipientsFile, "recipients", "", "Recipients (JSON list of address, events, severities, ugc)")
+	emailCmd.MarkFlagRequired("recipients")
+
+	emailCmd.Flags().StringVar(&emailFrom, "from", "", "Sender address")
+	emailCmd.MarkFlagRequired("from")
+
+	emailCmd.Flags().StringVar(&smtpAddr, "smtp-addr", "localhost:25", "SMTP server (host:port)")
+	emailCmd.Flags().StringVar(&smtpUsername, "smtp-username", "", "SMTP username")
+	emailCmd.Flags().StringVar(&smtpPassword, "smtp-password", "", "SMTP password")
+	emailCmd.Flags().BoolVar(&requireTLS, "require-tls", false, "Fail if the SMTP server does not support STARTTLS")
+
+	emailCmd.Flags().DurationVar(&digestInterval, "digest-interval", time.Hour, "How often to send digests of non-warning alerts")
+	emailCmd.Flags().StringVar(&textTemplate, "text-template", "", "Text template, defining the alert and digest templates")
+	emailCmd.Flags().StringVar(&htmlTemplate, "html-template", "", "HTML template, defining the alert and digest templates")
+}
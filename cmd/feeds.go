@@ -0,0 +1,83 @@
+// Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/alerting/alerts-nws/pkg/active"
+	"github.com/alerting/alerts-nws/pkg/syndication"
+	"github.com/spf13/cobra"
+)
+
+var feedsAddr string
+var feedsBaseURL string
+
+// feedsCmd represents the feeds command
+var feedsCmd = &cobra.Command{
+	Use:   "feeds",
+	Short: "Serve Atom, RSS and iCalendar feeds of the active alerts",
+	Run: func(cmd *cobra.Command, args []string) {
+		// Generate config.
+		conf := syndication.Config{
+			Active: active.Config{
+				Brokers:      brokers,
+				Group:        group,
+				StoredTopic:  storedTopic,
+				ExpiredTopic: expiredTopic,
+			},
+			Addr:    feedsAddr,
+			BaseURL: feedsBaseURL,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan bool)
+
+		go func() {
+			defer close(done)
+			if err := syndication.Run(ctx, conf); err != nil {
+				if err != context.Canceled {
+					log.Fatal(err)
+				}
+			}
+		}()
+
+		wait := make(chan os.Signal, 1)
+		signal.Notify(wait, syscall.SIGINT, syscall.SIGTERM)
+		<-wait // Wait for SIGINT or SIGTERM
+		log.Println("Signal received, terminating...")
+		cancel() // Stop the processor
+		<-done
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(feedsCmd)
+
+	feedsCmd.Flags().StringVarP(&group, "group", "g", "", "Group")
+	feedsCmd.MarkFlagRequired("group")
+
+	feedsCmd.Flags().StringVar(&storedTopic, "stored-topic", "", "Stored alerts topic")
+	feedsCmd.MarkFlagRequired("stored-topic")
+
+	feedsCmd.Flags().StringVarP(&expiredTopic, "expired-topic", "x", "", "Alert expired topic, to remove expired alerts from the feeds")
+
+	feedsCmd.Flags().StringVar(&feedsAddr, "addr", ":8080", "Address to serve the feeds on")
+	feedsCmd.Flags().StringVar(&feedsBaseURL, "base-url", "", "Public URL of the feeds, for links (default: the host of the request)")
+}
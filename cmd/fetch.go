@@ -17,6 +17,7 @@ var delay int
 var topic string
 var alertsTopic string
 var fetchURLs []string
+var rawTopic string
 
 // fetchCmd represents the fetch command
 var fetchCmd = &cobra.Command{
@@ -31,6 +32,7 @@ var fetchCmd = &cobra.Command{
 			Delay:       delay,
 			AlertsTopic: alertsTopic,
 			FetchURLs:   fetchURLs,
+			RawTopic:    rawTopic,
 		}
 
 		ctx, cancel := context.WithCancel(context.Background())
@@ -71,6 +73,7 @@ func init() {
 
 	fetchCmd.Flags().StringVarP(&alertsTopic, "alerts-topic", "a", "", "Alerts topic")
 	fetchCmd.MarkFlagRequired("alerts-topic")
+	fetchCmd.Flags().StringVar(&rawTopic, "raw-topic", "", "Topic of the fetched bytes of alerts")
 
 	fetchCmd.Flags().StringArrayVarP(&fetchURLs, "fetch-urls", "u", []string{}, "Fetch URLs")
 	fetchCmd.MarkFlagRequired("fetch-urls")
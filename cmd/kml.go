@@ -0,0 +1,130 @@
+// Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/alerting/alerts-nws/pkg/active"
+	"github.com/alerting/alerts-nws/pkg/kml"
+	"github.com/alerting/alerts-nws/pkg/zones"
+	"github.com/spf13/cobra"
+)
+
+var kmlOutput string
+var kmlName string
+var kmlInterval time.Duration
+var kmlFilter active.Filter
+
+// kmlCmd represents the kml command
+var kmlCmd = &cobra.Command{
+	Use:   "kml",
+	Short: "Export the active alerts as KML or KMZ",
+	Long: `Export the active alerts as KML, or KMZ if the output ends in .kmz.
+
+Without --interval, the alerts are exported once, from the table of active
+alerts kept by the group (ex. by the feeds command, or kml with --interval).
+With --interval, the table is kept, and the file rewritten periodically.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := zones.NewStore(polygonsUGCC, polygonsUGCZ)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if kmlInterval <= 0 {
+			alerts, err := active.Snapshot(context.Background(), brokers, group, &kmlFilter)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := kml.Export(kmlOutput, kmlName, alerts, store.Load()); err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("Wrote %d alert(s) to %s", len(alerts), kmlOutput)
+			return
+		}
+
+		if storedTopic == "" {
+			log.Fatal("--stored-topic is required with --interval")
+		}
+
+		// Generate config.
+		conf := kml.Config{
+			Active: active.Config{
+				Brokers:      brokers,
+				Group:        group,
+				StoredTopic:  storedTopic,
+				ExpiredTopic: expiredTopic,
+			},
+			Zones:    store,
+			Output:   kmlOutput,
+			Interval: kmlInterval,
+			Name:     kmlName,
+			Filter:   &kmlFilter,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		// Reload the shapefiles when they change
+		go func() {
+			if err := store.Watch(ctx); err != nil && err != context.Canceled {
+				log.Println("Unable to watch shapefiles:", err)
+			}
+		}()
+
+		done := make(chan bool)
+		go func() {
+			defer close(done)
+			if err := kml.Run(ctx, conf); err != nil {
+				if err != context.Canceled {
+					log.Fatal(err)
+				}
+			}
+		}()
+
+		wait := make(chan os.Signal, 1)
+		signal.Notify(wait, syscall.SIGINT, syscall.SIGTERM)
+		<-wait // Wait for SIGINT or SIGTERM
+		log.Println("Signal received, terminating...")
+		cancel() // Stop the processor
+		<-done
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(kmlCmd)
+
+	kmlCmd.Flags().StringVarP(&group, "group", "g", "", "Group")
+	kmlCmd.MarkFlagRequired("group")
+
+	kmlCmd.Flags().StringVarP(&kmlOutput, "output", "o", "", "File to write (KMZ if it ends in .kmz)")
+	kmlCmd.MarkFlagRequired("output")
+
+	kmlCmd.Flags().StringVar(&storedTopic, "stored-topic", "", "Stored alerts topic, required with --interval")
+	kmlCmd.Flags().StringVarP(&expiredTopic, "expired-topic", "x", "", "Alert expired topic, to remove expired alerts")
+	kmlCmd.Flags().DurationVar(&kmlInterval, "interval", 0, "Rewrite the file at this interval, instead of exporting once")
+
+	kmlCmd.Flags().StringVar(&kmlName, "name", "Active alerts", "Name of the document")
+	kmlCmd.Flags().StringVar(&kmlFilter.State, "state", "", "Only export alerts for the state (ex. KS)")
+	kmlCmd.Flags().StringVar(&kmlFilter.Zone, "zone", "", "Only export alerts for the zone (ex. KSZ040)")
+	kmlCmd.Flags().StringVar(&kmlFilter.Office, "wfo", "", "Only export alerts issued by the office (ex. TOP)")
+
+	kmlCmd.Flags().StringVar(&polygonsUGCC, "ugc-c", "polygons/ugc-c.zip", "UGC-C polygons")
+	kmlCmd.Flags().StringVar(&polygonsUGCZ, "ugc-z", "polygons/ugc-z.zip", "UGC-Z polygons")
+}
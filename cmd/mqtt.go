@@ -0,0 +1,116 @@
+// Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/alerting/alerts-nws/pkg/mqtt"
+	"github.com/spf13/cobra"
+)
+
+var mqttAddr string
+var mqttClientID string
+var mqttUsername string
+var mqttPassword string
+var mqttTLS bool
+var mqttKeepAlive time.Duration
+var mqttPrefix string
+var mqttQoS uint8
+
+// mqttCmd represents the mqtt command
+var mqttCmd = &cobra.Command{
+	Use:   "mqtt",
+	Short: "Publish stored alerts to an MQTT broker",
+	Run: func(cmd *cobra.Command, args []string) {
+		if mqttQoS > 1 {
+			log.Fatal("QoS must be 0 or 1")
+		}
+
+		client := &mqtt.Client{
+			Addr:      mqttAddr,
+			ClientID:  mqttClientID,
+			Username:  mqttUsername,
+			Password:  mqttPassword,
+			KeepAlive: mqttKeepAlive,
+		}
+		if mqttTLS {
+			host, _, err := net.SplitHostPort(mqttAddr)
+			if err != nil {
+				log.Fatal(err)
+			}
+			client.TLSConfig = &tls.Config{ServerName: host}
+		}
+
+		// Generate config.
+		conf := mqtt.Config{
+			Brokers:      brokers,
+			Group:        group,
+			StoredTopic:  storedTopic,
+			ExpiredTopic: expiredTopic,
+			Client:       client,
+			Prefix:       mqttPrefix,
+			QoS:          mqttQoS,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan bool)
+
+		go func() {
+			defer close(done)
+			if err := mqtt.Run(ctx, conf); err != nil {
+				if err != context.Canceled {
+					log.Fatal(err)
+				}
+			}
+		}()
+
+		wait := make(chan os.Signal, 1)
+		signal.Notify(wait, syscall.SIGINT, syscall.SIGTERM)
+		<-wait // Wait for SIGINT or SIGTERM
+		log.Println("Signal received, terminating...")
+		cancel() // Stop the processor
+		<-done
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mqttCmd)
+
+	mqttCmd.Flags().StringVarP(&group, "group", "g", "", "Group")
+	mqttCmd.MarkFlagRequired("group")
+
+	mqttCmd.Flags().StringVar(&storedTopic, "stored-topic", "", "Stored alerts topic")
+	mqttCmd.MarkFlagRequired("stored-topic")
+
+	mqttCmd.Flags().StringVarP(&expiredTopic, "expired-topic", "x", "", "Alert expired topic, to clear the retained messages of expired alerts")
+
+	mqttCmd.Flags().StringVar(&mqttAddr, "mqtt-addr", "localhost:1883", "MQTT broker (host:port)")
+	mqttCmd.Flags().StringVar(&mqttClientID, "mqtt-client-id", "alerts-nws", "MQTT client ID")
+	mqttCmd.Flags().StringVar(&mqttUsername, "mqtt-username", "", "MQTT username")
+	mqttCmd.Flags().StringVar(&mqttPassword, "mqtt-password", "", "MQTT password")
+	mqttCmd.Flags().BoolVar(&mqttTLS, "mqtt-tls", false, "Connect to the MQTT broker using TLS")
+	mqttCmd.Flags().DurationVar(&mqttKeepAlive, "mqtt-keep-alive", time.Minute, "MQTT keep alive")
+
+	mqttCmd.Flags().StringVar(&mqttPrefix, "prefix", "nws/alerts", "Prefix of the MQTT topics (<prefix>/<state>/<ugc>/<event>)")
+	mqttCmd.Flags().Uint8Var(&mqttQoS, "qos", 1, "QoS of the published messages (0 or 1)")
+}
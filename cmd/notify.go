@@ -0,0 +1,113 @@
+// Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/alerting/alerts-nws/pkg/notify"
+	"github.com/spf13/cobra"
+)
+
+var webhooksFile string
+var deliveryLog string
+var maxAttempts int
+var backoff time.Duration
+var webhookTimeout time.Duration
+var webhookWorkers int
+
+// notifyCmd represents the notify command
+var notifyCmd = &cobra.Command{
+	Use:   "notify",
+	Short: "Notify webhooks of stored alerts",
+	Run: func(cmd *cobra.Command, args []string) {
+		endpoints, err := notify.LoadEndpoints(webhooksFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		notifier := &notify.Notifier{
+			Endpoints:   endpoints,
+			Client:      &http.Client{Timeout: webhookTimeout},
+			MaxAttempts: maxAttempts,
+			Backoff:     backoff,
+			System:      system,
+			Workers:     webhookWorkers,
+		}
+
+		if deliveryLog != "" {
+			f, err := os.OpenFile(deliveryLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			notifier.DeliveryLog = f
+		}
+
+		// Generate config.
+		conf := notify.Config{
+			Brokers:     brokers,
+			Group:       group,
+			StoredTopic: storedTopic,
+			Notifier:    notifier,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan bool)
+
+		go func() {
+			defer close(done)
+			if err := notify.Run(ctx, conf); err != nil {
+				if err != context.Canceled {
+					log.Fatal(err)
+				}
+			}
+		}()
+
+		wait := make(chan os.Signal, 1)
+		signal.Notify(wait, syscall.SIGINT, syscall.SIGTERM)
+		<-wait // Wait for SIGINT or SIGTERM
+		log.Println("Signal received, terminating...")
+		cancel() // Stop the processor
+		<-done
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(notifyCmd)
+
+	notifyCmd.Flags().StringVarP(&group, "group", "g", "", "Group")
+	notifyCmd.MarkFlagRequired("group")
+
+	notifyCmd.Flags().StringVar(&storedTopic, "stored-topic", "", "Stored alerts topic")
+	notifyCmd.MarkFlagRequired("stored-topic")
+
+	notifyCmd.Flags().StringVarP(&webhooksFile, "webhooks", "w", "", "Webhook endpoints (JSON list of url, secret, events, severities, ugc)")
+	notifyCmd.MarkFlagRequired("webhooks")
+
+	notifyCmd.Flags().StringVar(&deliveryLog, "delivery-log", "", "File to log deliveries to, as JSON lines")
+	notifyCmd.Flags().IntVar(&maxAttempts, "max-attempts", 5, "Attempts to deliver an alert to an endpoint")
+	notifyCmd.Flags().DurationVar(&backoff, "backoff", time.Second, "Wait before the first retry, doubled after each attempt")
+	notifyCmd.Flags().DurationVar(&webhookTimeout, "timeout", 10*time.Second, "Timeout of each delivery attempt")
+	notifyCmd.Flags().IntVar(&webhookWorkers, "workers", 4, "Deliveries made at once")
+
+	notifyCmd.Flags().StringVarP(&system, "system", "s", "nws", "System name")
+}
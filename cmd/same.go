@@ -0,0 +1,78 @@
+// Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/alerting/alerts-nws/pkg/same"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+	"github.com/spf13/cobra"
+)
+
+var wavFile string
+var attentionDuration time.Duration
+
+// sameCmd represents the same command
+var sameCmd = &cobra.Command{
+	Use:   "same [CAP file]",
+	Short: "Print the SAME headers of an alert, optionally rendering them as audio",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		f, err := os.Open(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+
+		var alert capxml.Alert
+		if err := xml.NewDecoder(f).Decode(&alert); err != nil {
+			log.Fatal(err)
+		}
+
+		headers, err := same.FromAlert(&alert)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, header := range headers {
+			fmt.Println(header)
+		}
+
+		if wavFile == "" {
+			return
+		}
+
+		w, err := os.Create(wavFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer w.Close()
+
+		if err := same.Render(w, headers, attentionDuration); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sameCmd)
+
+	sameCmd.Flags().StringVarP(&wavFile, "output", "o", "", "WAV file to render the headers, attention tones and ends of message to")
+	sameCmd.Flags().DurationVar(&attentionDuration, "attention", 8*time.Second, "Duration of the attention tone (8 to 25 seconds, 0 to omit)")
+}
@@ -0,0 +1,80 @@
+// Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/alerting/alerts-nws/pkg/subscribe"
+	"github.com/spf13/cobra"
+)
+
+var subscriptionsTopic string
+var notificationsTopic string
+
+// subscribeCmd represents the subscribe command
+var subscribeCmd = &cobra.Command{
+	Use:   "subscribe",
+	Short: "Notify subscribers of stored alerts covering their locations",
+	Run: func(cmd *cobra.Command, args []string) {
+		// Generate config.
+		conf := subscribe.Config{
+			Brokers:            brokers,
+			Group:              group,
+			StoredTopic:        storedTopic,
+			SubscriptionsTopic: subscriptionsTopic,
+			NotificationsTopic: notificationsTopic,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan bool)
+
+		go func() {
+			defer close(done)
+			if err := subscribe.Run(ctx, conf); err != nil {
+				if err != context.Canceled {
+					log.Fatal(err)
+				}
+			}
+		}()
+
+		wait := make(chan os.Signal, 1)
+		signal.Notify(wait, syscall.SIGINT, syscall.SIGTERM)
+		<-wait // Wait for SIGINT or SIGTERM
+		log.Println("Signal received, terminating...")
+		cancel() // Stop the processors
+		<-done
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(subscribeCmd)
+
+	subscribeCmd.Flags().StringVarP(&group, "group", "g", "", "Group")
+	subscribeCmd.MarkFlagRequired("group")
+
+	subscribeCmd.Flags().StringVar(&storedTopic, "stored-topic", "", "Stored alerts topic")
+	subscribeCmd.MarkFlagRequired("stored-topic")
+
+	subscribeCmd.Flags().StringVar(&subscriptionsTopic, "subscriptions-topic", "", "Subscriptions topic (subscribe/unsubscribe messages, keyed by subscription ID)")
+	subscribeCmd.MarkFlagRequired("subscriptions-topic")
+
+	subscribeCmd.Flags().StringVarP(&notificationsTopic, "notifications-topic", "n", "", "Notifications topic, keyed by subscriber")
+	subscribeCmd.MarkFlagRequired("notifications-topic")
+}
@@ -0,0 +1,350 @@
+package active
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alerting/alerts-naads/pkg/codec"
+	"github.com/alerting/alerts-nws/pkg/expire"
+	"github.com/alerting/alerts-nws/pkg/vtec"
+	"github.com/alerting/alerts-nws/pkg/zones"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+	"github.com/lovoo/goka"
+)
+
+// Config is the configuration for the active alerts processor.
+type Config struct {
+	Brokers []string
+
+	// The active alerts table is kept by the group.
+	Group string
+
+	// Topic of stored alerts (see consume.Config.StoredTopic).
+	StoredTopic string
+
+	// Topic of expirations (see consume.Config.ExpiredTopic). If not
+	// set, expired alerts are only left out when listing the alerts.
+	ExpiredTopic string
+}
+
+// A removal is a loopback message, keyed by alert ID, sent when
+// an alert is updated or cancelled.
+type removal struct{}
+
+type removalCodec struct{}
+
+func (c *removalCodec) Encode(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case *removal:
+		return json.Marshal(v)
+	default:
+		return nil, errors.New("Unknown type provided")
+	}
+}
+
+func (c *removalCodec) Decode(data []byte) (interface{}, error) {
+	var r removal
+	err := json.Unmarshal(data, &r)
+	return &r, err
+}
+
+// A Filter selects alerts by the zones they cover, or the office
+// that issued them. Empty fields match all alerts. Marine zones are
+// not in any state.
+type Filter struct {
+	// State, ex. KS.
+	State string
+
+	// Zone, as a UGC code, ex. KSZ040 or KSC177.
+	Zone string
+
+	// Office, ex. TOP or KTOP.
+	Office string
+}
+
+// Matches returns whether any of the alert's infos match the filter.
+func (filter *Filter) Matches(alert *capxml.Alert) bool {
+	for _, info := range alert.Infos {
+		if filter.MatchesInfo(info) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesInfo returns whether the info matches the filter.
+func (filter *Filter) MatchesInfo(info *capxml.Info) bool {
+	if filter.Office != "" {
+		office := Office(info)
+		if !strings.EqualFold(office, filter.Office) && !(len(office) == 4 && strings.EqualFold(office[1:], filter.Office)) {
+			return false
+		}
+	}
+
+	if filter.State == "" && filter.Zone == "" {
+		return true
+	}
+	for _, ugc := range UGCs(info) {
+		if (filter.State == "" || strings.EqualFold(zones.State(ugc), filter.State)) &&
+			(filter.Zone == "" || strings.EqualFold(ugc, filter.Zone)) {
+			return true
+		}
+	}
+	return false
+}
+
+// UGCs returns the UGC codes of the info's areas.
+func UGCs(info *capxml.Info) []string {
+	var ugcs []string
+	for _, area := range info.Areas {
+		for _, ugc := range area.GeoCodes["UGC"] {
+			if len(ugc) >= 2 {
+				ugcs = append(ugcs, ugc)
+			}
+		}
+	}
+	return ugcs
+}
+
+// Office returns the office that issued the info (ex. KTOP), from
+// its VTEC or WMO identifier, or an empty string if unknown.
+func Office(info *capxml.Info) string {
+	for _, str := range info.Parameters["VTEC"] {
+		if pvtec, err := vtec.ParsePVTEC(str); err == nil {
+			return pvtec.Office
+		}
+	}
+
+	if values := info.Parameters["WMOidentifier"]; len(values) > 0 {
+		if fields := strings.Fields(values[0]); len(fields) >= 2 {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// Span returns the time the info begins, its onset or effective time,
+// and the time it ends: the end of its VTEC events, its event ending
+// time, or its expiry time. The end is zero if unknown.
+func Span(alert *capxml.Alert, info *capxml.Info) (time.Time, time.Time) {
+	begin := alert.Sent.Time
+	if info.Onset != nil && !info.Onset.IsZero() {
+		begin = info.Onset.Time
+	} else if info.Effective != nil && !info.Effective.IsZero() {
+		begin = info.Effective.Time
+	}
+
+	var end time.Time
+	for _, str := range info.Parameters["VTEC"] {
+		pvtecs, _ := vtec.ParseAllPVTEC(str)
+		for _, pvtec := range pvtecs {
+			if pvtec.End.After(end) {
+				end = pvtec.End
+			}
+		}
+	}
+	if end.IsZero() {
+		for _, str := range info.Parameters["eventEndingTime"] {
+			if t, err := time.Parse(time.RFC3339, str); err == nil {
+				end = t
+			}
+		}
+	}
+	if end.IsZero() && info.Expires != nil {
+		end = info.Expires.Time
+	}
+	return begin, end
+}
+
+// ended returns whether the info ends its VTEC events.
+func ended(info *capxml.Info) bool {
+	found := false
+	for _, str := range info.Parameters["VTEC"] {
+		pvtec, err := vtec.ParsePVTEC(str)
+		if err != nil {
+			continue
+		}
+		found = true
+
+		switch pvtec.Action {
+		case vtec.ActionCancel, vtec.ActionExpire, vtec.ActionUpgrade:
+		default:
+			return false
+		}
+	}
+	return found
+}
+
+// Active returns whether the alert is active at the time: it is not
+// a cancellation, and has an info that has neither expired nor
+// ended its events.
+func Active(alert *capxml.Alert, now time.Time) bool {
+	if alert.MessageType == capxml.MessageTypeCancel {
+		return false
+	}
+
+	for _, info := range alert.Infos {
+		if ended(info) {
+			continue
+		}
+		if info.Expires == nil || info.Expires.IsZero() || now.Before(info.Expires.Time) {
+			return true
+		}
+	}
+	return false
+}
+
+func collectAlert(gctx goka.Context, msg interface{}) {
+	alert := msg.(capxml.Alert)
+
+	for _, reference := range alert.References {
+		gctx.Loopback(reference.ID(), new(removal))
+	}
+
+	if Active(&alert, time.Now()) {
+		gctx.SetValue(&alert)
+	}
+}
+
+func collectRemoval(gctx goka.Context, msg interface{}) {
+	if gctx.Value() != nil {
+		log.Printf("Removing superseded alert %s", gctx.Key())
+		gctx.Delete()
+	}
+}
+
+func collectExpiration(gctx goka.Context, msg interface{}) {
+	expiration := msg.(*expire.Expiration)
+
+	if gctx.Value() != nil {
+		log.Printf("Removing alert %s (%s)", gctx.Key(), expiration.Type)
+		gctx.Delete()
+	}
+}
+
+// Define defines the processor group that keeps the table of active
+// alerts, keyed by alert ID. Alerts are removed when they are updated,
+// cancelled, expire or their events end.
+func Define(group goka.Group, storedTopic, expiredTopic goka.Stream) *goka.GroupGraph {
+	edges := []goka.Edge{
+		goka.Input(storedTopic, new(codec.Alert), collectAlert),
+		goka.Loop(new(removalCodec), collectRemoval),
+		goka.Persist(new(codec.Alert)),
+	}
+	if expiredTopic != "" {
+		edges = append(edges, goka.Input(expiredTopic, new(expire.ExpirationCodec), collectExpiration))
+	}
+	return goka.DefineGroup(group, edges...)
+}
+
+// NewView creates a view of the active alerts table kept by the group.
+func NewView(brokers []string, group goka.Group, options ...goka.ViewOption) (*goka.View, error) {
+	return goka.NewView(brokers, goka.GroupTable(group), new(codec.Alert), options...)
+}
+
+// Alerts returns the alerts in the view that are active, and
+// match the filter, if any, most recently sent first.
+func Alerts(view *goka.View, filter *Filter) ([]*capxml.Alert, error) {
+	it, err := view.Iterator()
+	if err != nil {
+		return nil, err
+	}
+	defer it.Release()
+
+	now := time.Now()
+	var alerts []*capxml.Alert
+	for it.Next() {
+		value, err := it.Value()
+		if err != nil {
+			return nil, err
+		}
+
+		alert, ok := value.(capxml.Alert)
+		if !ok || !Active(&alert, now) || (filter != nil && !filter.Matches(&alert)) {
+			continue
+		}
+		alerts = append(alerts, &alert)
+	}
+
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Sent.After(alerts[j].Sent.Time)
+	})
+	return alerts, nil
+}
+
+// wait waits for the view to be recovered.
+func wait(ctx context.Context, view *goka.View, errs <-chan error) error {
+	for !view.Recovered() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
+			return err
+		case <-time.After(time.Second):
+		}
+	}
+	return nil
+}
+
+// Run runs the processor keeping the active alerts table, and a view
+// of it. Once the view is recovered, recovered is called with the view.
+// Run returns when any of them return.
+func Run(ctx context.Context, conf Config, recovered func(ctx context.Context, view *goka.View) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	group := goka.Group(conf.Group)
+	p, err := goka.NewProcessor(conf.Brokers, Define(group, goka.Stream(conf.StoredTopic), goka.Stream(conf.ExpiredTopic)))
+	if err != nil {
+		return err
+	}
+
+	view, err := NewView(conf.Brokers, group)
+	if err != nil {
+		return err
+	}
+
+	errs := make(chan error, 3)
+	go func() {
+		errs <- p.Run(ctx)
+	}()
+	go func() {
+		errs <- view.Run(ctx)
+	}()
+
+	if err := wait(ctx, view, errs); err != nil {
+		return err
+	}
+
+	go func() {
+		errs <- recovered(ctx, view)
+	}()
+	return <-errs
+}
+
+// Snapshot returns the active alerts in the table kept by the group,
+// matching the filter, if any, without running the processor.
+func Snapshot(ctx context.Context, brokers []string, group string, filter *Filter) ([]*capxml.Alert, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	view, err := NewView(brokers, goka.Group(group))
+	if err != nil {
+		return nil, err
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- view.Run(ctx)
+	}()
+
+	if err := wait(ctx, view, errs); err != nil {
+		return nil, err
+	}
+	return Alerts(view, filter)
+}
@@ -0,0 +1,50 @@
+package active
+
+import (
+	"testing"
+
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+func TestMatchesInfo(t *testing.T) {
+	info := func(vtec string, ugcs ...string) *capxml.Info {
+		return &capxml.Info{
+			Parameters: capxml.KeyValue{"VTEC": {vtec}},
+			Areas: []*capxml.Area{
+				{GeoCodes: capxml.KeyValue{"UGC": ugcs}},
+			},
+		}
+	}
+	tornado := info("/O.NEW.KTOP.TO.W.0012.190528T2141Z-190528T2215Z/", "KSC161", "KSC149")
+	marine := info("/O.NEW.KMFL.MA.W.0042.190528T2141Z-190528T2215Z/", "AMZ630", "GMZ656")
+
+	tests := []struct {
+		name   string
+		filter Filter
+		info   *capxml.Info
+		want   bool
+	}{
+		{"empty", Filter{}, tornado, true},
+		{"state", Filter{State: "KS"}, tornado, true},
+		{"state in lower case", Filter{State: "ks"}, tornado, true},
+		{"other state", Filter{State: "MO"}, tornado, false},
+		{"zone", Filter{Zone: "KSC149"}, tornado, true},
+		{"other zone", Filter{Zone: "KSC177"}, tornado, false},
+		{"state and zone", Filter{State: "KS", Zone: "KSC161"}, tornado, true},
+		{"office", Filter{Office: "KTOP"}, tornado, true},
+		{"office without K", Filter{Office: "top"}, tornado, true},
+		{"other office", Filter{Office: "EAX"}, tornado, false},
+		{"marine zone", Filter{Zone: "AMZ630"}, marine, true},
+		{"marine area as state", Filter{State: "AM"}, marine, false},
+		{"marine area as state (Gulf)", Filter{State: "GM"}, marine, false},
+		{"state of marine zones", Filter{State: "FL"}, marine, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.filter.MatchesInfo(test.info); got != test.want {
+				t.Errorf("%+v.MatchesInfo() = %v, want %v", test.filter, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alerting/alerts-naads/pkg/codec"
+	"github.com/alerting/alerts-nws/pkg/fetch"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+	"github.com/lovoo/goka"
+)
+
+// Namespace of CAP 1.2 documents.
+const Namespace = "urn:oasis:names:tc:emergency:cap:1.2"
+
+// Name of the index file, in the archive's directory.
+const IndexFile = "index.jsonl"
+
+// Config is the configuration for the archive processor.
+type Config struct {
+	Brokers []string
+	Group   string
+
+	// Topic of stored alerts (see consume.Config.StoredTopic). Only
+	// stored alerts are archived, re-serialised unless RawTopic is set.
+	StoredTopic string
+
+	// Topic of the fetched bytes of alerts (see fetch.Config.RawTopic).
+	// If set, the fetched bytes of the stored alerts are written as is.
+	// The bytes are kept in the group table until the alert is stored,
+	// so those of alerts that are never stored stay in it.
+	RawTopic string
+
+	Archive *Archive
+}
+
+// An Entry of the index.
+type Entry struct {
+	ID         string    `json:"id"`
+	Identifier string    `json:"identifier"`
+	Sender     string    `json:"sender"`
+	Sent       time.Time `json:"sent"`
+	Path       string    `json:"path"`
+	Written    time.Time `json:"written"`
+}
+
+// An Archive writes alerts as CAP files, in a YYYY/MM/DD/{id}.xml
+// layout by the time they were sent, and keeps an index of the files
+// written, as JSON lines.
+type Archive struct {
+	Dir string
+
+	mutex sync.Mutex
+}
+
+// Path returns the path of the alert's file, relative to the directory.
+func Path(alert *capxml.Alert) string {
+	sent := alert.Sent.UTC()
+	return filepath.Join(sent.Format("2006"), sent.Format("01"), sent.Format("02"), alert.ID()+".xml")
+}
+
+// circle returns the text of a circle element: the centre, as lat,lon,
+// and the radius in km. The radius is scaled as the capxml decoder
+// divides it by 1000.
+func circle(c *capxml.Circle) (string, error) {
+	if len(c.Coordinates) != 2 {
+		return "", errors.New("Invalid number of coordinates in circle")
+	}
+
+	return fmt.Sprintf("%s,%s %s",
+		strconv.FormatFloat(c.Coordinates[1], 'f', -1, 64),
+		strconv.FormatFloat(c.Coordinates[0], 'f', -1, 64),
+		strconv.FormatFloat(c.Radius*1000, 'f', -1, 64)), nil
+}
+
+// withoutCircles returns a copy of the alert, without the circles of its
+// areas, and the circles of each area, in document order.
+func withoutCircles(alert *capxml.Alert) (*capxml.Alert, []capxml.Circles) {
+	var circles []capxml.Circles
+
+	copied := *alert
+	copied.Infos = make([]*capxml.Info, len(alert.Infos))
+	for i, info := range alert.Infos {
+		copiedInfo := *info
+		copiedInfo.Areas = make([]*capxml.Area, len(info.Areas))
+		for j, area := range info.Areas {
+			copiedArea := *area
+			copiedArea.Circles = nil
+			copiedInfo.Areas[j] = &copiedArea
+			circles = append(circles, area.Circles)
+		}
+		copied.Infos[i] = &copiedInfo
+	}
+
+	return &copied, circles
+}
+
+// Marshal serialises the alert as a CAP 1.2 document.
+func Marshal(alert *capxml.Alert) ([]byte, error) {
+	// The circles are written separately, as capxml can't encode them
+	alert, circles := withoutCircles(alert)
+
+	var buf bytes.Buffer
+	start := xml.StartElement{
+		Name: xml.Name{Local: "alert"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: Namespace}},
+	}
+	if err := xml.NewEncoder(&buf).EncodeElement(alert, start); err != nil {
+		return nil, err
+	}
+
+	// Read the tokens back, without resolving the namespace, so it is
+	// only declared on the root
+	var tokens []xml.Token
+	decoder := xml.NewDecoder(&buf)
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, xml.CopyToken(token))
+	}
+
+	out := bytes.NewBufferString(xml.Header)
+	encoder := xml.NewEncoder(out)
+	encoder.Indent("", "  ")
+
+	// Circles follow the polygons of their area
+	area := -1
+	inArea := false
+	for _, token := range tokens {
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "area":
+				area++
+				inArea = true
+			case "geocode", "altitude", "ceiling":
+				if err := encodeCircles(encoder, circles, area, &inArea); err != nil {
+					return nil, err
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Local == "area" {
+				if err := encodeCircles(encoder, circles, area, &inArea); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if err := encoder.EncodeToken(token); err != nil {
+			return nil, err
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	out.WriteString("\n")
+	return out.Bytes(), nil
+}
+
+// encodeCircles encodes the circles of the area, if they
+// haven't been encoded since the area started.
+func encodeCircles(encoder *xml.Encoder, circles []capxml.Circles, area int, pending *bool) error {
+	if !*pending || area < 0 || area >= len(circles) {
+		return nil
+	}
+	*pending = false
+
+	for _, c := range circles[area] {
+		str, err := circle(c)
+		if err != nil {
+			return err
+		}
+		if err := encoder.EncodeElement(str, xml.StartElement{Name: xml.Name{Local: "circle"}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteFile writes the data to a temporary file, renamed to
+// the path once written, so the file is never partially written.
+func WriteFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Write writes the data as the alert's file, and adds it to the index.
+func (archive *Archive) Write(alert *capxml.Alert, data []byte) (*Entry, error) {
+	entry := &Entry{
+		ID:         alert.ID(),
+		Identifier: alert.Identifier,
+		Sender:     alert.Sender,
+		Sent:       alert.Sent.Time,
+		Path:       Path(alert),
+		Written:    time.Now().UTC(),
+	}
+
+	if err := WriteFile(filepath.Join(archive.Dir, entry.Path), data); err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	archive.mutex.Lock()
+	defer archive.mutex.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(archive.Dir, IndexFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func collectAlert(conf *Config) func(ctx goka.Context, msg interface{}) {
+	return func(gctx goka.Context, msg interface{}) {
+		alert := msg.(capxml.Alert)
+
+		var data []byte
+		if conf.RawTopic != "" {
+			data, _ = gctx.Value().([]byte)
+			if data == nil {
+				log.Printf("No fetched bytes for %s, re-serialising it", alert.ID())
+			} else {
+				gctx.Delete()
+			}
+		}
+
+		if data == nil {
+			var err error
+			data, err = Marshal(&alert)
+			if err != nil {
+				log.Printf("Unable to serialise %s: %v", alert.ID(), err)
+				return
+			}
+		}
+
+		entry, err := conf.Archive.Write(&alert, data)
+		if err != nil {
+			log.Printf("Unable to archive %s: %v", alert.ID(), err)
+			return
+		}
+		log.Printf("Archived %s to %s", entry.ID, entry.Path)
+	}
+}
+
+// collectRaw keeps the fetched bytes of the alert, until it is stored.
+func collectRaw(gctx goka.Context, msg interface{}) {
+	gctx.SetValue(msg.([]byte))
+}
+
+// Run runs the archive processor, writing the stored alerts, with their
+// fetched bytes if the raw topic is set.
+func Run(ctx context.Context, conf Config) error {
+	if conf.StoredTopic == "" {
+		return errors.New("No topic to archive")
+	}
+
+	edges := []goka.Edge{
+		goka.Input(goka.Stream(conf.StoredTopic), new(codec.Alert), collectAlert(&conf)),
+	}
+	if conf.RawTopic != "" {
+		edges = append(edges,
+			goka.Input(goka.Stream(conf.RawTopic), new(fetch.RawCodec), collectRaw),
+			goka.Persist(new(fetch.RawCodec)),
+		)
+	}
+
+	p, err := goka.NewProcessor(conf.Brokers, goka.DefineGroup(goka.Group(conf.Group), edges...))
+	if err != nil {
+		return err
+	}
+	return p.Run(ctx)
+}
@@ -0,0 +1,184 @@
+package archive
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+	"github.com/lovoo/goka"
+)
+
+const testAlert = `<?xml version="1.0" encoding="UTF-8"?>
+<alert xmlns="urn:oasis:names:tc:emergency:cap:1.2">
+  <identifier>NOAA-NWS-ALERTS-KS1259A1B4F0F8.TornadoWarning.1259A1B4F0F8KS.TOPTORTOP.c1d4fd6b8e2e6a8e1b3b9f5e3a2c1d0f</identifier>
+  <sender>w-nws.webmaster@noaa.gov</sender>
+  <sent>2019-05-28T16:41:00-05:00</sent>
+  <status>Actual</status>
+  <msgType>Alert</msgType>
+  <scope>Public</scope>
+  <info>
+    <category>Met</category>
+    <event>Tornado Warning</event>
+    <urgency>Immediate</urgency>
+    <severity>Extreme</severity>
+    <certainty>Observed</certainty>
+    <area>
+      <areaDesc>Riley</areaDesc>
+      <polygon>39.3,-96.9 39.4,-96.6 39.1,-96.5 39.3,-96.9</polygon>
+      <circle>39.25,-96.7 10</circle>
+      <circle>39.1,-96.6 2.5</circle>
+      <geocode>
+        <valueName>UGC</valueName>
+        <value>KSC161</value>
+      </geocode>
+      <altitude>0</altitude>
+      <ceiling>3000</ceiling>
+    </area>
+    <area>
+      <areaDesc>Pottawatomie</areaDesc>
+      <circle>39.4,-96.3 5</circle>
+    </area>
+  </info>
+</alert>`
+
+func parse(t *testing.T, data string) *capxml.Alert {
+	var alert capxml.Alert
+	if err := xml.Unmarshal([]byte(data), &alert); err != nil {
+		t.Fatal(err)
+	}
+	return &alert
+}
+
+func TestMarshal(t *testing.T) {
+	alert := parse(t, testAlert)
+
+	data, err := Marshal(alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	str := string(data)
+
+	for _, want := range []string{
+		`<alert xmlns="urn:oasis:names:tc:emergency:cap:1.2">`,
+		"<circle>39.25,-96.7 10</circle>",
+		"<circle>39.1,-96.6 2.5</circle>",
+		"<circle>39.4,-96.3 5</circle>",
+		"<altitude>0</altitude>",
+		"<ceiling>3000</ceiling>",
+	} {
+		if !strings.Contains(str, want) {
+			t.Errorf("Marshal() is missing %s:\n%s", want, str)
+		}
+	}
+
+	// Circles follow the polygons, before the geocodes
+	if polygon, circle, geocode := strings.Index(str, "<polygon>"), strings.Index(str, "<circle>"), strings.Index(str, "<geocode>"); !(polygon < circle && circle < geocode) {
+		t.Errorf("Area elements are out of order:\n%s", str)
+	}
+
+	// The alert is left as is
+	if len(alert.Infos[0].Areas[0].Circles) != 2 {
+		t.Error("Marshal() removed the alert's circles")
+	}
+
+	// And reads back the same
+	got := parse(t, str)
+	if !reflect.DeepEqual(got.Infos[0].Areas, alert.Infos[0].Areas) {
+		t.Errorf("Areas read back as %+v, want %+v", got.Infos[0].Areas, alert.Infos[0].Areas)
+	}
+}
+
+func TestMarshalInvalidCircle(t *testing.T) {
+	alert := parse(t, testAlert)
+	alert.Infos[0].Areas[0].Circles[0].Coordinates = []float64{1, 2, 3}
+
+	if _, err := Marshal(alert); err == nil {
+		t.Error("Marshal() accepted a circle with 3 coordinates")
+	}
+}
+
+// testContext is a goka.Context for a single message, backed by a table.
+type testContext struct {
+	table map[string]interface{}
+	key   string
+}
+
+func (c *testContext) Topic() goka.Stream                                    { return "" }
+func (c *testContext) Key() string                                           { return c.key }
+func (c *testContext) Partition() int32                                      { return 0 }
+func (c *testContext) Offset() int64                                         { return 0 }
+func (c *testContext) Value() interface{}                                    { return c.table[c.key] }
+func (c *testContext) SetValue(value interface{})                            { c.table[c.key] = value }
+func (c *testContext) Delete()                                               { delete(c.table, c.key) }
+func (c *testContext) Timestamp() time.Time                                  { return time.Time{} }
+func (c *testContext) Join(topic goka.Table) interface{}                     { return nil }
+func (c *testContext) Lookup(topic goka.Table, key string) interface{}       { return nil }
+func (c *testContext) Emit(topic goka.Stream, key string, value interface{}) {}
+func (c *testContext) Loopback(key string, value interface{})                {}
+func (c *testContext) Fail(err error)                                        { panic(err) }
+func (c *testContext) Context() context.Context                              { return context.Background() }
+
+func TestRaw(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{RawTopic: "raw", Archive: &Archive{Dir: dir}}
+	table := make(map[string]interface{})
+
+	rejectedData := strings.Replace(testAlert, "<identifier>NOAA", "<identifier>REJECTED", 1)
+	stored := parse(t, testAlert)
+	rejected := parse(t, rejectedData)
+	unfetched := parse(t, strings.Replace(testAlert, "<identifier>NOAA", "<identifier>UNFETCHED", 1))
+
+	// The fetched bytes of two alerts, of which only one is stored
+	collectRaw(&testContext{table: table, key: stored.ID()}, []byte(testAlert))
+	collectRaw(&testContext{table: table, key: rejected.ID()}, []byte(rejectedData))
+	for _, alert := range []*capxml.Alert{stored, unfetched} {
+		collectAlert(conf)(&testContext{table: table, key: alert.ID()}, *alert)
+	}
+
+	// The stored alert is written as fetched
+	data, err := ioutil.ReadFile(filepath.Join(dir, Path(stored)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != testAlert {
+		t.Errorf("Archived %s as:\n%s", stored.ID(), data)
+	}
+	if _, ok := table[stored.ID()]; ok {
+		t.Error("Fetched bytes kept once archived")
+	}
+
+	// The rejected alert isn't written
+	if _, err := os.Stat(filepath.Join(dir, Path(rejected))); !os.IsNotExist(err) {
+		t.Errorf("Archived %s, which was not stored", rejected.ID())
+	}
+
+	// The alert without fetched bytes is re-serialised
+	data, err = ioutil.ReadFile(filepath.Join(dir, Path(unfetched)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), xml.Header) || !strings.Contains(string(data), "<identifier>UNFETCHED") {
+		t.Errorf("Archived %s as:\n%s", unfetched.ID(), data)
+	}
+
+	// Both are in the index
+	index, err := ioutil.ReadFile(filepath.Join(dir, IndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(index)), "\n"); len(lines) != 2 {
+		t.Errorf("Index has %d entries, want 2:\n%s", len(lines), index)
+	}
+}
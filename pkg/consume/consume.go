@@ -1,22 +1,49 @@
 package consume
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"fmt"
 	"log"
 	"time"
 
 	"github.com/alerting/alerts-naads/pkg/codec"
+	"github.com/alerting/alerts-nws/pkg/convert"
+	"github.com/alerting/alerts-nws/pkg/diff"
+	"github.com/alerting/alerts-nws/pkg/events"
+	"github.com/alerting/alerts-nws/pkg/expire"
+	"github.com/alerting/alerts-nws/pkg/gauges"
+	"github.com/alerting/alerts-nws/pkg/shorttext"
+	"github.com/alerting/alerts-nws/pkg/vtec"
+	"github.com/alerting/alerts-nws/pkg/zones"
 	"github.com/alerting/alerts/pkg/alerts"
 	"github.com/alerting/alerts/pkg/cap"
 	capxml "github.com/alerting/alerts/pkg/cap/xml"
-	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/ptypes"
 	"github.com/lovoo/goka"
 	"github.com/lovoo/goka/kafka"
 )
 
+const (
+	// Geocode containing the UGC codes derived from an area's polygons.
+	geoCodeDerivedUGC = "UGC-derived"
+
+	// Geocode containing the percentage of each derived UGC zone
+	// covered by the area's polygons, as UGC:percentage.
+	geoCodeDerivedCoverage = "UGC-derived-coverage"
+
+	// Geocodes containing the names, issuing offices and IANA time
+	// zones of the area's UGC zones.
+	geoCodeZoneName     = "UGC-name"
+	geoCodeZoneOffice   = "UGC-office"
+	geoCodeZoneTimeZone = "UGC-timezone"
+
+	// Geocodes containing the names, issuing offices and IANA time
+	// zones of the zones derived from the area's polygons.
+	geoCodeDerivedName     = "UGC-derived-name"
+	geoCodeDerivedOffice   = "UGC-derived-office"
+	geoCodeDerivedTimeZone = "UGC-derived-timezone"
+)
+
 type Config struct {
 	Brokers    []string
 	Topic      string
@@ -26,11 +53,210 @@ type Config struct {
 
 	FetchTopic string
 	FetchURLs  []string
-	Polygons   map[string]*capxml.Polygon
+	Zones      *zones.Store
+
+	// Zones covered by more than this fraction of an alert's
+	// polygon are added to the area's derived UGC geocodes.
+	DerivedThreshold float64
+
+	// River gauges, keyed by NWSLI.
+	Gauges map[string]*gauges.Gauge
+
+	// Topic for VTEC event updates. The event table is kept
+	// by the <Group>-events processor group.
+	EventsTopic string
+
+	// Topic for the changes made by updates and cancellations,
+	// compared to the alerts they reference.
+	ChangesTopic string
+
+	// How long to hold alerts waiting for the alerts they reference
+	// to be stored. If zero, alerts are not held.
+	PendingTimeout time.Duration
+
+	// Topic for the events emitted when alerts expire or end. The
+	// upcoming expirations are kept by the <Group>-expire processor group.
+	ExpiredTopic string
+
+	// Topic for the alerts that have been stored, as enriched by the
+	// consumer. Used by the sinks (ex. notify).
+	StoredTopic string
+
+	// Renders the short texts added to the infos' parameters
+	// (NWS-text90, NWS-text160 and NWS-text360).
+	ShortText *shorttext.Renderer
+
+	// Policy deciding which alerts are stored.
+	Policy *Policy
 
 	AlertsService alerts.AlertsServiceClient
 
 	System string
+
+	// View of the pending alerts in the group table.
+	pending *goka.View
+}
+
+// fillPolygons returns the polygons for the area's UGC codes. The UGC
+// codes that cannot be found, or an area without UGC codes, are filled
+// in using the area's SAME codes.
+func fillPolygons(set *zones.Set, area *capxml.Area) capxml.Polygons {
+	polygons := make(capxml.Polygons, 0)
+	added := make(map[*capxml.Polygon]bool)
+
+	// Fill in the polygons based on UGC
+	missing := false
+	for _, ugc := range area.GeoCodes["UGC"] {
+		if polygon, ok := set.Polygons[ugc]; ok {
+			log.Printf("Using UGC polygon for %s", ugc)
+			polygons = append(polygons, polygon)
+			added[polygon] = true
+		} else {
+			log.Printf("Cannot find polygon for %s", ugc)
+			missing = true
+		}
+	}
+
+	if !missing && len(polygons) > 0 {
+		return polygons
+	}
+
+	// Fall back to the SAME codes of the missing UGC codes: a SAME code
+	// is only used if its polygon isn't already covered by the UGC
+	// polygons found (ex. the county of a zone that was found).
+	for _, same := range area.GeoCodes["SAME"] {
+		polygon, ok := set.SAMEPolygons[same]
+		if !ok {
+			log.Printf("Cannot find polygon for SAME %s", same)
+			continue
+		}
+		if added[polygon] || covered(polygon, polygons) {
+			continue
+		}
+
+		log.Printf("Using SAME polygon for %s", same)
+		polygons = append(polygons, polygon)
+		added[polygon] = true
+	}
+
+	return polygons
+}
+
+// covered returns whether most (over half) of the polygon
+// is covered by the polygons.
+func covered(polygon *capxml.Polygon, polygons capxml.Polygons) bool {
+	bounds := zones.Bounds(polygon)
+
+	coverage := 0.0
+	for _, p := range polygons {
+		coverage += zones.Coverage(polygon, bounds, p, zones.Bounds(p))
+	}
+	return coverage > 0.5
+}
+
+// deriveGeoCodes adds the UGC codes of the zones covered by the area's
+// polygons, along with the percentage of each zone covered. Zones already
+// in the area's UGC codes are not added again.
+func deriveGeoCodes(set *zones.Set, area *capxml.Area, threshold float64) {
+	if area.GeoCodes == nil {
+		area.GeoCodes = make(capxml.KeyValue)
+	}
+
+	// Don't repeat the codes the area already has
+	seen := make(map[string]bool)
+	for _, ugc := range area.GeoCodes["UGC"] {
+		seen[ugc] = true
+	}
+	for _, ugc := range area.GeoCodes[geoCodeDerivedUGC] {
+		seen[ugc] = true
+	}
+
+	for _, polygon := range area.Polygons {
+		for _, zone := range set.Intersecting(polygon, threshold) {
+			if seen[zone.UGC] {
+				continue
+			}
+			seen[zone.UGC] = true
+
+			area.GeoCodes[geoCodeDerivedUGC] = append(area.GeoCodes[geoCodeDerivedUGC], zone.UGC)
+			area.GeoCodes[geoCodeDerivedCoverage] = append(area.GeoCodes[geoCodeDerivedCoverage],
+				fmt.Sprintf("%s:%.1f", zone.UGC, zone.Coverage*100))
+		}
+	}
+}
+
+// addZoneMetadata adds the names, issuing offices and time zones of the
+// area's UGC zones, and of the zones derived from its polygons, to the
+// area's geocodes. There is one value per UGC code, in the same order as
+// the codes, left empty if the zone is unknown.
+func addZoneMetadata(set *zones.Set, area *capxml.Area) {
+	add := func(ugcKey, nameKey, officeKey, timeZoneKey string) {
+		ugcs := area.GeoCodes[ugcKey]
+		if len(ugcs) == 0 {
+			return
+		}
+
+		names := make([]string, len(ugcs))
+		offices := make([]string, len(ugcs))
+		timeZones := make([]string, len(ugcs))
+		for i, ugc := range ugcs {
+			zone, ok := set.Zones[ugc]
+			if !ok {
+				continue
+			}
+
+			names[i] = zone.Name
+			offices[i] = zone.Office
+			timeZones[i] = zone.Location()
+		}
+
+		area.GeoCodes[nameKey] = names
+		area.GeoCodes[officeKey] = offices
+		area.GeoCodes[timeZoneKey] = timeZones
+	}
+
+	add("UGC", geoCodeZoneName, geoCodeZoneOffice, geoCodeZoneTimeZone)
+	add(geoCodeDerivedUGC, geoCodeDerivedName, geoCodeDerivedOffice, geoCodeDerivedTimeZone)
+}
+
+// checkReferences checks whether the alerts referenced by the alert have
+// been stored, requesting those that have not to be fetched. The IDs of
+// the references that have not been stored are returned.
+func checkReferences(ctx context.Context, gctx goka.Context, conf *Config, xmlAlert *capxml.Alert) []string {
+	var missing []string
+
+	// Check if references exist
+	if conf.FetchTopic != "" {
+		for _, xmlReference := range xmlAlert.References {
+			log.Printf("Checking reference: %v", xmlReference)
+
+			sent, _ := ptypes.TimestampProto(xmlReference.Sent.Time)
+			ref := &cap.Reference{
+				Sender:     xmlReference.Sender,
+				Identifier: xmlReference.Identifier,
+				Sent:       sent,
+			}
+
+			has, err := conf.AlertsService.Has(ctx, ref)
+			if err != nil {
+				log.Fatal(err)
+				// TODO: Handle
+			}
+
+			if has.Result {
+				continue
+			}
+			missing = append(missing, ref.ID())
+
+			// If we don't have it, and it's not in the fetch table, then let's request it to be fetched.
+			if gctx.Lookup(goka.Table(conf.FetchTopic), ref.ID()) == nil {
+				log.Printf("Requesting %v", ref)
+				gctx.Emit(goka.Stream(conf.FetchTopic), ref.ID(), xmlReference)
+			}
+		}
+	}
+
+	return missing
 }
 
 func collect(ctx context.Context, conf *Config) func(ctx goka.Context, msg interface{}) {
@@ -45,89 +271,201 @@ func collect(ctx context.Context, conf *Config) func(ctx goka.Context, msg inter
 
 		log.Printf("Received: %v, %v => %v,%v,%v", gctx.Topic(), gctx.Key(), xmlAlert.Sender, xmlAlert.Identifier, xmlAlert.Sent)
 
-		// Check if references exist
-		if conf.FetchTopic != "" {
-			for _, xmlReference := range xmlAlert.References {
-				log.Printf("Checking reference: %v", xmlReference)
+		// Hold the alert until the alerts it references are stored
+		missing := checkReferences(ctx, gctx, conf, &xmlAlert)
+		if conf.PendingTimeout > 0 && len(missing) > 0 {
+			park(gctx, gctx.Key(), &xmlAlert, missing[0], time.Now().Add(conf.PendingTimeout))
+			return
+		}
 
-				sent, _ := ptypes.TimestampProto(xmlReference.Sent.Time)
-				ref := &cap.Reference{
-					Sender:     xmlReference.Sender,
-					Identifier: xmlReference.Identifier,
-					Sent:       sent,
-				}
+		process(ctx, gctx, conf, gctx.Key(), &xmlAlert)
+	}
+}
 
-				has, err := conf.AlertsService.Has(ctx, ref)
-				if err != nil {
-					log.Fatal(err)
-					// TODO: Handle
-				}
+// process enriches, converts and stores the alert, received with the key.
+func process(ctx context.Context, gctx goka.Context, conf *Config, key string, xmlAlert *capxml.Alert) {
+	// Use the same zone geometries for the entire alert
+	set := conf.Zones.Load()
 
-				// If we don't have it, and it's not in the fetch table, then let's request it to be fetched.
-				if !has.Result && gctx.Lookup(goka.Table(conf.FetchTopic), ref.ID()) == nil {
-					log.Printf("Requesting %v", ref)
-					gctx.Emit(goka.Stream(conf.FetchTopic), ref.ID(), xmlReference)
-				}
-			}
+	// Add polygons, if none
+	for _, info := range xmlAlert.Infos {
+		if info.Language == "" {
+			info.Language = "en-US"
 		}
 
-		// Add polygons, if none
-		for _, info := range xmlAlert.Infos {
-			if info.Language == "" {
-				info.Language = "en-US"
+		for _, area := range info.Areas {
+			if len(area.Polygons) == 0 && len(area.Circles) == 0 {
+				area.Polygons = fillPolygons(set, area)
+			} else if len(area.Polygons) > 0 {
+				deriveGeoCodes(set, area, conf.DerivedThreshold)
 			}
 
-			for _, area := range info.Areas {
-				if len(area.Polygons) == 0 && len(area.Circles) == 0 {
-					area.Polygons = make(capxml.Polygons, 0)
-
-					// Fill in the polygons based on UGC
-					for _, ugc := range area.GeoCodes["UGC"] {
-						if polygon, ok := conf.Polygons[ugc]; ok {
-							area.Polygons = append(area.Polygons, polygon)
-						} else {
-							log.Printf("Cannot find polygon for %s", ugc)
-						}
-					}
-				}
+			if area.GeoCodes != nil {
+				addZoneMetadata(set, area)
 			}
 		}
 
-		// Convert to CAP
-		var alert cap.Alert
+		// Add the times, in the local time of the areas
+		addLocalTimes(set, info)
 
-		b, err := json.Marshal(xmlAlert)
-		if err != nil {
+		// Decode the VTEC strings
+		addVTEC(info, xmlAlert.Sent.Time, eventLookup(gctx, conf))
+		addHVTEC(info, conf.Gauges)
+
+		// Decode the NWS-specific parameters
+		addParameters(info)
+		addMotion(info)
+
+		// Render the short texts
+		if conf.ShortText != nil {
+			addShortText(info, conf.ShortText)
+		}
+	}
+
+	// Convert to CAP
+	alert, err := convert.Alert(xmlAlert)
+	if err != nil {
+		log.Printf("Unable to convert %s: %v", xmlAlert.ID(), err)
+		finish(gctx, conf, key, xmlAlert.ID(), xmlAlert)
+		return
+	}
+
+	// Add the system
+	alert.System = conf.System
+
+	// Save the alert, if the policy allows it
+	switch conf.Policy.Decide(alert) {
+	case ActionRoute:
+		log.Printf("Routing %s to %s", alert.ID(), conf.Policy.RouteTopic)
+		gctx.Emit(goka.Stream(conf.Policy.RouteTopic), xmlAlert.ID(), alert)
+	case ActionStore:
+		if _, err := conf.AlertsService.Add(ctx, alert); err != nil {
 			log.Fatal(err)
-			// TODO: Handle
+			// TODO: Handle error
 		}
 
-		jd := jsonpb.Unmarshaler{
-			AllowUnknownFields: true,
+		if conf.StoredTopic != "" {
+			gctx.Emit(goka.Stream(conf.StoredTopic), xmlAlert.ID(), xmlAlert)
 		}
-		err = jd.Unmarshal(bytes.NewReader(b), &alert)
-		if err != nil {
-			log.Fatal(err)
-			// TODO: Handle
+
+		if conf.EventsTopic != "" {
+			emitEventUpdates(gctx, conf, xmlAlert)
 		}
 
-		// Add the system
-		alert.System = conf.System
+		if conf.ChangesTopic != "" && (alert.MessageType == cap.Alert_UPDATE || alert.MessageType == cap.Alert_CANCEL) {
+			emitChanges(ctx, gctx, conf, alert)
+		}
 
-		// Save the alert, if it's good
-		if (alert.Status == cap.Alert_ACTUAL || alert.Status == cap.Alert_EXCERCISE || alert.Status == cap.Alert_TEST) && (alert.MessageType == cap.Alert_ALERT || alert.MessageType == cap.Alert_UPDATE || alert.MessageType == cap.Alert_CANCEL) {
-			if _, err := conf.AlertsService.Add(ctx, &alert); err != nil {
-				log.Fatal(err)
-				// TODO: Handle error
+		if conf.ExpiredTopic != "" {
+			scheduleExpirations(gctx, conf, xmlAlert)
+		}
+	}
+
+	finish(gctx, conf, key, xmlAlert.ID(), alert)
+}
+
+// finish emits the alert (a *cap.Alert, or the *capxml.Alert if it could
+// not be converted) to the retry topic, with the key it was received with,
+// and releases the alerts waiting on it.
+func finish(gctx goka.Context, conf *Config, key, id string, alert interface{}) {
+	if conf.RetryTopic != "" {
+		gctx.Emit(goka.Stream(conf.RetryTopic), key, alert)
+	}
+
+	// Release the alerts waiting on this one
+	release(gctx, conf, id)
+}
+
+// expireScheduleTopic returns the topic used to schedule expirations.
+func expireScheduleTopic(conf *Config) goka.Stream {
+	return goka.Stream(conf.Group + "-expire-schedule")
+}
+
+// scheduleExpirations schedules the alert's expirations, and removes
+// the expirations of the alerts it supersedes or cancels.
+func scheduleExpirations(gctx goka.Context, conf *Config, xmlAlert *capxml.Alert) {
+	for _, ref := range xmlAlert.References {
+		gctx.Emit(expireScheduleTopic(conf), ref.ID(), &expire.Message{Supersede: true})
+	}
+
+	if xmlAlert.MessageType == capxml.MessageTypeCancel {
+		return
+	}
+
+	schedule := &expire.Schedule{
+		AlertID: xmlAlert.ID(),
+	}
+	for _, info := range xmlAlert.Infos {
+		if schedule.Event == "" {
+			schedule.Event = info.Event
+		}
+
+		if info.Expires != nil && info.Expires.After(schedule.Expires) {
+			schedule.Expires = info.Expires.Time
+		}
+
+		// The event ends at the VTEC end time
+		for _, str := range info.Parameters["VTEC"] {
+			pvtecs, _ := vtec.ParseAllPVTEC(str)
+			for _, pvtec := range pvtecs {
+				if !pvtec.End.IsZero() && (schedule.Ends == nil || pvtec.End.After(*schedule.Ends)) {
+					end := pvtec.End
+					schedule.Ends = &end
+				}
 			}
 		}
+	}
+
+	if schedule.Expires.IsZero() && schedule.Ends == nil {
+		return
+	}
+	gctx.Emit(expireScheduleTopic(conf), schedule.AlertID, &expire.Message{Schedule: schedule})
+}
+
+// emitChanges emits the changes between the alert and each of
+// the alerts it references to the changes topic.
+func emitChanges(ctx context.Context, gctx goka.Context, conf *Config, alert *cap.Alert) {
+	for _, ref := range alert.References {
+		previous, err := conf.AlertsService.Get(ctx, ref)
+		if err != nil {
+			log.Printf("Unable to get referenced alert %v: %v", ref, err)
+			continue
+		}
 
-		if conf.RetryTopic != "" {
-			gctx.Emit(goka.Stream(conf.RetryTopic), gctx.Key(), alert)
+		change := diff.Alerts(previous, alert)
+		if change.Empty() && alert.MessageType != cap.Alert_CANCEL {
+			continue
 		}
+
+		log.Printf("Changes from %s: %+v", change.ReferenceID, change)
+		gctx.Emit(goka.Stream(conf.ChangesTopic), change.AlertID, change)
 	}
 }
 
+// runAll runs the functions until the context is cancelled,
+// or one of them fails.
+func runAll(ctx context.Context, runs ...func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(runs))
+	for _, run := range runs {
+		go func(run func(ctx context.Context) error) {
+			errs <- run(ctx)
+		}(run)
+	}
+
+	// Stop the remaining functions once one returns
+	var err error
+	for range runs {
+		if rerr := <-errs; rerr != nil && err == nil {
+			err = rerr
+		}
+		cancel()
+	}
+	return err
+}
+
 func Run(ctx context.Context, conf Config) error {
 	edges := []goka.Edge{
 		goka.Input(goka.Stream(conf.Topic), new(codec.Alert), collect(ctx, &conf)),
@@ -137,6 +475,45 @@ func Run(ctx context.Context, conf Config) error {
 	if conf.FetchTopic != "" {
 		edges = append(edges, goka.Lookup(goka.Table(conf.FetchTopic), new(codec.Reference)))
 	}
+	if conf.StoredTopic != "" {
+		edges = append(edges, goka.Output(goka.Stream(conf.StoredTopic), new(codec.Alert)))
+	}
+	if conf.EventsTopic != "" {
+		edges = append(edges,
+			goka.Output(goka.Stream(conf.EventsTopic), new(events.UpdateCodec)),
+			goka.Lookup(eventsTable(&conf), new(events.EventCodec)))
+	}
+	if conf.ChangesTopic != "" {
+		edges = append(edges, goka.Output(goka.Stream(conf.ChangesTopic), new(diff.Codec)))
+	}
+	if conf.Policy == nil {
+		conf.Policy = DefaultPolicy()
+	}
+	if conf.Policy.RouteTopic != "" {
+		edges = append(edges, goka.Output(goka.Stream(conf.Policy.RouteTopic), new(codec.Alert)))
+	}
+	if conf.ExpiredTopic != "" {
+		edges = append(edges, goka.Output(expireScheduleTopic(&conf), new(expire.MessageCodec)))
+	}
+	if conf.PendingTimeout > 0 {
+		edges = append(edges,
+			goka.Loop(new(pendingMessageCodec), collectPending(ctx, &conf)),
+			goka.Persist(new(pendingAlertsCodec)))
+	}
+
+	var runs []func(ctx context.Context) error
+
+	// Keep the VTEC event table. The processor is created first, as
+	// it creates the table looked up by the consumer.
+	if conf.EventsTopic != "" {
+		eg := events.Define(goka.Group(conf.Group+"-events"), goka.Stream(conf.EventsTopic))
+		ep, err := goka.NewProcessor(conf.Brokers, eg)
+		if err != nil {
+			return err
+		}
+		runs = append(runs, ep.Run)
+	}
+
 	kconf := kafka.NewConfig()
 	// 5 MB
 	kconf.Producer.MaxMessageBytes = 1024 * 1024 * 5
@@ -148,6 +525,34 @@ func Run(ctx context.Context, conf Config) error {
 	if err != nil {
 		return err
 	}
+	runs = append(runs, p.Run)
+
+	// Emit expirations as alerts expire
+	if conf.ExpiredTopic != "" {
+		xg := expire.Define(goka.Group(conf.Group+"-expire"), expireScheduleTopic(&conf), goka.Stream(conf.ExpiredTopic))
+		xp, err := goka.NewProcessor(conf.Brokers, xg)
+		if err != nil {
+			return err
+		}
+		runs = append(runs, xp.Run)
+
+		runs = append(runs, func(ctx context.Context) error {
+			return expire.Sweep(ctx, conf.Brokers, goka.Group(conf.Group+"-expire"), expireScheduleTopic(&conf))
+		})
+	}
+
+	// Release pending alerts that have timed out. The consumer stops
+	// if the sweep fails, rather than holding alerts indefinitely.
+	if conf.PendingTimeout > 0 {
+		conf.pending, err = goka.NewView(conf.Brokers, goka.GroupTable(goka.Group(conf.Group)), new(pendingAlertsCodec))
+		if err != nil {
+			return err
+		}
+
+		runs = append(runs, conf.pending.Run, func(ctx context.Context) error {
+			return sweepPending(ctx, &conf)
+		})
+	}
 
-	return p.Run(ctx)
+	return runAll(ctx, runs...)
 }
@@ -0,0 +1,112 @@
+package consume
+
+import (
+	"testing"
+
+	"github.com/alerting/alerts-nws/pkg/zones"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+// rectangle returns a polygon over the longitudes and latitudes.
+func rectangle(minLon, minLat, maxLon, maxLat float64) *capxml.Polygon {
+	return &capxml.Polygon{
+		Coordinates: [][][]float64{{
+			{minLon, minLat},
+			{maxLon, minLat},
+			{maxLon, maxLat},
+			{minLon, maxLat},
+			{minLon, minLat},
+		}},
+	}
+}
+
+func TestFillPolygons(t *testing.T) {
+	set := &zones.Set{
+		Polygons: map[string]*capxml.Polygon{
+			"KSZ040": rectangle(-97, 39, -96, 40),
+			"KSZ041": rectangle(-96, 39, -95, 40),
+		},
+		SAMEPolygons: map[string]*capxml.Polygon{
+			// Mostly within KSZ040
+			"020161": rectangle(-96.9, 39.1, -95.8, 39.9),
+			// Mostly outside KSZ040
+			"020149": rectangle(-96.25, 39, -95, 40),
+			"020177": rectangle(-97, 38, -96, 39),
+		},
+	}
+
+	tests := []struct {
+		name string
+		ugc  []string
+		same []string
+		want []*capxml.Polygon
+	}{
+		{
+			"all zones found",
+			[]string{"KSZ040", "KSZ041"}, []string{"020177"},
+			[]*capxml.Polygon{set.Polygons["KSZ040"], set.Polygons["KSZ041"]},
+		},
+		{
+			"no UGC codes",
+			nil, []string{"020177", "020999"},
+			[]*capxml.Polygon{set.SAMEPolygons["020177"]},
+		},
+		{
+			"zone missing from the shapefile",
+			[]string{"KSZ040", "KSZ099"}, []string{"020177"},
+			[]*capxml.Polygon{set.Polygons["KSZ040"], set.SAMEPolygons["020177"]},
+		},
+		{
+			"county covered by the zones found",
+			[]string{"KSZ040", "KSZ099"}, []string{"020161", "020149"},
+			[]*capxml.Polygon{set.Polygons["KSZ040"], set.SAMEPolygons["020149"]},
+		},
+		{
+			"county repeated",
+			[]string{"KSZ099"}, []string{"020177", "020177"},
+			[]*capxml.Polygon{set.SAMEPolygons["020177"]},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			area := &capxml.Area{GeoCodes: capxml.KeyValue{}}
+			if test.ugc != nil {
+				area.GeoCodes["UGC"] = test.ugc
+			}
+			area.GeoCodes["SAME"] = test.same
+
+			got := fillPolygons(set, area)
+			if len(got) != len(test.want) {
+				t.Fatalf("fillPolygons() = %d polygons, want %d", len(got), len(test.want))
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("Polygon %d = %v, want %v", i, got[i].Coordinates, test.want[i].Coordinates)
+				}
+			}
+		})
+	}
+}
+
+func TestCovered(t *testing.T) {
+	polygons := capxml.Polygons{rectangle(-97, 39, -96, 40), rectangle(-96, 39, -95, 40)}
+
+	tests := []struct {
+		name    string
+		polygon *capxml.Polygon
+		want    bool
+	}{
+		{"inside one", rectangle(-96.9, 39.1, -96.1, 39.9), true},
+		{"across both", rectangle(-96.5, 39.1, -95.5, 39.9), true},
+		{"mostly outside", rectangle(-96.2, 39.8, -95.8, 40.6), false},
+		{"half outside", rectangle(-96, 39.5, -95, 40.5), false},
+		{"outside", rectangle(-94, 39, -93, 40), false},
+	}
+
+	for _, test := range tests {
+		if got := covered(test.polygon, polygons); got != test.want {
+			t.Errorf("covered(%s) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
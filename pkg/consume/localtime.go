@@ -0,0 +1,97 @@
+package consume
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/alerting/alerts-nws/pkg/zones"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+const (
+	// Format of the human-readable local times, ex. 9:00 PM CDT Mon May 20.
+	localTimeTextFormat = "3:04 PM MST Mon Jan 2"
+)
+
+var locations = struct {
+	sync.Mutex
+	cache map[string]*time.Location
+}{cache: make(map[string]*time.Location)}
+
+// loadLocation returns the location with the given IANA name, caching
+// locations that have already been loaded.
+func loadLocation(name string) (*time.Location, error) {
+	locations.Lock()
+	defer locations.Unlock()
+
+	if loc, ok := locations.cache[name]; ok {
+		return loc, nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.cache[name] = loc
+	return loc, nil
+}
+
+// addLocalTimes adds the effective, onset and expires times of the info,
+// in the local time of each of the time zones its areas span, to the
+// info's parameters:
+//
+//	NWS-effectiveLocal      America/Chicago=2019-05-20T21:00:00-05:00
+//	NWS-effectiveLocalText  America/Chicago=9:00 PM CDT Mon May 20
+//
+// and likewise for onset and expires. There is one value for each time
+// zone, prefixed by its IANA name, in the order the zones are listed.
+func addLocalTimes(set *zones.Set, info *capxml.Info) {
+	times := []struct {
+		name string
+		t    *capxml.Time
+	}{
+		{"effective", info.Effective},
+		{"onset", info.Onset},
+		{"expires", info.Expires},
+	}
+
+	seen := make(map[string]bool)
+	for _, area := range info.Areas {
+		for _, key := range []string{"UGC", geoCodeDerivedUGC} {
+			for _, ugc := range area.GeoCodes[key] {
+				zone, ok := set.Zones[ugc]
+				if !ok {
+					continue
+				}
+
+				for _, name := range zone.Locations() {
+					if seen[name] {
+						continue
+					}
+					seen[name] = true
+
+					loc, err := loadLocation(name)
+					if err != nil {
+						log.Printf("Unable to load time zone %s: %v", name, err)
+						continue
+					}
+
+					if info.Parameters == nil {
+						info.Parameters = make(capxml.KeyValue)
+					}
+					for _, t := range times {
+						if t.t == nil || t.t.IsZero() {
+							continue
+						}
+
+						local := t.t.In(loc)
+						key := decodedParameterPrefix + t.name + "Local"
+						info.Parameters[key] = append(info.Parameters[key], name+"="+local.Format(capxml.TimeFormat))
+						info.Parameters[key+"Text"] = append(info.Parameters[key+"Text"], name+"="+local.Format(localTimeTextFormat))
+					}
+				}
+			}
+		}
+	}
+}
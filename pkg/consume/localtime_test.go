@@ -0,0 +1,81 @@
+package consume
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alerting/alerts-nws/pkg/zones"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+func TestAddLocalTimes(t *testing.T) {
+	set := &zones.Set{
+		Zones: map[string]*zones.Zone{
+			"KSZ040": {UGC: "KSZ040", TimeZone: "C"},
+			"KSZ041": {UGC: "KSZ041", TimeZone: "C"},
+			"KSZ099": {UGC: "KSZ099", TimeZone: "MC"},
+			"GUZ001": {UGC: "GUZ001", TimeZone: "X"},
+		},
+	}
+
+	effective := time.Date(2019, 5, 21, 2, 0, 0, 0, time.UTC)
+	info := &capxml.Info{
+		Effective: &capxml.Time{Time: effective},
+		Expires:   &capxml.Time{Time: effective.Add(3 * time.Hour)},
+		Parameters: capxml.KeyValue{
+			"VTEC": {"/O.NEW.KTOP.SV.W.0001.190521T0200Z-190521T0500Z/"},
+		},
+		Areas: []*capxml.Area{
+			{GeoCodes: capxml.KeyValue{"UGC": {"KSZ040", "GUZ001", "KSZ999"}}},
+			{GeoCodes: capxml.KeyValue{"UGC": {"KSZ041"}, geoCodeDerivedUGC: {"KSZ099"}}},
+			{Description: "Without geocodes"},
+		},
+	}
+
+	addLocalTimes(set, info)
+
+	want := capxml.KeyValue{
+		"VTEC": {"/O.NEW.KTOP.SV.W.0001.190521T0200Z-190521T0500Z/"},
+		"NWS-effectiveLocal": {
+			"America/Chicago=2019-05-20T21:00:00-05:00",
+			"America/Denver=2019-05-20T20:00:00-06:00",
+		},
+		"NWS-effectiveLocalText": {
+			"America/Chicago=9:00 PM CDT Mon May 20",
+			"America/Denver=8:00 PM MDT Mon May 20",
+		},
+		"NWS-expiresLocal": {
+			"America/Chicago=2019-05-21T00:00:00-05:00",
+			"America/Denver=2019-05-20T23:00:00-06:00",
+		},
+		"NWS-expiresLocalText": {
+			"America/Chicago=12:00 AM CDT Tue May 21",
+			"America/Denver=11:00 PM MDT Mon May 20",
+		},
+	}
+	if !reflect.DeepEqual(info.Parameters, want) {
+		t.Errorf("Parameters = %v, want %v", info.Parameters, want)
+	}
+
+	// The geocodes are left as is
+	for _, area := range info.Areas {
+		for key := range area.GeoCodes {
+			if key != "UGC" && key != geoCodeDerivedUGC {
+				t.Errorf("Added geocode %s", key)
+			}
+		}
+	}
+}
+
+func TestAddLocalTimesUnknownZones(t *testing.T) {
+	info := &capxml.Info{
+		Effective: &capxml.Time{Time: time.Now()},
+		Areas:     []*capxml.Area{{GeoCodes: capxml.KeyValue{"UGC": {"KSZ040"}}}},
+	}
+
+	addLocalTimes(&zones.Set{}, info)
+	if len(info.Parameters) != 0 {
+		t.Errorf("Parameters = %v, want none", info.Parameters)
+	}
+}
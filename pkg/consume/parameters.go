@@ -0,0 +1,109 @@
+package consume
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/alerting/alerts-nws/pkg/motion"
+	"github.com/alerting/alerts-nws/pkg/parameters"
+	"github.com/alerting/alerts-nws/pkg/shorttext"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+const (
+	// Prefix of the decoded NWS parameters added to an info.
+	decodedParameterPrefix = parameters.Prefix
+
+	// Interval between the points of a projected storm path.
+	motionInterval = 5 * time.Minute
+)
+
+// first returns the first, whitespace-trimmed value for the key.
+func first(kv capxml.KeyValue, key string) string {
+	if values := kv[key]; len(values) > 0 {
+		return strings.TrimSpace(values[0])
+	}
+	return ""
+}
+
+// addParameters decodes the info's NWS-specific parameters, adding
+// the normalised values to the info's parameters.
+func addParameters(info *capxml.Info) {
+	params, errs := parameters.Decode(info.Parameters)
+	for _, err := range errs {
+		log.Println("Unable to decode parameter:", err)
+	}
+
+	if info.Parameters == nil {
+		info.Parameters = make(capxml.KeyValue)
+	}
+	for k, v := range params.KeyValue() {
+		info.Parameters[k] = v
+	}
+}
+
+// addMotion projects the storm's track, from the info's event motion
+// description, forward until the info expires. The projected paths and
+// the time of each point on the paths are added to the info's parameters.
+func addMotion(info *capxml.Info) {
+	str := first(info.Parameters, "eventMotionDescription")
+	if str == "" || info.Expires == nil {
+		return
+	}
+
+	m, err := motion.Parse(str)
+	if err != nil {
+		log.Printf("Unable to parse event motion %q: %v", str, err)
+		return
+	}
+
+	projection := m.Project(info.Expires.Time, motionInterval)
+
+	times := make([]string, len(projection.Times))
+	for i, t := range projection.Times {
+		times[i] = capxml.Time{Time: t}.FormatCAP()
+	}
+	info.Parameters[decodedParameterPrefix+"stormPathTimes"] = []string{strings.Join(times, " ")}
+
+	paths := make([]string, len(projection.Paths))
+	for i, path := range projection.Paths {
+		points := make([]string, len(path))
+		for j, p := range path {
+			points[j] = p.String()
+		}
+		paths[i] = strings.Join(points, " ")
+	}
+	info.Parameters[decodedParameterPrefix+"stormPath"] = paths
+}
+
+// addShortText adds the short texts of the info, for SMS and WEA-length
+// messages, to the info's parameters, with the expiry time in the local
+// time of the info's first zone.
+func addShortText(info *capxml.Info, renderer *shorttext.Renderer) {
+	var loc *time.Location
+	for _, area := range info.Areas {
+		for _, name := range area.GeoCodes[geoCodeZoneTimeZone] {
+			if name == "" {
+				continue
+			}
+
+			var err error
+			if loc, err = loadLocation(name); err != nil {
+				log.Printf("Unable to load time zone %s: %v", name, err)
+			}
+			break
+		}
+		if loc != nil {
+			break
+		}
+	}
+
+	if info.Parameters == nil {
+		info.Parameters = make(capxml.KeyValue)
+	}
+	for _, length := range []int{shorttext.LengthShort, shorttext.LengthSMS, shorttext.LengthLong} {
+		info.Parameters[fmt.Sprintf("%stext%d", decodedParameterPrefix, length)] = []string{renderer.Render(info, loc, length)}
+	}
+}
@@ -0,0 +1,230 @@
+package consume
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+	"github.com/lovoo/goka"
+)
+
+// How often to check for pending alerts that have timed out.
+const pendingSweepInterval = time.Minute
+
+// A pendingAlert is an alert waiting for the alerts it references.
+type pendingAlert struct {
+	Alert    *capxml.Alert `json:"alert"`
+	Deadline time.Time     `json:"deadline"`
+
+	// Key of the alert in the input topic.
+	Key string `json:"key"`
+}
+
+// key returns the key of the alert in the input topic. Alerts held
+// before the key was kept use their ID.
+func (p *pendingAlert) key() string {
+	if p.Key == "" {
+		return p.Alert.ID()
+	}
+	return p.Key
+}
+
+// pendingAlerts are the alerts waiting on a single referenced alert.
+// The group table is keyed by the ID of the referenced alert.
+type pendingAlerts struct {
+	Alerts []*pendingAlert `json:"alerts"`
+}
+
+// A pendingMessage is a loopback message, keyed by the ID of the
+// referenced alert.
+type pendingMessage struct {
+	// Alert to park until the referenced alert is stored.
+	Park *pendingAlert `json:"park,omitempty"`
+
+	// The referenced alert has been stored; release the pending alerts.
+	Release bool `json:"release,omitempty"`
+
+	// Release the pending alerts that have timed out.
+	Expire bool `json:"expire,omitempty"`
+}
+
+type pendingMessageCodec struct{}
+
+func (c *pendingMessageCodec) Encode(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case *pendingMessage:
+		return json.Marshal(v)
+	default:
+		return nil, errors.New("Unknown type provided")
+	}
+}
+
+func (c *pendingMessageCodec) Decode(data []byte) (interface{}, error) {
+	var msg pendingMessage
+	err := json.Unmarshal(data, &msg)
+	return &msg, err
+}
+
+type pendingAlertsCodec struct{}
+
+func (c *pendingAlertsCodec) Encode(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case *pendingAlerts:
+		return json.Marshal(v)
+	default:
+		return nil, errors.New("Unknown type provided")
+	}
+}
+
+func (c *pendingAlertsCodec) Decode(data []byte) (interface{}, error) {
+	var pending pendingAlerts
+	err := json.Unmarshal(data, &pending)
+	return &pending, err
+}
+
+// park holds the alert, with the key it was received with, until the
+// referenced alert is stored, or the deadline passes.
+func park(gctx goka.Context, key string, alert *capxml.Alert, ref string, deadline time.Time) {
+	log.Printf("Holding %s until %s is stored (or %v)", alert.ID(), ref, deadline)
+	gctx.Loopback(ref, &pendingMessage{
+		Park: &pendingAlert{
+			Alert:    alert,
+			Deadline: deadline,
+			Key:      key,
+		},
+	})
+}
+
+// collectPending handles the loopback messages for pending alerts.
+func collectPending(ctx context.Context, conf *Config) func(ctx goka.Context, msg interface{}) {
+	return func(gctx goka.Context, msg interface{}) {
+		pmsg := msg.(*pendingMessage)
+
+		pending, _ := gctx.Value().(*pendingAlerts)
+		if pending == nil {
+			pending = new(pendingAlerts)
+		}
+
+		if pmsg.Park != nil {
+			pending.Alerts = append(pending.Alerts, pmsg.Park)
+			gctx.SetValue(pending)
+
+			// The referenced alert may have been stored since it was checked
+			missing := checkReferences(ctx, gctx, conf, pmsg.Park.Alert)
+			for _, ref := range missing {
+				if ref == gctx.Key() {
+					return
+				}
+			}
+			pmsg.Release = true
+		}
+
+		now := time.Now()
+		var release, keep []*pendingAlert
+		for _, p := range pending.Alerts {
+			if pmsg.Release || now.After(p.Deadline) {
+				release = append(release, p)
+			} else {
+				keep = append(keep, p)
+			}
+		}
+
+		if len(release) == 0 {
+			return
+		}
+
+		if len(keep) == 0 {
+			gctx.Delete()
+		} else {
+			gctx.SetValue(&pendingAlerts{Alerts: keep})
+		}
+
+		// Release in the order the alerts were sent
+		sort.SliceStable(release, func(i, j int) bool {
+			return release[i].Alert.Sent.Before(release[j].Alert.Sent.Time)
+		})
+
+		for _, p := range release {
+			// Wait for any other references that are still missing
+			if now.Before(p.Deadline) {
+				if missing := checkReferences(ctx, gctx, conf, p.Alert); len(missing) > 0 {
+					park(gctx, p.key(), p.Alert, missing[0], p.Deadline)
+					continue
+				}
+			} else {
+				log.Printf("Timed out waiting for references of %s", p.Alert.ID())
+			}
+
+			log.Printf("Releasing %s", p.Alert.ID())
+			process(ctx, gctx, conf, p.key(), p.Alert)
+		}
+	}
+}
+
+// release requests the alerts waiting on the alert to be released.
+// The request is always sent, as alerts may have been parked on the
+// alert moments ago; there is nothing to do if none are waiting.
+func release(gctx goka.Context, conf *Config, id string) {
+	if conf.PendingTimeout <= 0 {
+		return
+	}
+	gctx.Loopback(id, &pendingMessage{Release: true})
+}
+
+// sweepPending periodically requests the pending alerts that have timed
+// out to be released. The pending alerts are found through the view of the
+// group table, and released through the group's loopback topic.
+func sweepPending(ctx context.Context, conf *Config) error {
+	// The loopback topic is <group>-loop
+	emitter, err := goka.NewEmitter(conf.Brokers, goka.Stream(conf.Group+"-loop"), new(pendingMessageCodec))
+	if err != nil {
+		return err
+	}
+	defer emitter.Finish()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pendingSweepInterval):
+		}
+
+		if !conf.pending.Recovered() {
+			continue
+		}
+
+		it, err := conf.pending.Iterator()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for it.Next() {
+			value, err := it.Value()
+			if err != nil {
+				log.Println("Unable to read pending alerts:", err)
+				continue
+			}
+
+			pending, ok := value.(*pendingAlerts)
+			if !ok {
+				continue
+			}
+
+			for _, p := range pending.Alerts {
+				if now.After(p.Deadline) {
+					if _, err := emitter.Emit(it.Key(), &pendingMessage{Expire: true}); err != nil {
+						it.Release()
+						return err
+					}
+					break
+				}
+			}
+		}
+		it.Release()
+	}
+}
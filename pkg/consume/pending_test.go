@@ -0,0 +1,173 @@
+package consume
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alerting/alerts-nws/pkg/zones"
+	"github.com/alerting/alerts/pkg/alerts"
+	"github.com/alerting/alerts/pkg/cap"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+	protobuf "github.com/alerting/alerts/pkg/protobuf"
+	"github.com/lovoo/goka"
+	"google.golang.org/grpc"
+)
+
+// testService is an alerts service storing the IDs of the alerts added.
+type testService struct {
+	stored map[string]bool
+}
+
+func (s *testService) Add(ctx context.Context, in *cap.Alert, opts ...grpc.CallOption) (*cap.Alert, error) {
+	s.stored[in.ID()] = true
+	return in, nil
+}
+
+func (s *testService) Get(ctx context.Context, in *cap.Reference, opts ...grpc.CallOption) (*cap.Alert, error) {
+	return nil, nil
+}
+
+func (s *testService) Has(ctx context.Context, in *cap.Reference, opts ...grpc.CallOption) (*protobuf.BooleanResult, error) {
+	return &protobuf.BooleanResult{Result: s.stored[in.ID()]}, nil
+}
+
+func (s *testService) Find(ctx context.Context, in *alerts.FindCriteria, opts ...grpc.CallOption) (*alerts.FindResult, error) {
+	return nil, nil
+}
+
+// A testMessage is a message emitted or looped back.
+type testMessage struct {
+	topic goka.Stream
+	key   string
+	value interface{}
+}
+
+// testContext is a goka.Context for a single message, backed by a table.
+// The messages emitted and looped back are recorded.
+type testContext struct {
+	table    map[string]interface{}
+	key      string
+	emitted  *[]testMessage
+	loopback *[]testMessage
+}
+
+func (c *testContext) Topic() goka.Stream                              { return "" }
+func (c *testContext) Key() string                                     { return c.key }
+func (c *testContext) Partition() int32                                { return 0 }
+func (c *testContext) Offset() int64                                   { return 0 }
+func (c *testContext) Value() interface{}                              { return c.table[c.key] }
+func (c *testContext) SetValue(value interface{})                      { c.table[c.key] = value }
+func (c *testContext) Delete()                                         { delete(c.table, c.key) }
+func (c *testContext) Timestamp() time.Time                            { return time.Time{} }
+func (c *testContext) Join(topic goka.Table) interface{}               { return nil }
+func (c *testContext) Lookup(topic goka.Table, key string) interface{} { return nil }
+func (c *testContext) Fail(err error)                                  { panic(err) }
+func (c *testContext) Context() context.Context                        { return context.Background() }
+func (c *testContext) Loopback(key string, value interface{}) {
+	*c.loopback = append(*c.loopback, testMessage{"", key, value})
+}
+func (c *testContext) Emit(topic goka.Stream, key string, value interface{}) {
+	*c.emitted = append(*c.emitted, testMessage{topic, key, value})
+}
+
+func TestPending(t *testing.T) {
+	service := &testService{stored: make(map[string]bool)}
+	conf := &Config{
+		FetchTopic:     "fetch",
+		RetryTopic:     "retry",
+		PendingTimeout: 10 * time.Minute,
+		Zones:          new(zones.Store),
+		Policy:         DefaultPolicy(),
+		AlertsService:  service,
+	}
+
+	warning := capxml.Alert{
+		Identifier:  "warning",
+		Sender:      "w-nws.webmaster@noaa.gov",
+		Sent:        capxml.Time{Time: time.Date(2019, 5, 28, 21, 30, 0, 0, time.UTC)},
+		Status:      capxml.StatusActual,
+		MessageType: capxml.MessageTypeAlert,
+		Scope:       capxml.ScopePublic,
+	}
+	update := warning
+	update.Identifier = "update"
+	update.Sent.Time = update.Sent.Add(15 * time.Minute)
+	update.MessageType = capxml.MessageTypeUpdate
+	update.References = capxml.References{{Sender: warning.Sender, Identifier: warning.Identifier, Sent: warning.Sent}}
+
+	table := make(map[string]interface{})
+	var emitted, loopback []testMessage
+	input := func(key string, alert capxml.Alert) {
+		collect(context.Background(), conf)(&testContext{table: table, key: key, emitted: &emitted, loopback: &loopback}, alert)
+	}
+	loop := func() {
+		for len(loopback) > 0 {
+			msg := loopback[0]
+			loopback = loopback[1:]
+			collectPending(context.Background(), conf)(&testContext{table: table, key: msg.key, emitted: &emitted, loopback: &loopback}, msg.value)
+		}
+	}
+	retried := func() []string {
+		var keys []string
+		for _, msg := range emitted {
+			if msg.topic == "retry" {
+				keys = append(keys, msg.key)
+			}
+		}
+		return keys
+	}
+
+	// The update is held until the warning is stored
+	input("update-key", update)
+	loop()
+	if len(retried()) != 0 {
+		t.Fatalf("Processed %q before the warning", retried())
+	}
+	if pending, _ := table[warning.ID()].(*pendingAlerts); pending == nil || len(pending.Alerts) != 1 || pending.Alerts[0].Key != "update-key" {
+		t.Fatalf("Pending alerts = %+v", table[warning.ID()])
+	}
+	for _, msg := range emitted {
+		if msg.topic != "fetch" || msg.key != warning.ID() {
+			t.Errorf("Emitted %+v, want the warning to be fetched", msg)
+		}
+	}
+
+	// Once stored, the warning releases the update, which is
+	// retried with the key it was received with
+	input("warning-key", warning)
+	loop()
+	if got := retried(); len(got) != 2 || got[0] != "warning-key" || got[1] != "update-key" {
+		t.Errorf("Retried %q, want warning-key then update-key", got)
+	}
+	if !service.stored[update.ID()] {
+		t.Error("Update was not stored")
+	}
+	if len(table) != 0 {
+		t.Errorf("Pending alerts remain: %+v", table)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	var emitted, loopback []testMessage
+	gctx := &testContext{table: make(map[string]interface{}), emitted: &emitted, loopback: &loopback}
+
+	// A release is always requested, without a view of the pending alerts
+	release(gctx, &Config{PendingTimeout: time.Minute}, "id")
+	if len(loopback) != 1 || loopback[0].key != "id" || !loopback[0].value.(*pendingMessage).Release {
+		t.Errorf("Looped back %+v, want a release of id", loopback)
+	}
+
+	// Nothing is held without a timeout
+	loopback = nil
+	release(gctx, new(Config), "id")
+	if len(loopback) != 0 {
+		t.Errorf("Looped back %+v without a pending timeout", loopback)
+	}
+
+	// A release without pending alerts does nothing
+	collectPending(context.Background(), new(Config))(gctx, &pendingMessage{Release: true})
+	if len(gctx.table) != 0 || len(emitted) != 0 {
+		t.Errorf("Released nothing into %+v, %+v", gctx.table, emitted)
+	}
+}
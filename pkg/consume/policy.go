@@ -0,0 +1,178 @@
+package consume
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/alerting/alerts/pkg/cap"
+)
+
+// An Action is what to do with an alert.
+type Action string
+
+const (
+	// ActionStore stores the alert.
+	ActionStore Action = "store"
+
+	// ActionRoute sends the alert to the policy's route topic, without storing it.
+	ActionRoute Action = "route"
+
+	// ActionDrop drops the alert.
+	ActionDrop Action = "drop"
+)
+
+// A Policy decides, by status and message type, what to do with an alert.
+// If either the status or message type drops the alert, it is dropped.
+// Otherwise, if either routes the alert, it is routed.
+type Policy struct {
+	Statuses     map[cap.Alert_Status]Action
+	MessageTypes map[cap.Alert_MessageType]Action
+
+	// Topic for routed alerts.
+	RouteTopic string
+
+	mutex sync.Mutex
+	drops map[string]int
+}
+
+// DefaultPolicy returns the default policy, storing actual, exercise and
+// test alerts, updates and cancellations, and dropping everything else.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Statuses: map[cap.Alert_Status]Action{
+			cap.Alert_ACTUAL:    ActionStore,
+			cap.Alert_EXCERCISE: ActionStore,
+			cap.Alert_TEST:      ActionStore,
+		},
+		MessageTypes: map[cap.Alert_MessageType]Action{
+			cap.Alert_ALERT:  ActionStore,
+			cap.Alert_UPDATE: ActionStore,
+			cap.Alert_CANCEL: ActionStore,
+		},
+	}
+}
+
+// parseAction parses an action name.
+func parseAction(str string) (Action, error) {
+	switch action := Action(strings.ToLower(str)); action {
+	case ActionStore, ActionRoute, ActionDrop:
+		return action, nil
+	}
+	return "", fmt.Errorf("Unknown action: %s", str)
+}
+
+// parseStatus parses a status name. The CAP protobuf misspells
+// exercise (EXCERCISE), so both spellings are accepted.
+func parseStatus(name string) (cap.Alert_Status, error) {
+	name = strings.ToUpper(name)
+	if name == "EXERCISE" {
+		return cap.Alert_EXCERCISE, nil
+	}
+
+	status, ok := cap.Alert_Status_value[name]
+	if !ok {
+		return 0, fmt.Errorf("Unknown status: %s", name)
+	}
+	return cap.Alert_Status(status), nil
+}
+
+// SetStatuses sets the actions for the statuses, keyed by status name (ex. test=drop).
+func (policy *Policy) SetStatuses(actions map[string]string) error {
+	for name, value := range actions {
+		status, err := parseStatus(name)
+		if err != nil {
+			return err
+		}
+
+		action, err := parseAction(value)
+		if err != nil {
+			return err
+		}
+		policy.Statuses[status] = action
+	}
+	return nil
+}
+
+// SetMessageTypes sets the actions for the message types, keyed by message type name (ex. ack=route).
+func (policy *Policy) SetMessageTypes(actions map[string]string) error {
+	for name, value := range actions {
+		messageType, ok := cap.Alert_MessageType_value[strings.ToUpper(name)]
+		if !ok {
+			return fmt.Errorf("Unknown message type: %s", name)
+		}
+
+		action, err := parseAction(value)
+		if err != nil {
+			return err
+		}
+		policy.MessageTypes[cap.Alert_MessageType(messageType)] = action
+	}
+	return nil
+}
+
+// Validate returns an error if the policy routes alerts,
+// but has no route topic.
+func (policy *Policy) Validate() error {
+	if policy.RouteTopic != "" {
+		return nil
+	}
+
+	for status, action := range policy.Statuses {
+		if action == ActionRoute {
+			return fmt.Errorf("Status %s is routed, but there is no route topic", status)
+		}
+	}
+	for messageType, action := range policy.MessageTypes {
+		if action == ActionRoute {
+			return fmt.Errorf("Message type %s is routed, but there is no route topic", messageType)
+		}
+	}
+	return nil
+}
+
+// Decide returns what to do with the alert. Statuses and message types
+// without an action are dropped. Alerts are also dropped if they would
+// be routed, but there is no route topic.
+func (policy *Policy) Decide(alert *cap.Alert) Action {
+	statusAction, ok := policy.Statuses[alert.Status]
+	if !ok {
+		statusAction = ActionDrop
+	}
+
+	messageTypeAction, ok := policy.MessageTypes[alert.MessageType]
+	if !ok {
+		messageTypeAction = ActionDrop
+	}
+
+	action := ActionStore
+	if statusAction == ActionDrop || messageTypeAction == ActionDrop {
+		action = ActionDrop
+	} else if statusAction == ActionRoute || messageTypeAction == ActionRoute {
+		action = ActionRoute
+		if policy.RouteTopic == "" {
+			action = ActionDrop
+		}
+	}
+
+	if action == ActionDrop {
+		policy.logDrop(alert)
+	}
+	return action
+}
+
+// logDrop logs the dropped alert, along with the number
+// of alerts with the same status and message type dropped.
+func (policy *Policy) logDrop(alert *cap.Alert) {
+	policy.mutex.Lock()
+	defer policy.mutex.Unlock()
+
+	if policy.drops == nil {
+		policy.drops = make(map[string]int)
+	}
+
+	key := alert.Status.String() + "/" + alert.MessageType.String()
+	policy.drops[key]++
+	log.Printf("Dropping %s alert %s (%d dropped)", key, alert.ID(), policy.drops[key])
+}
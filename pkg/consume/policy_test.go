@@ -0,0 +1,116 @@
+package consume
+
+import (
+	"testing"
+
+	"github.com/alerting/alerts/pkg/cap"
+)
+
+func TestSetStatuses(t *testing.T) {
+	policy := DefaultPolicy()
+	err := policy.SetStatuses(map[string]string{
+		"exercise": "route",
+		"Test":     "drop",
+		"system":   "STORE",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[cap.Alert_Status]Action{
+		cap.Alert_ACTUAL:    ActionStore,
+		cap.Alert_EXCERCISE: ActionRoute,
+		cap.Alert_TEST:      ActionDrop,
+		cap.Alert_SYSTEM:    ActionStore,
+	}
+	for status, action := range want {
+		if got := policy.Statuses[status]; got != action {
+			t.Errorf("Statuses[%s] = %s, want %s", status, got, action)
+		}
+	}
+
+	// The proto's spelling is accepted too
+	if err := policy.SetStatuses(map[string]string{"excercise": "drop"}); err != nil {
+		t.Error(err)
+	} else if got := policy.Statuses[cap.Alert_EXCERCISE]; got != ActionDrop {
+		t.Errorf("Statuses[EXCERCISE] = %s, want drop", got)
+	}
+
+	for _, actions := range []map[string]string{
+		{"practice": "drop"},
+		{"test": "ignore"},
+	} {
+		if err := DefaultPolicy().SetStatuses(actions); err == nil {
+			t.Errorf("SetStatuses(%v) did not fail", actions)
+		}
+	}
+}
+
+func TestSetMessageTypes(t *testing.T) {
+	policy := DefaultPolicy()
+	if err := policy.SetMessageTypes(map[string]string{"cancel": "drop", "ack": "store"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := policy.MessageTypes[cap.Alert_CANCEL]; got != ActionDrop {
+		t.Errorf("MessageTypes[CANCEL] = %s, want drop", got)
+	}
+	if got := policy.MessageTypes[cap.Alert_ACK]; got != ActionStore {
+		t.Errorf("MessageTypes[ACK] = %s, want store", got)
+	}
+
+	if err := policy.SetMessageTypes(map[string]string{"notice": "drop"}); err == nil {
+		t.Error("SetMessageTypes() of an unknown message type did not fail")
+	}
+}
+
+func TestDecide(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.Statuses[cap.Alert_EXCERCISE] = ActionRoute
+	policy.MessageTypes[cap.Alert_CANCEL] = ActionDrop
+
+	tests := []struct {
+		status      cap.Alert_Status
+		messageType cap.Alert_MessageType
+		topic       string
+		want        Action
+	}{
+		{cap.Alert_ACTUAL, cap.Alert_ALERT, "", ActionStore},
+		{cap.Alert_ACTUAL, cap.Alert_UPDATE, "", ActionStore},
+		{cap.Alert_ACTUAL, cap.Alert_CANCEL, "", ActionDrop},
+		{cap.Alert_DRAFT, cap.Alert_ALERT, "", ActionDrop},
+		{cap.Alert_ACTUAL, cap.Alert_ACK, "", ActionDrop},
+		{cap.Alert_EXCERCISE, cap.Alert_ALERT, "routed", ActionRoute},
+		{cap.Alert_EXCERCISE, cap.Alert_CANCEL, "routed", ActionDrop},
+		{cap.Alert_EXCERCISE, cap.Alert_ALERT, "", ActionDrop},
+	}
+
+	for _, test := range tests {
+		policy.RouteTopic = test.topic
+		alert := &cap.Alert{Identifier: "test", Status: test.status, MessageType: test.messageType}
+		if got := policy.Decide(alert); got != test.want {
+			t.Errorf("Decide(%s %s, topic %q) = %s, want %s", test.status, test.messageType, test.topic, got, test.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	policy := DefaultPolicy()
+	if err := policy.Validate(); err != nil {
+		t.Errorf("Validate() of the default policy = %v", err)
+	}
+
+	policy.Statuses[cap.Alert_TEST] = ActionRoute
+	if err := policy.Validate(); err == nil {
+		t.Error("Validate() of a routed status without a topic did not fail")
+	}
+	policy.RouteTopic = "routed"
+	if err := policy.Validate(); err != nil {
+		t.Errorf("Validate() with a topic = %v", err)
+	}
+
+	policy = DefaultPolicy()
+	policy.MessageTypes[cap.Alert_UPDATE] = ActionRoute
+	if err := policy.Validate(); err == nil {
+		t.Error("Validate() of a routed message type without a topic did not fail")
+	}
+}
@@ -0,0 +1,137 @@
+package consume
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/alerting/alerts-nws/pkg/events"
+	"github.com/alerting/alerts-nws/pkg/gauges"
+	"github.com/alerting/alerts-nws/pkg/vtec"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+	"github.com/lovoo/goka"
+)
+
+// addVTEC decodes the info's P-VTEC strings, adding the decoded values,
+// and the keys of their events, to the info's parameters. Values are added
+// in the same order as the P-VTEC strings.
+func addVTEC(info *capxml.Info, sent time.Time, lookup events.Lookup) {
+	for _, str := range info.Parameters["VTEC"] {
+		pvtecs, err := vtec.ParseAllPVTEC(str)
+		if err != nil {
+			log.Printf("Unable to parse VTEC %q: %v", str, err)
+			continue
+		}
+
+		for _, pvtec := range pvtecs {
+			add := func(key, value string) {
+				info.Parameters["VTEC-"+key] = append(info.Parameters["VTEC-"+key], value)
+			}
+
+			add("productClass", string(pvtec.ProductClass))
+			add("action", string(pvtec.Action))
+			add("office", pvtec.Office)
+			add("phenomena", pvtec.Phenomena)
+			add("significance", pvtec.Significance)
+			add("eventTrackingNumber", strconv.Itoa(pvtec.EventTrackingNumber))
+			add("begin", formatVTECTime(pvtec.Begin))
+			add("end", formatVTECTime(pvtec.End))
+			add("key", events.Resolve(pvtec, sent, lookup))
+		}
+	}
+}
+
+// addHVTEC decodes the info's H-VTEC strings, adding the decoded values
+// to the info's parameters. If the gauge is known, its location and river
+// name are also added; there is one value for each H-VTEC string.
+func addHVTEC(info *capxml.Info, gauges map[string]*gauges.Gauge) {
+	for _, str := range info.Parameters["VTEC"] {
+		hvtecs, err := vtec.ParseAllHVTEC(str)
+		if err != nil {
+			log.Printf("Unable to parse H-VTEC %q: %v", str, err)
+			continue
+		}
+
+		for _, hvtec := range hvtecs {
+			add := func(key, value string) {
+				info.Parameters["HVTEC-"+key] = append(info.Parameters["HVTEC-"+key], value)
+			}
+
+			add("nwsli", hvtec.NWSLI)
+			add("floodSeverity", hvtec.FloodSeverity.String())
+			add("immediateCause", hvtec.ImmediateCause.String())
+			add("begin", formatVTECTime(hvtec.Begin))
+			add("crest", formatVTECTime(hvtec.Crest))
+			add("end", formatVTECTime(hvtec.End))
+			add("floodRecord", string(hvtec.FloodRecord))
+
+			// The gauge values stay aligned with the NWSLIs: they are
+			// left empty if the flood is not at a gauge, or the gauge is
+			// unknown.
+			point, river := "", ""
+			if hvtec.HasGauge() {
+				if gauge, ok := gauges[hvtec.NWSLI]; ok {
+					point = fmt.Sprintf("%s,%s",
+						strconv.FormatFloat(gauge.Lat, 'f', -1, 64),
+						strconv.FormatFloat(gauge.Lon, 'f', -1, 64))
+					river = gauge.River
+				} else {
+					log.Printf("Cannot find gauge %s", hvtec.NWSLI)
+				}
+			}
+
+			add("gaugePoint", point)
+			add("gaugeRiver", river)
+		}
+	}
+}
+
+// emitEventUpdates emits an update for each of the alert's P-VTEC strings
+// to the events topic, keyed by the event key.
+func emitEventUpdates(gctx goka.Context, conf *Config, alert *capxml.Alert) {
+	for _, info := range alert.Infos {
+		var ugcs []string
+		for _, area := range info.Areas {
+			ugcs = append(ugcs, area.GeoCodes["UGC"]...)
+		}
+
+		pvtecs, keys := events.Keys(alert, info)
+		for i, pvtec := range pvtecs {
+			update := &events.Update{
+				Key:     keys[i],
+				Action:  pvtec.Action,
+				AlertID: alert.ID(),
+				UGCs:    ugcs,
+				Sent:    alert.Sent.Time,
+			}
+			gctx.Emit(goka.Stream(conf.EventsTopic), update.Key, update)
+		}
+	}
+}
+
+// formatVTECTime formats the time to CAP standards, returning
+// an empty string for undefined times.
+func formatVTECTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return capxml.Time{Time: t}.FormatCAP()
+}
+
+// eventLookup returns a lookup of the events in the event table.
+func eventLookup(gctx goka.Context, conf *Config) events.Lookup {
+	if conf.EventsTopic == "" {
+		return nil
+	}
+
+	return func(key string) *events.Event {
+		event, _ := gctx.Lookup(eventsTable(conf), key).(*events.Event)
+		return event
+	}
+}
+
+// eventsTable returns the event table kept by the <Group>-events group.
+func eventsTable(conf *Config) goka.Table {
+	return goka.GroupTable(goka.Group(conf.Group + "-events"))
+}
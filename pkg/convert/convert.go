@@ -0,0 +1,208 @@
+package convert
+
+import (
+	"encoding/base64"
+
+	"github.com/alerting/alerts/pkg/cap"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+	"github.com/golang/protobuf/ptypes"
+	_struct "github.com/golang/protobuf/ptypes/struct"
+	"github.com/golang/protobuf/ptypes/timestamp"
+)
+
+// Alert converts a capxml.Alert to a cap.Alert.
+// The capxml enum values match the cap enum values, so they are converted directly.
+func Alert(xmlAlert *capxml.Alert) (*cap.Alert, error) {
+	sent, err := ptypes.TimestampProto(xmlAlert.Sent.Time)
+	if err != nil {
+		return nil, err
+	}
+
+	alert := &cap.Alert{
+		Identifier:  xmlAlert.Identifier,
+		Sender:      xmlAlert.Sender,
+		Sent:        sent,
+		Status:      cap.Alert_Status(xmlAlert.Status),
+		MessageType: cap.Alert_MessageType(xmlAlert.MessageType),
+		Source:      xmlAlert.Source,
+		Scope:       cap.Alert_Scope(xmlAlert.Scope),
+		Restriction: xmlAlert.Restriction,
+		Addresses:   xmlAlert.Addresses,
+		Code:        xmlAlert.Codes,
+		Note:        xmlAlert.Note,
+		Incidents:   xmlAlert.Incidents,
+		Superseded:  xmlAlert.Superseded,
+	}
+
+	for _, xmlReference := range xmlAlert.References {
+		sent, err := ptypes.TimestampProto(xmlReference.Sent.Time)
+		if err != nil {
+			return nil, err
+		}
+
+		alert.References = append(alert.References, &cap.Reference{
+			Id:         xmlReference.ID(),
+			Identifier: xmlReference.Identifier,
+			Sender:     xmlReference.Sender,
+			Sent:       sent,
+		})
+	}
+
+	for _, xmlInfo := range xmlAlert.Infos {
+		info, err := Info(xmlInfo)
+		if err != nil {
+			return nil, err
+		}
+		alert.Infos = append(alert.Infos, info)
+	}
+
+	return alert, nil
+}
+
+// Info converts a capxml.Info to a cap.Info.
+func Info(xmlInfo *capxml.Info) (*cap.Info, error) {
+	info := &cap.Info{
+		Language:    xmlInfo.Language,
+		Event:       xmlInfo.Event,
+		Urgency:     cap.Info_Urgency(xmlInfo.Urgency),
+		Severity:    cap.Info_Severity(xmlInfo.Severity),
+		Certainty:   cap.Info_Certainty(xmlInfo.Certainty),
+		Audience:    xmlInfo.Audience,
+		EventCodes:  KeyValue(xmlInfo.EventCodes),
+		SenderName:  xmlInfo.SenderName,
+		Headline:    xmlInfo.Headline,
+		Description: xmlInfo.Description,
+		Instruction: xmlInfo.Instruction,
+		Web:         xmlInfo.Web,
+		Contact:     xmlInfo.Contact,
+		Parameters:  KeyValue(xmlInfo.Parameters),
+	}
+
+	for _, category := range xmlInfo.Categories {
+		info.Categories = append(info.Categories, cap.Info_Category(category))
+	}
+
+	for _, responseType := range xmlInfo.ResponseTypes {
+		info.ResponseTypes = append(info.ResponseTypes, cap.Info_ResponseType(responseType))
+	}
+
+	var err error
+	if info.Effective, err = Time(xmlInfo.Effective); err != nil {
+		return nil, err
+	}
+	if info.Onset, err = Time(xmlInfo.Onset); err != nil {
+		return nil, err
+	}
+	if info.Expires, err = Time(xmlInfo.Expires); err != nil {
+		return nil, err
+	}
+
+	for _, xmlResource := range xmlInfo.Resources {
+		resource, err := Resource(xmlResource)
+		if err != nil {
+			return nil, err
+		}
+		info.Resources = append(info.Resources, resource)
+	}
+
+	for _, xmlArea := range xmlInfo.Areas {
+		info.Areas = append(info.Areas, Area(xmlArea))
+	}
+
+	return info, nil
+}
+
+// Resource converts a capxml.Resource to a cap.Resource.
+// The DerefURI is base64 decoded.
+func Resource(xmlResource *capxml.Resource) (*cap.Resource, error) {
+	resource := &cap.Resource{
+		Description: xmlResource.Description,
+		MimeType:    xmlResource.MimeType,
+		Size:        int64(xmlResource.Size),
+		Uri:         xmlResource.URI,
+		Digest:      xmlResource.Digest,
+	}
+
+	if xmlResource.DerefURI != "" {
+		derefURI, err := base64.StdEncoding.DecodeString(xmlResource.DerefURI)
+		if err != nil {
+			return nil, err
+		}
+		resource.DerefUri = derefURI
+	}
+
+	return resource, nil
+}
+
+// Area converts a capxml.Area to a cap.Area.
+func Area(xmlArea *capxml.Area) *cap.Area {
+	area := &cap.Area{
+		Description: xmlArea.Description,
+		Geocodes:    KeyValue(xmlArea.GeoCodes),
+		Altitude:    float64(xmlArea.Altitude),
+		Ceiling:     float64(xmlArea.Ceiling),
+	}
+
+	for _, xmlPolygon := range xmlArea.Polygons {
+		polygon := &cap.Area_Polygon{
+			Type: xmlPolygon.Type,
+		}
+
+		for _, ring := range xmlPolygon.Coordinates {
+			points := make([]*_struct.Value, len(ring))
+			for i, point := range ring {
+				points[i] = listValue(numbers(point))
+			}
+			polygon.Coordinates = append(polygon.Coordinates, &_struct.ListValue{Values: points})
+		}
+
+		area.Polygons = append(area.Polygons, polygon)
+	}
+
+	for _, xmlCircle := range xmlArea.Circles {
+		area.Circles = append(area.Circles, &cap.Area_Circle{
+			Type:        xmlCircle.Type,
+			Coordinates: xmlCircle.Coordinates,
+			Radius:      xmlCircle.Radius,
+		})
+	}
+
+	return area
+}
+
+// Time converts a capxml.Time to a timestamp, returning nil if the time is nil.
+func Time(t *capxml.Time) (*timestamp.Timestamp, error) {
+	if t == nil {
+		return nil, nil
+	}
+	return ptypes.TimestampProto(t.Time)
+}
+
+// KeyValue converts a capxml.KeyValue to a map of string lists.
+func KeyValue(kv capxml.KeyValue) map[string]*_struct.ListValue {
+	if kv == nil {
+		return nil
+	}
+
+	m := make(map[string]*_struct.ListValue, len(kv))
+	for k, vs := range kv {
+		values := make([]*_struct.Value, len(vs))
+		for i, v := range vs {
+			values[i] = &_struct.Value{Kind: &_struct.Value_StringValue{StringValue: v}}
+		}
+		m[k] = &_struct.ListValue{Values: values}
+	}
+	return m
+}
+
+func numbers(ns []float64) []*_struct.Value {
+	values := make([]*_struct.Value, len(ns))
+	for i, n := range ns {
+		values[i] = &_struct.Value{Kind: &_struct.Value_NumberValue{NumberValue: n}}
+	}
+	return values
+}
+
+func listValue(values []*_struct.Value) *_struct.Value {
+	return &_struct.Value{Kind: &_struct.Value_ListValue{ListValue: &_struct.ListValue{Values: values}}}
+}
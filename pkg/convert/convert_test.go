@@ -0,0 +1,370 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alerting/alerts/pkg/cap"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	_struct "github.com/golang/protobuf/ptypes/struct"
+	"github.com/golang/protobuf/ptypes/timestamp"
+)
+
+func capTime(str string) *capxml.Time {
+	t, err := time.Parse(time.RFC3339, str)
+	if err != nil {
+		panic(err)
+	}
+	return &capxml.Time{Time: t}
+}
+
+// testAlert returns an alert using every field.
+func testAlert() *capxml.Alert {
+	return &capxml.Alert{
+		Identifier:  "NOAA-NWS-ALERTS-KS125F3A8C7F44.SevereThunderstormWarning.125F3A8C8A4CKS.TOPSVSTOP.6a4b4d1cd1d5d4e3f0f8c4a0b4f1a7c2",
+		Sender:      "w-nws.webmaster@noaa.gov",
+		Sent:        *capTime("2019-05-28T16:45:00-05:00"),
+		Status:      capxml.StatusActual,
+		MessageType: capxml.MessageTypeUpdate,
+		Source:      "TOP",
+		Scope:       capxml.ScopePublic,
+		Restriction: "none",
+		Addresses:   capxml.List{"a b", "c"},
+		Codes:       []string{"IPAWSv1.0"},
+		Note:        "Test note",
+		References: capxml.References{
+			{
+				Sender:     "w-nws.webmaster@noaa.gov",
+				Identifier: "NOAA-NWS-ALERTS-KS125F3A8C7F44.SevereThunderstormWarning.125F3A8C7F44KS.TOPSVRTOP.2c7d1d1cbd1f5b7a1f36f5a5e1a1e1bd",
+				Sent:       *capTime("2019-05-28T16:30:00-05:00"),
+			},
+		},
+		Incidents: capxml.List{"incident"},
+		Infos: []*capxml.Info{
+			{
+				Language:      "en-US",
+				Categories:    []capxml.Category{capxml.CategoryMeteorological, capxml.CategorySafety},
+				Event:         "Severe Thunderstorm Warning",
+				ResponseTypes: []capxml.ResponseType{capxml.ResponseTypeShelter, capxml.ResponseTypeMonitor},
+				Urgency:       capxml.UrgencyImmediate,
+				Severity:      capxml.SeveritySevere,
+				Certainty:     capxml.CertaintyObserved,
+				Audience:      "public",
+				EventCodes: capxml.KeyValue{
+					"SAME": {"SVR"},
+				},
+				Effective:   capTime("2019-05-28T16:45:00-05:00"),
+				Onset:       capTime("2019-05-28T16:45:00-05:00"),
+				Expires:     capTime("2019-05-28T17:15:00-05:00"),
+				SenderName:  "NWS Topeka (Northeast Kansas)",
+				Headline:    "Severe Thunderstorm Warning issued May 28 at 4:45PM CDT until May 28 at 5:15PM CDT by NWS Topeka",
+				Description: "At 445 PM CDT, a severe thunderstorm was located near Manhattan,\nmoving east at 30 mph.",
+				Instruction: "For your protection move to an interior room on the lowest floor of a building.",
+				Web:         "http://www.weather.gov",
+				Contact:     "contact",
+				Parameters: capxml.KeyValue{
+					"VTEC":                   {"/O.CON.KTOP.SV.W.0123.000000T0000Z-190528T2215Z/"},
+					"eventMotionDescription": {"2019-05-28T21:45:00-00:00...storm...265DEG...26KT...39.18,-96.57"},
+					"tornadoDetection":       {"POSSIBLE"},
+				},
+				Resources: []*capxml.Resource{
+					{
+						Description: "Image",
+						MimeType:    "image/png",
+						Size:        4,
+						URI:         "http://example.com/image.png",
+						Digest:      "da39a3ee5e6b4b0d3255bfef95601890afd80709",
+						DerefURI:    base64.StdEncoding.EncodeToString([]byte{0x89, 'P', 'N', 'G'}),
+					},
+				},
+				Areas: []*capxml.Area{
+					{
+						Description: "Pottawatomie; Riley",
+						Polygons: capxml.Polygons{
+							{
+								Type: "Polygon",
+								Coordinates: [][][]float64{
+									{{-96.73, 39.22}, {-96.39, 39.33}, {-96.35, 39.1}, {-96.73, 39.22}},
+									{{-96.6, 39.2}, {-96.5, 39.25}, {-96.45, 39.15}, {-96.6, 39.2}},
+								},
+							},
+						},
+						Circles: capxml.Circles{
+							{
+								Type:        "Point",
+								Coordinates: []float64{-96.57, 39.18},
+								Radius:      12.5,
+							},
+						},
+						GeoCodes: capxml.KeyValue{
+							"SAME": {"020149", "020161"},
+							"UGC":  {"KSC149", "KSC161"},
+						},
+						Altitude: 100,
+						Ceiling:  2500,
+					},
+				},
+			},
+		},
+	}
+}
+
+func fromTimestamp(ts *timestamp.Timestamp) *capxml.Time {
+	if ts == nil {
+		return nil
+	}
+	t, _ := ptypes.Timestamp(ts)
+	return &capxml.Time{Time: t}
+}
+
+func fromKeyValue(m map[string]*_struct.ListValue) capxml.KeyValue {
+	if m == nil {
+		return nil
+	}
+
+	kv := make(capxml.KeyValue, len(m))
+	for k, list := range m {
+		for _, v := range list.Values {
+			kv[k] = append(kv[k], v.GetStringValue())
+		}
+	}
+	return kv
+}
+
+// fromCAP converts the CAP alert back, to check that nothing was lost.
+func fromCAP(alert *cap.Alert) *capxml.Alert {
+	xmlAlert := &capxml.Alert{
+		Identifier:  alert.Identifier,
+		Sender:      alert.Sender,
+		Sent:        *fromTimestamp(alert.Sent),
+		Status:      capxml.Status(alert.Status),
+		MessageType: capxml.MessageType(alert.MessageType),
+		Source:      alert.Source,
+		Scope:       capxml.Scope(alert.Scope),
+		Restriction: alert.Restriction,
+		Addresses:   alert.Addresses,
+		Codes:       alert.Code,
+		Note:        alert.Note,
+		Incidents:   alert.Incidents,
+		Superseded:  alert.Superseded,
+	}
+
+	for _, reference := range alert.References {
+		xmlAlert.References = append(xmlAlert.References, &capxml.Reference{
+			Sender:     reference.Sender,
+			Identifier: reference.Identifier,
+			Sent:       *fromTimestamp(reference.Sent),
+		})
+	}
+
+	for _, info := range alert.Infos {
+		xmlInfo := &capxml.Info{
+			Language:    info.Language,
+			Event:       info.Event,
+			Urgency:     capxml.Urgency(info.Urgency),
+			Severity:    capxml.Severity(info.Severity),
+			Certainty:   capxml.Certainty(info.Certainty),
+			Audience:    info.Audience,
+			EventCodes:  fromKeyValue(info.EventCodes),
+			Effective:   fromTimestamp(info.Effective),
+			Onset:       fromTimestamp(info.Onset),
+			Expires:     fromTimestamp(info.Expires),
+			SenderName:  info.SenderName,
+			Headline:    info.Headline,
+			Description: info.Description,
+			Instruction: info.Instruction,
+			Web:         info.Web,
+			Contact:     info.Contact,
+			Parameters:  fromKeyValue(info.Parameters),
+		}
+
+		for _, category := range info.Categories {
+			xmlInfo.Categories = append(xmlInfo.Categories, capxml.Category(category))
+		}
+		for _, responseType := range info.ResponseTypes {
+			xmlInfo.ResponseTypes = append(xmlInfo.ResponseTypes, capxml.ResponseType(responseType))
+		}
+
+		for _, resource := range info.Resources {
+			xmlInfo.Resources = append(xmlInfo.Resources, &capxml.Resource{
+				Description: resource.Description,
+				MimeType:    resource.MimeType,
+				Size:        int(resource.Size),
+				URI:         resource.Uri,
+				Digest:      resource.Digest,
+				DerefURI:    base64.StdEncoding.EncodeToString(resource.DerefUri),
+			})
+		}
+
+		for _, area := range info.Areas {
+			xmlArea := &capxml.Area{
+				Description: area.Description,
+				GeoCodes:    fromKeyValue(area.Geocodes),
+				Altitude:    int(area.Altitude),
+				Ceiling:     int(area.Ceiling),
+			}
+
+			for _, polygon := range area.Polygons {
+				xmlPolygon := &capxml.Polygon{Type: polygon.Type}
+				for _, ring := range polygon.Coordinates {
+					var points [][]float64
+					for _, point := range ring.Values {
+						var coords []float64
+						for _, n := range point.GetListValue().Values {
+							coords = append(coords, n.GetNumberValue())
+						}
+						points = append(points, coords)
+					}
+					xmlPolygon.Coordinates = append(xmlPolygon.Coordinates, points)
+				}
+				xmlArea.Polygons = append(xmlArea.Polygons, xmlPolygon)
+			}
+
+			for _, circle := range area.Circles {
+				xmlArea.Circles = append(xmlArea.Circles, &capxml.Circle{
+					Type:        circle.Type,
+					Coordinates: circle.Coordinates,
+					Radius:      circle.Radius,
+				})
+			}
+
+			xmlInfo.Areas = append(xmlInfo.Areas, xmlArea)
+		}
+
+		xmlAlert.Infos = append(xmlAlert.Infos, xmlInfo)
+	}
+
+	return xmlAlert
+}
+
+// inUTC returns the alert with its times in UTC. CAP timestamps are
+// instants, without the time zone of the original time.
+func inUTC(alert *capxml.Alert) *capxml.Alert {
+	utc := func(t *capxml.Time) {
+		if t != nil {
+			t.Time = t.Time.UTC()
+		}
+	}
+
+	utc(&alert.Sent)
+	for _, reference := range alert.References {
+		utc(&reference.Sent)
+	}
+	for _, info := range alert.Infos {
+		utc(info.Effective)
+		utc(info.Onset)
+		utc(info.Expires)
+	}
+	return alert
+}
+
+func TestAlertRoundTrip(t *testing.T) {
+	alert, err := Alert(testAlert())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := fromCAP(alert)
+	want := inUTC(testAlert())
+	if !reflect.DeepEqual(got, want) {
+		gb, _ := json.MarshalIndent(got, "", "  ")
+		wb, _ := json.MarshalIndent(want, "", "  ")
+		t.Errorf("Round trip lost information:\ngot  %s\nwant %s", gb, wb)
+	}
+}
+
+func TestAlertReferenceID(t *testing.T) {
+	xmlAlert := testAlert()
+	alert, err := Alert(xmlAlert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := alert.References[0].Id, xmlAlert.References[0].ID(); got != want {
+		t.Errorf("Reference ID = %q, want %q", got, want)
+	}
+}
+
+func TestResourceInvalidDerefURI(t *testing.T) {
+	if _, err := Resource(&capxml.Resource{DerefURI: "not base64!"}); err == nil {
+		t.Error("Resource() with an invalid derefUri succeeded")
+	}
+}
+
+// viaJSON converts the alert through JSON, as was done before Alert.
+func viaJSON(xmlAlert *capxml.Alert) (*cap.Alert, error) {
+	b, err := json.Marshal(xmlAlert)
+	if err != nil {
+		return nil, err
+	}
+
+	var alert cap.Alert
+	jd := jsonpb.Unmarshaler{AllowUnknownFields: true}
+	if err := jd.Unmarshal(bytes.NewReader(b), &alert); err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// largeAlert returns the test alert with a large polygon.
+func largeAlert() *capxml.Alert {
+	alert := testAlert()
+
+	ring := make([][]float64, 5000)
+	for i := range ring {
+		ring[i] = []float64{-96 - float64(i)/10000, 39 + float64(i)/10000}
+	}
+	alert.Infos[0].Areas[0].Polygons[0].Coordinates = [][][]float64{ring}
+	return alert
+}
+
+func BenchmarkAlert(b *testing.B) {
+	alert := largeAlert()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := Alert(alert); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAlertJSON(b *testing.B) {
+	alert := largeAlert()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := viaJSON(alert); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestAlertMatchesJSON(t *testing.T) {
+	want, err := viaJSON(testAlert())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The codes were dropped by the JSON conversion (codes != code)
+	if len(want.Code) != 0 {
+		t.Errorf("JSON conversion kept the codes: %v", want.Code)
+	}
+	want.Code = testAlert().Codes
+
+	got, err := Alert(testAlert())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !proto.Equal(got, want) {
+		t.Errorf("Alert() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,221 @@
+package diff
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/alerting/alerts/pkg/cap"
+	"github.com/golang/protobuf/ptypes"
+	_struct "github.com/golang/protobuf/ptypes/struct"
+)
+
+// Kilometres per degree of latitude.
+const kmPerDegree = 111.32
+
+// A StringChange represents a changed string value.
+type StringChange struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// A TimeChange represents a changed time. Change is positive
+// when the time was extended, and negative when shortened.
+type TimeChange struct {
+	Before time.Time     `json:"before"`
+	After  time.Time     `json:"after"`
+	Change time.Duration `json:"change"`
+}
+
+// An AreaChange represents a change in the polygon area, in km².
+type AreaChange struct {
+	Before float64 `json:"before"`
+	After  float64 `json:"after"`
+}
+
+// A Change represents the differences between an alert and an
+// alert it references (updates or cancels).
+type Change struct {
+	AlertID     string `json:"alert_id"`
+	ReferenceID string `json:"reference_id"`
+	MessageType string `json:"message_type"`
+	Event       string `json:"event"`
+
+	ZonesAdded   []string `json:"zones_added,omitempty"`
+	ZonesRemoved []string `json:"zones_removed,omitempty"`
+
+	Area      *AreaChange   `json:"area,omitempty"`
+	Expires   *TimeChange   `json:"expires,omitempty"`
+	Severity  *StringChange `json:"severity,omitempty"`
+	Urgency   *StringChange `json:"urgency,omitempty"`
+	Certainty *StringChange `json:"certainty,omitempty"`
+	Headline  *StringChange `json:"headline,omitempty"`
+}
+
+// Empty returns whether the change has no differences.
+func (change *Change) Empty() bool {
+	return len(change.ZonesAdded) == 0 && len(change.ZonesRemoved) == 0 &&
+		change.Area == nil && change.Expires == nil && change.Severity == nil &&
+		change.Urgency == nil && change.Certainty == nil && change.Headline == nil
+}
+
+// Alerts returns the differences between the current alert
+// and the previous alert it references.
+func Alerts(previous, current *cap.Alert) *Change {
+	change := &Change{
+		AlertID:     current.ID(),
+		ReferenceID: previous.ID(),
+		MessageType: current.MessageType.String(),
+	}
+
+	before := primaryInfo(previous)
+	after := primaryInfo(current)
+	if after != nil {
+		change.Event = after.Event
+	}
+	if before == nil || after == nil {
+		return change
+	}
+
+	// Zones
+	beforeZones := zones(before)
+	afterZones := zones(after)
+	for zone := range afterZones {
+		if !beforeZones[zone] {
+			change.ZonesAdded = append(change.ZonesAdded, zone)
+		}
+	}
+	for zone := range beforeZones {
+		if !afterZones[zone] {
+			change.ZonesRemoved = append(change.ZonesRemoved, zone)
+		}
+	}
+	sort.Strings(change.ZonesAdded)
+	sort.Strings(change.ZonesRemoved)
+
+	// Polygon area
+	if beforeArea, afterArea := area(before), area(after); math.Abs(beforeArea-afterArea) >= 0.5 {
+		change.Area = &AreaChange{
+			Before: beforeArea,
+			After:  afterArea,
+		}
+	}
+
+	// Expiry
+	if before.Expires != nil && after.Expires != nil {
+		beforeExpires, _ := ptypes.Timestamp(before.Expires)
+		afterExpires, _ := ptypes.Timestamp(after.Expires)
+		if !beforeExpires.Equal(afterExpires) {
+			change.Expires = &TimeChange{
+				Before: beforeExpires,
+				After:  afterExpires,
+				Change: afterExpires.Sub(beforeExpires),
+			}
+		}
+	}
+
+	if before.Severity != after.Severity {
+		change.Severity = &StringChange{before.Severity.String(), after.Severity.String()}
+	}
+	if before.Urgency != after.Urgency {
+		change.Urgency = &StringChange{before.Urgency.String(), after.Urgency.String()}
+	}
+	if before.Certainty != after.Certainty {
+		change.Certainty = &StringChange{before.Certainty.String(), after.Certainty.String()}
+	}
+	if before.Headline != after.Headline {
+		change.Headline = &StringChange{before.Headline, after.Headline}
+	}
+
+	return change
+}
+
+// primaryInfo returns the English info, or the first info if there is none.
+func primaryInfo(alert *cap.Alert) *cap.Info {
+	for _, info := range alert.Infos {
+		if info.Language == "en-US" || info.Language == "en" {
+			return info
+		}
+	}
+	if len(alert.Infos) > 0 {
+		return alert.Infos[0]
+	}
+	return nil
+}
+
+// zones returns the UGC codes of the info's areas.
+func zones(info *cap.Info) map[string]bool {
+	codes := make(map[string]bool)
+	for _, a := range info.Areas {
+		if ugcs, ok := a.Geocodes["UGC"]; ok {
+			for _, v := range ugcs.Values {
+				codes[v.GetStringValue()] = true
+			}
+		}
+	}
+	return codes
+}
+
+// area returns the approximate area of the info's polygons, in km².
+func area(info *cap.Info) float64 {
+	total := 0.0
+	for _, a := range info.Areas {
+		for _, polygon := range a.Polygons {
+			for _, ring := range polygon.Coordinates {
+				total += ringArea(ring)
+			}
+		}
+	}
+	return total
+}
+
+// ringArea returns the approximate area of the ring of [lon, lat]
+// coordinates, in km², using an equirectangular projection.
+func ringArea(ring *_struct.ListValue) float64 {
+	points := ring.GetValues()
+	if len(points) < 3 {
+		return 0
+	}
+
+	coord := func(i int) (float64, float64) {
+		values := points[i].GetListValue().GetValues()
+		if len(values) < 2 {
+			return 0, 0
+		}
+		return values[0].GetNumberValue(), values[1].GetNumberValue()
+	}
+
+	_, lat0 := coord(0)
+	scale := math.Cos(lat0 * math.Pi / 180)
+
+	sum := 0.0
+	for i := range points {
+		x1, y1 := coord(i)
+		x2, y2 := coord((i + 1) % len(points))
+		sum += (x1*scale)*(y2) - (x2*scale)*(y1)
+	}
+
+	return math.Abs(sum) / 2 * kmPerDegree * kmPerDegree
+}
+
+// Codec encodes and decodes changes.
+type Codec struct{}
+
+// Encode implements the goka.Codec interface.
+func (c *Codec) Encode(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case *Change:
+		return json.Marshal(v)
+	default:
+		return nil, errors.New("Unknown type provided")
+	}
+}
+
+// Decode implements the goka.Codec interface.
+func (c *Codec) Decode(data []byte) (interface{}, error) {
+	var change Change
+	err := json.Unmarshal(data, &change)
+	return &change, err
+}
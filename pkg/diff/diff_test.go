@@ -0,0 +1,234 @@
+package diff
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alerting/alerts-nws/pkg/convert"
+	"github.com/alerting/alerts/pkg/cap"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+func capTime(str string) *capxml.Time {
+	t, err := time.Parse(time.RFC3339, str)
+	if err != nil {
+		panic(err)
+	}
+	return &capxml.Time{Time: t}
+}
+
+// testAlert returns a warning for two zones, with a polygon of about 9,600 km².
+func testAlert(id string) *capxml.Alert {
+	return &capxml.Alert{
+		Identifier:  id,
+		Sender:      "w-nws.webmaster@noaa.gov",
+		Sent:        *capTime("2019-05-28T16:30:00-05:00"),
+		Status:      capxml.StatusActual,
+		MessageType: capxml.MessageTypeAlert,
+		Scope:       capxml.ScopePublic,
+		Infos: []*capxml.Info{
+			{
+				Language:  "en-US",
+				Event:     "Severe Thunderstorm Warning",
+				Urgency:   capxml.UrgencyImmediate,
+				Severity:  capxml.SeveritySevere,
+				Certainty: capxml.CertaintyObserved,
+				Expires:   capTime("2019-05-28T17:15:00-05:00"),
+				Headline:  "Severe Thunderstorm Warning issued May 28 at 4:30PM CDT",
+				Areas: []*capxml.Area{
+					{
+						Description: "Riley; Pottawatomie",
+						Polygons: []*capxml.Polygon{
+							{Coordinates: [][][]float64{{{-97, 39}, {-96, 39}, {-96, 40}, {-97, 40}, {-97, 39}}}},
+						},
+						GeoCodes: capxml.KeyValue{"UGC": {"KSC161", "KSC149"}},
+					},
+				},
+			},
+		},
+	}
+}
+
+func convertAlert(t *testing.T, alert *capxml.Alert) *cap.Alert {
+	converted, err := convert.Alert(alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return converted
+}
+
+func TestAlerts(t *testing.T) {
+	info := func(alert *capxml.Alert) *capxml.Info {
+		return alert.Infos[0]
+	}
+	ring := func(alert *capxml.Alert) [][]float64 {
+		return info(alert).Areas[0].Polygons[0].Coordinates[0]
+	}
+
+	tests := []struct {
+		name   string
+		update func(alert *capxml.Alert)
+		want   Change
+	}{
+		{
+			"unchanged",
+			func(alert *capxml.Alert) {},
+			Change{},
+		},
+		{
+			"zones added",
+			func(alert *capxml.Alert) {
+				info(alert).Areas[0].GeoCodes["UGC"] = []string{"KSC161", "KSC149", "KSC197", "KSC177"}
+			},
+			Change{ZonesAdded: []string{"KSC177", "KSC197"}},
+		},
+		{
+			"zones removed and added",
+			func(alert *capxml.Alert) {
+				info(alert).Areas[0].GeoCodes["UGC"] = []string{"KSC197"}
+			},
+			Change{ZonesAdded: []string{"KSC197"}, ZonesRemoved: []string{"KSC149", "KSC161"}},
+		},
+		{
+			"area changed below the threshold",
+			func(alert *capxml.Alert) {
+				ring(alert)[1][0] = -95.99999
+				ring(alert)[2][0] = -95.99999
+			},
+			Change{},
+		},
+		{
+			"area changed above the threshold",
+			func(alert *capxml.Alert) {
+				ring(alert)[1][0] = -96.5
+				ring(alert)[2][0] = -96.5
+			},
+			Change{Area: &AreaChange{Before: 9631, After: 4815}},
+		},
+		{
+			"expiry extended",
+			func(alert *capxml.Alert) {
+				info(alert).Expires = capTime("2019-05-28T17:45:00-05:00")
+			},
+			Change{Expires: &TimeChange{
+				Before: capTime("2019-05-28T17:15:00-05:00").UTC(),
+				After:  capTime("2019-05-28T17:45:00-05:00").UTC(),
+				Change: 30 * time.Minute,
+			}},
+		},
+		{
+			"expiry shortened",
+			func(alert *capxml.Alert) {
+				info(alert).Expires = capTime("2019-05-28T17:00:00-05:00")
+			},
+			Change{Expires: &TimeChange{
+				Before: capTime("2019-05-28T17:15:00-05:00").UTC(),
+				After:  capTime("2019-05-28T17:00:00-05:00").UTC(),
+				Change: -15 * time.Minute,
+			}},
+		},
+		{
+			"severity, urgency and certainty",
+			func(alert *capxml.Alert) {
+				info(alert).Severity = capxml.SeverityExtreme
+				info(alert).Urgency = capxml.UrgencyExpected
+				info(alert).Certainty = capxml.CertaintyLikely
+			},
+			Change{
+				Severity:  &StringChange{"SEVERE", "EXTREME"},
+				Urgency:   &StringChange{"IMMEDIATE", "EXPECTED"},
+				Certainty: &StringChange{"OBSERVED", "LIKELY"},
+			},
+		},
+		{
+			"headline",
+			func(alert *capxml.Alert) {
+				info(alert).Headline = "Severe Thunderstorm Warning issued May 28 at 4:45PM CDT"
+			},
+			Change{Headline: &StringChange{
+				"Severe Thunderstorm Warning issued May 28 at 4:30PM CDT",
+				"Severe Thunderstorm Warning issued May 28 at 4:45PM CDT",
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			previous := testAlert("previous")
+			current := testAlert("current")
+			current.MessageType = capxml.MessageTypeUpdate
+			test.update(current)
+
+			before, after := convertAlert(t, previous), convertAlert(t, current)
+			change := Alerts(before, after)
+			if change.AlertID != after.ID() || change.ReferenceID != before.ID() ||
+				change.MessageType != "UPDATE" || change.Event != "Severe Thunderstorm Warning" {
+				t.Errorf("Change of %s to %s (%s, %s)", change.ReferenceID, change.AlertID, change.MessageType, change.Event)
+			}
+
+			// Round the areas for comparison
+			if change.Area != nil {
+				change.Area.Before, change.Area.After = math.Round(change.Area.Before), math.Round(change.Area.After)
+			}
+
+			if empty := reflect.DeepEqual(test.want, Change{}); change.Empty() != empty {
+				t.Errorf("Empty() = %v, want %v", change.Empty(), empty)
+			}
+
+			test.want.AlertID, test.want.ReferenceID = change.AlertID, change.ReferenceID
+			test.want.MessageType, test.want.Event = change.MessageType, change.Event
+			if !reflect.DeepEqual(*change, test.want) {
+				t.Errorf("Alerts() = %+v, want %+v", *change, test.want)
+			}
+		})
+	}
+}
+
+func TestAlertsPrimaryInfo(t *testing.T) {
+	previous := testAlert("previous")
+	current := testAlert("current")
+
+	// The English info is compared, even if not first
+	spanish := &capxml.Info{Language: "es-US", Event: "Aviso de Tormenta Severa", Headline: "Otro"}
+	current.Infos = append([]*capxml.Info{spanish}, current.Infos...)
+
+	change := Alerts(convertAlert(t, previous), convertAlert(t, current))
+	if change.Event != "Severe Thunderstorm Warning" || !change.Empty() {
+		t.Errorf("Alerts() = %+v, want no changes", change)
+	}
+
+	// Without infos, there is nothing to compare
+	current.Infos = nil
+	if change := Alerts(convertAlert(t, previous), convertAlert(t, current)); !change.Empty() || change.Event != "" {
+		t.Errorf("Alerts() without infos = %+v", change)
+	}
+}
+
+func TestCodec(t *testing.T) {
+	change := &Change{
+		AlertID:      "current",
+		ReferenceID:  "previous",
+		MessageType:  "UPDATE",
+		ZonesRemoved: []string{"KSC149"},
+		Expires:      &TimeChange{Before: time.Unix(0, 0).UTC(), After: time.Unix(1800, 0).UTC(), Change: 30 * time.Minute},
+	}
+
+	codec := new(Codec)
+	data, err := codec.Encode(change)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := codec.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, change) {
+		t.Errorf("Decoded %+v, want %+v", decoded, change)
+	}
+
+	if _, err := codec.Encode("change"); err == nil {
+		t.Error("Encode() accepted a string")
+	}
+}
@@ -0,0 +1,259 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alerting/alerts-naads/pkg/codec"
+	"github.com/alerting/alerts-nws/pkg/notify"
+	"github.com/alerting/alerts-nws/pkg/vtec"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+	"github.com/lovoo/goka"
+)
+
+// Config is the configuration for the email processor.
+type Config struct {
+	Brokers []string
+	Group   string
+
+	// Topic of stored alerts (see consume.Config.StoredTopic).
+	StoredTopic string
+
+	Mailer *Mailer
+}
+
+// A Recipient is an email address that is sent the alerts matching its filter.
+type Recipient struct {
+	notify.Filter
+
+	Address string `json:"address"`
+}
+
+// LoadRecipients loads the recipients from a JSON file, containing a list of recipients.
+func LoadRecipients(filename string) ([]*Recipient, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var recipients []*Recipient
+	if err := json.NewDecoder(f).Decode(&recipients); err != nil {
+		return nil, err
+	}
+
+	for _, recipient := range recipients {
+		if recipient.Address == "" {
+			return nil, errors.New("Recipient is missing its address")
+		}
+	}
+
+	return recipients, nil
+}
+
+// An email waiting to be sent.
+type email struct {
+	to      string
+	subject string
+	data    interface{}
+	tmpl    string
+}
+
+// A Mailer emails alerts to the recipients. Warnings are sent immediately,
+// while other alerts are collected and sent as a digest. Digests are kept
+// in memory, so those not yet sent are lost when the mailer is stopped.
+type Mailer struct {
+	Recipients []*Recipient
+	SMTP       *SMTP
+	Templates  *Templates
+
+	// How often digests are sent.
+	DigestInterval time.Duration
+
+	queue chan *email
+
+	mutex       sync.Mutex
+	digests     map[string][]*Alert
+	digestStart time.Time
+}
+
+// isWarning returns whether the info is for a warning: its VTEC
+// significance is W, or, without VTEC, its event is a warning.
+func isWarning(info *capxml.Info) bool {
+	for _, str := range info.Parameters["VTEC"] {
+		if pvtec, err := vtec.ParsePVTEC(str); err == nil {
+			return pvtec.Significance == "W"
+		}
+	}
+	return strings.HasSuffix(strings.ToLower(info.Event), "warning")
+}
+
+// Mail sends the alert to the recipients whose filters it matches.
+// Warnings are queued, waiting for room in the queue, or the context
+// to be done.
+func (mailer *Mailer) Mail(ctx context.Context, alert *capxml.Alert) error {
+	for _, recipient := range mailer.Recipients {
+		for _, info := range alert.Infos {
+			if !recipient.MatchesInfo(info) {
+				continue
+			}
+
+			data := NewAlert(alert, info)
+			if isWarning(info) {
+				log.Printf("Emailing %s to %s", data.ID, recipient.Address)
+				err := mailer.enqueue(ctx, &email{
+					to:      recipient.Address,
+					subject: data.Headline,
+					data:    data,
+					tmpl:    "alert",
+				})
+				if err != nil {
+					return err
+				}
+			} else {
+				log.Printf("Adding %s to the digest of %s", data.ID, recipient.Address)
+				mailer.mutex.Lock()
+				mailer.digests[recipient.Address] = append(mailer.digests[recipient.Address], data)
+				mailer.mutex.Unlock()
+			}
+
+			// Only send the first matching info
+			break
+		}
+	}
+
+	return nil
+}
+
+// enqueue queues the email to be sent, unless the context is done first.
+func (mailer *Mailer) enqueue(ctx context.Context, e *email) error {
+	select {
+	case mailer.queue <- e:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flushDigests queues the digests collected since the last flush.
+func (mailer *Mailer) flushDigests(ctx context.Context) error {
+	mailer.mutex.Lock()
+	digests := mailer.digests
+	start := mailer.digestStart
+	mailer.digests = make(map[string][]*Alert)
+	mailer.digestStart = time.Now()
+	end := mailer.digestStart
+	mailer.mutex.Unlock()
+
+	for to, alerts := range digests {
+		log.Printf("Emailing digest of %d alert(s) to %s", len(alerts), to)
+		err := mailer.enqueue(ctx, &email{
+			to:      to,
+			subject: fmt.Sprintf("Alert digest: %d alert(s)", len(alerts)),
+			data: &Digest{
+				Start:  start,
+				End:    end,
+				Alerts: alerts,
+			},
+			tmpl: "digest",
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// send renders and sends the email.
+func (mailer *Mailer) send(e *email) error {
+	var text, html bytes.Buffer
+	if err := mailer.Templates.Text.ExecuteTemplate(&text, e.tmpl, e.data); err != nil {
+		return err
+	}
+	if err := mailer.Templates.HTML.ExecuteTemplate(&html, e.tmpl, e.data); err != nil {
+		return err
+	}
+
+	msg, err := message(mailer.SMTP.From, e.to, e.subject, text.Bytes(), html.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return mailer.SMTP.Send([]string{e.to}, msg)
+}
+
+// Start prepares the mailer to receive alerts.
+func (mailer *Mailer) Start() {
+	mailer.queue = make(chan *email, 100)
+	mailer.digests = make(map[string][]*Alert)
+	mailer.digestStart = time.Now()
+}
+
+// Run sends the queued emails, and queues the digests every digest
+// interval, until the context is cancelled. Emails are sent apart from
+// the digest ticker, so a slow server does not delay the digests.
+func (mailer *Mailer) Run(ctx context.Context) {
+	go mailer.sendQueued(ctx)
+
+	ticker := time.NewTicker(mailer.DigestInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := mailer.flushDigests(ctx); err != nil {
+				log.Printf("Unable to queue digests: %v", err)
+			}
+		}
+	}
+}
+
+// sendQueued sends the queued emails until the context is cancelled.
+func (mailer *Mailer) sendQueued(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-mailer.queue:
+			if err := mailer.send(e); err != nil {
+				log.Printf("Unable to email %s: %v", e.to, err)
+			}
+		}
+	}
+}
+
+func collect(ctx context.Context, conf *Config) func(ctx goka.Context, msg interface{}) {
+	return func(gctx goka.Context, msg interface{}) {
+		alert := msg.(capxml.Alert)
+		if err := conf.Mailer.Mail(ctx, &alert); err != nil {
+			log.Printf("Unable to email %s: %v", alert.ID(), err)
+		}
+	}
+}
+
+// Run runs the email processor, emailing the stored alerts to the recipients.
+func Run(ctx context.Context, conf Config) error {
+	conf.Mailer.Start()
+	go conf.Mailer.Run(ctx)
+
+	g := goka.DefineGroup(goka.Group(conf.Group),
+		goka.Input(goka.Stream(conf.StoredTopic), new(codec.Alert), collect(ctx, &conf)),
+	)
+
+	p, err := goka.NewProcessor(conf.Brokers, g)
+	if err != nil {
+		return err
+	}
+	return p.Run(ctx)
+}
@@ -0,0 +1,174 @@
+package email
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+func testAlert(identifier, event string, vtecs ...string) *capxml.Alert {
+	sent, _ := time.Parse(time.RFC3339, "2019-05-28T16:45:00-05:00")
+	return &capxml.Alert{
+		Identifier:  identifier,
+		Sender:      "w-nws.webmaster@noaa.gov",
+		Sent:        capxml.Time{Time: sent},
+		Status:      capxml.StatusActual,
+		MessageType: capxml.MessageTypeAlert,
+		Scope:       capxml.ScopePublic,
+		Infos: []*capxml.Info{
+			{
+				Event:      event,
+				Headline:   event + " issued",
+				Parameters: capxml.KeyValue{"VTEC": vtecs},
+				Areas: []*capxml.Area{
+					{
+						Description: "Riley; Pottawatomie",
+						GeoCodes:    capxml.KeyValue{"UGC": {"KSC161", "KSC149"}},
+					},
+				},
+			},
+		},
+	}
+}
+
+func testMailer(t *testing.T, addresses ...string) *Mailer {
+	templates, err := LoadTemplates("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mailer := &Mailer{
+		Templates:      templates,
+		DigestInterval: time.Hour,
+	}
+	for _, address := range addresses {
+		mailer.Recipients = append(mailer.Recipients, &Recipient{Address: address})
+	}
+	mailer.Start()
+	return mailer
+}
+
+// queued returns the emails in the queue.
+func queued(mailer *Mailer) []*email {
+	var emails []*email
+	for {
+		select {
+		case e := <-mailer.queue:
+			emails = append(emails, e)
+		default:
+			return emails
+		}
+	}
+}
+
+func TestDigest(t *testing.T) {
+	mailer := testMailer(t, "a@example.com", "b@example.com")
+	ctx := context.Background()
+
+	alerts := []*capxml.Alert{
+		testAlert("warning", "Tornado Warning", "/O.NEW.KTOP.TO.W.0012.190528T2141Z-190528T2215Z/"),
+		testAlert("watch", "Tornado Watch", "/O.NEW.KWNS.TO.A.0301.190528T2100Z-190529T0400Z/"),
+		testAlert("statement", "Special Weather Statement"),
+	}
+	for _, alert := range alerts {
+		if err := mailer.Mail(ctx, alert); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Warnings are sent immediately
+	emails := queued(mailer)
+	if len(emails) != 2 {
+		t.Fatalf("Queued %d email(s), want 2", len(emails))
+	}
+	for _, e := range emails {
+		if e.tmpl != "alert" || e.subject != "Tornado Warning issued" {
+			t.Errorf("Queued %s %q to %s, want the warning", e.tmpl, e.subject, e.to)
+		}
+	}
+
+	// The others are batched into a digest per recipient
+	if err := mailer.flushDigests(ctx); err != nil {
+		t.Fatal(err)
+	}
+	emails = queued(mailer)
+	if len(emails) != 2 {
+		t.Fatalf("Queued %d digest(s), want 2", len(emails))
+	}
+	for _, e := range emails {
+		digest := e.data.(*Digest)
+		if e.tmpl != "digest" || len(digest.Alerts) != 2 {
+			t.Fatalf("Queued %s of %d alert(s), want a digest of 2", e.tmpl, len(digest.Alerts))
+		}
+		if digest.Alerts[0].Event != "Tornado Watch" || digest.Alerts[1].Event != "Special Weather Statement" {
+			t.Errorf("Digest alerts = %s, %s", digest.Alerts[0].Event, digest.Alerts[1].Event)
+		}
+		if e.subject != "Alert digest: 2 alert(s)" {
+			t.Errorf("Subject = %q", e.subject)
+		}
+		if !digest.End.After(digest.Start) && !digest.End.Equal(digest.Start) {
+			t.Errorf("Digest ends %v, before it starts %v", digest.End, digest.Start)
+		}
+	}
+
+	// The digests are emptied once flushed
+	if err := mailer.flushDigests(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if emails := queued(mailer); len(emails) != 0 {
+		t.Errorf("Queued %d email(s) after flushing, want 0", len(emails))
+	}
+}
+
+func TestMailFullQueue(t *testing.T) {
+	mailer := testMailer(t, "a@example.com")
+	mailer.queue = make(chan *email)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	alert := testAlert("warning", "Tornado Warning", "/O.NEW.KTOP.TO.W.0012.190528T2141Z-190528T2215Z/")
+	if err := mailer.Mail(ctx, alert); err != context.DeadlineExceeded {
+		t.Errorf("Mail() with a full queue = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRun(t *testing.T) {
+	srv := newSMTPServer(t, nil)
+	defer srv.Close()
+
+	mailer := testMailer(t, "a@example.com")
+	mailer.SMTP = &SMTP{Addr: srv.Addr(), From: "alerts@example.com"}
+	mailer.DigestInterval = 20 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go mailer.Run(ctx)
+
+	for _, alert := range []*capxml.Alert{
+		testAlert("warning", "Tornado Warning", "/O.NEW.KTOP.TO.W.0012.190528T2141Z-190528T2215Z/"),
+		testAlert("watch", "Tornado Watch", "/O.NEW.KWNS.TO.A.0301.190528T2100Z-190529T0400Z/"),
+	} {
+		if err := mailer.Mail(ctx, alert); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(srv.Messages()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	messages := srv.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("Received %d message(s), want 2", len(messages))
+	}
+	for i, want := range []string{"Tornado Warning issued", "1 alert(s) from"} {
+		if !strings.Contains(messages[i].data, want) {
+			t.Errorf("Message %d is missing %q:\n%s", i+1, want, messages[i].data)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// An SMTP server to send the emails through.
+type SMTP struct {
+	// Address of the server (host:port).
+	Addr string
+
+	Username string
+	Password string
+
+	// Sender of the emails.
+	From string
+
+	// Fail if the server does not support STARTTLS. Otherwise,
+	// STARTTLS is used when the server supports it.
+	RequireTLS bool
+
+	// TLS configuration. If nil, the server's host name is verified.
+	TLSConfig *tls.Config
+}
+
+// sender returns the address of the sender, without its display name,
+// for the envelope.
+func (s *SMTP) sender() (string, error) {
+	addr, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return "", fmt.Errorf("Invalid sender %q: %v", s.From, err)
+	}
+	return addr.Address, nil
+}
+
+// Validate checks the server address and the sender.
+func (s *SMTP) Validate() error {
+	if _, _, err := net.SplitHostPort(s.Addr); err != nil {
+		return err
+	}
+	_, err := s.sender()
+	return err
+}
+
+// Send sends the message to the recipients.
+func (s *SMTP) Send(to []string, msg []byte) error {
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+
+	from, err := s.sender()
+	if err != nil {
+		return err
+	}
+
+	c, err := smtp.Dial(s.Addr)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		config := s.TLSConfig
+		if config == nil {
+			config = &tls.Config{ServerName: host}
+		}
+		if err := c.StartTLS(config); err != nil {
+			return err
+		}
+	} else if s.RequireTLS {
+		return errors.New("SMTP server does not support STARTTLS")
+	}
+
+	if s.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// message returns a multipart/alternative message, with the text and HTML bodies.
+func message(from, to, subject string, text, html []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	host := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		host = addr.Address[strings.LastIndex(addr.Address, "@")+1:]
+	}
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), host)
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+
+	for _, part := range []struct {
+		contentType string
+		body        []byte
+	}{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", html},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		qw := quotedprintable.NewWriter(pw)
+		if _, err := qw.Write(part.body); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
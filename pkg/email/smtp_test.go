@@ -0,0 +1,308 @@
+package email
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"net"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// A message received by the SMTP stand-in.
+type received struct {
+	from string
+	to   []string
+	data string
+
+	// Whether the message was sent after STARTTLS.
+	tls bool
+
+	// Credentials of the AUTH PLAIN command, if any.
+	username string
+	password string
+}
+
+// smtpServer is a minimal SMTP server, supporting STARTTLS and AUTH PLAIN.
+type smtpServer struct {
+	listener net.Listener
+	tls      *tls.Config
+
+	mutex    sync.Mutex
+	messages []*received
+	wg       sync.WaitGroup
+}
+
+// newSMTPServer starts an SMTP server. If tlsConfig isn't nil, the server
+// offers STARTTLS.
+func newSMTPServer(t *testing.T, tlsConfig *tls.Config) *smtpServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &smtpServer{listener: l, tls: tlsConfig}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+	return s
+}
+
+// Addr returns the address of the server.
+func (s *smtpServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the server, waiting for the connections to finish.
+func (s *smtpServer) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+// Messages returns the messages received.
+func (s *smtpServer) Messages() []*received {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.messages
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	tp := textproto.NewConn(conn)
+	msg := new(received)
+	tp.PrintfLine("220 localhost stand-in")
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch cmd {
+		case "EHLO":
+			tp.PrintfLine("250-localhost")
+			if s.tls != nil && !msg.tls {
+				tp.PrintfLine("250-STARTTLS")
+			}
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			tp.PrintfLine("220 Ready to start TLS")
+			tlsConn := tls.Server(conn, s.tls)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			tp = textproto.NewConn(conn)
+			msg.tls = true
+		case "AUTH":
+			fields := strings.Fields(line)
+			if len(fields) != 3 || fields[1] != "PLAIN" {
+				tp.PrintfLine("504 Unsupported")
+				continue
+			}
+			creds, err := base64.StdEncoding.DecodeString(fields[2])
+			if err != nil {
+				tp.PrintfLine("501 Invalid")
+				continue
+			}
+			parts := strings.Split(string(creds), "\x00")
+			if len(parts) != 3 {
+				tp.PrintfLine("501 Invalid")
+				continue
+			}
+			msg.username, msg.password = parts[1], parts[2]
+			tp.PrintfLine("235 Authenticated")
+		case "MAIL":
+			msg.from = line[strings.Index(line, ":")+1:]
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			msg.to = append(msg.to, line[strings.Index(line, ":")+1:])
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 Go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.data = string(data)
+
+			s.mutex.Lock()
+			s.messages = append(s.messages, msg)
+			s.mutex.Unlock()
+
+			msg = &received{tls: msg.tls, username: msg.username, password: msg.password}
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("250 OK")
+		}
+	}
+}
+
+// testTLS returns the server and client TLS configurations, using the
+// certificate of an httptest server.
+func testTLS() (*tls.Config, *tls.Config) {
+	ts := httptest.NewTLSServer(nil)
+	defer ts.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+
+	return &tls.Config{Certificates: ts.TLS.Certificates},
+		&tls.Config{RootCAs: pool, ServerName: "example.com"}
+}
+
+func TestSendStartTLS(t *testing.T) {
+	serverTLS, clientTLS := testTLS()
+	srv := newSMTPServer(t, serverTLS)
+	defer srv.Close()
+
+	s := &SMTP{
+		Addr:       srv.Addr(),
+		Username:   "user",
+		Password:   "secret",
+		From:       "alerts@example.com",
+		RequireTLS: true,
+		TLSConfig:  clientTLS,
+	}
+	if err := s.Send([]string{"a@example.com", "b@example.com"}, []byte("Subject: Test\r\n\r\nBody\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Close()
+	messages := srv.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("Received %d message(s), want 1", len(messages))
+	}
+	msg := messages[0]
+
+	if !msg.tls {
+		t.Error("Message was not sent over TLS")
+	}
+	if msg.username != "user" || msg.password != "secret" {
+		t.Errorf("Authenticated as %q/%q, want user/secret", msg.username, msg.password)
+	}
+	if msg.from != "<alerts@example.com>" {
+		t.Errorf("From = %q", msg.from)
+	}
+	if strings.Join(msg.to, ",") != "<a@example.com>,<b@example.com>" {
+		t.Errorf("To = %q", msg.to)
+	}
+	if !strings.Contains(msg.data, "Subject: Test") || !strings.Contains(msg.data, "Body") {
+		t.Errorf("Data = %q", msg.data)
+	}
+}
+
+func TestSendWithoutTLS(t *testing.T) {
+	srv := newSMTPServer(t, nil)
+	defer srv.Close()
+
+	s := &SMTP{
+		Addr:       srv.Addr(),
+		From:       "alerts@example.com",
+		RequireTLS: true,
+	}
+	if err := s.Send([]string{"a@example.com"}, []byte("Subject: Test\r\n\r\nBody\r\n")); err == nil {
+		t.Error("Sent without STARTTLS, when it is required")
+	}
+
+	// Without a username, no AUTH command is sent
+	s.RequireTLS = false
+	if err := s.Send([]string{"a@example.com"}, []byte("Subject: Test\r\n\r\nBody\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Close()
+	messages := srv.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("Received %d message(s), want 1", len(messages))
+	}
+	if messages[0].tls || messages[0].username != "" {
+		t.Errorf("Message = %+v, want plain and unauthenticated", messages[0])
+	}
+}
+
+func TestSendDisplayName(t *testing.T) {
+	srv := newSMTPServer(t, nil)
+	defer srv.Close()
+
+	// The envelope sender is the address, without the display name
+	s := &SMTP{Addr: srv.Addr(), From: "Weather Alerts <alerts@example.com>"}
+	if err := s.Send([]string{"a@example.com"}, []byte("Subject: Test\r\n\r\nBody\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Close()
+	messages := srv.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("Received %d message(s), want 1", len(messages))
+	}
+	if messages[0].from != "<alerts@example.com>" {
+		t.Errorf("From = %q", messages[0].from)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		s     SMTP
+		valid bool
+	}{
+		{SMTP{Addr: "mail.example.com:25", From: "alerts@example.com"}, true},
+		{SMTP{Addr: "mail.example.com:25", From: "Weather Alerts <alerts@example.com>"}, true},
+		{SMTP{Addr: "mail.example.com:25", From: ""}, false},
+		{SMTP{Addr: "mail.example.com:25", From: "Weather Alerts"}, false},
+		{SMTP{Addr: "mail.example.com", From: "alerts@example.com"}, false},
+	}
+
+	for _, test := range tests {
+		if err := test.s.Validate(); (err == nil) != test.valid {
+			t.Errorf("Validate(%q, %q) = %v, want valid %v", test.s.Addr, test.s.From, err, test.valid)
+		}
+	}
+}
+
+func TestMessage(t *testing.T) {
+	msg, err := message("Alerts <alerts@example.com>", "a@example.com", "Tornado Warning ☂", []byte("text body"), []byte("<p>html body</p>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tp := textproto.NewReader(bufio.NewReader(strings.NewReader(string(msg))))
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasSuffix(header.Get("Message-Id"), "@example.com>") {
+		t.Errorf("Message-ID = %q", header.Get("Message-Id"))
+	}
+	if !strings.HasPrefix(header.Get("Subject"), "=?utf-8?q?") {
+		t.Errorf("Subject = %q, want Q-encoded", header.Get("Subject"))
+	}
+	if !strings.HasPrefix(header.Get("Content-Type"), "multipart/alternative; boundary=") {
+		t.Errorf("Content-Type = %q", header.Get("Content-Type"))
+	}
+	for _, part := range []string{"text/plain; charset=utf-8", "text/html; charset=utf-8", "text body", "<p>html body</p>"} {
+		if !strings.Contains(string(msg), part) {
+			t.Errorf("Message is missing %q", part)
+		}
+	}
+}
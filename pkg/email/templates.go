@@ -0,0 +1,141 @@
+package email
+
+import (
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/alerting/alerts-nws/pkg/notify"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+// Default text templates, defining the alert and digest templates.
+const defaultText = `{{define "alert"}}{{.Headline}}
+
+{{.Description}}
+{{if .Instruction}}
+{{.Instruction}}
+{{end}}
+Areas: {{join .Zones "; "}}
+Severity: {{.Severity}}
+Sent: {{.Sent.Format "2006-01-02 15:04 MST"}}
+{{if not .Expires.IsZero}}Expires: {{.Expires.Format "2006-01-02 15:04 MST"}}
+{{end}}{{end}}{{define "digest"}}{{len .Alerts}} alert(s) from {{.Start.Format "2006-01-02 15:04 MST"}} to {{.End.Format "15:04 MST"}}
+{{range .Alerts}}
+------------------------------------------------------------
+{{template "alert" .}}{{end}}{{end}}`
+
+// Default HTML templates, defining the alert and digest templates.
+const defaultHTML = `{{define "alert"}}<h2>{{.Headline}}</h2>
+<p>{{.Description}}</p>
+{{if .Instruction}}<p><strong>{{.Instruction}}</strong></p>
+{{end}}<table>
+<tr><th align="left">Areas</th><td>{{join .Zones "; "}}</td></tr>
+<tr><th align="left">Severity</th><td>{{.Severity}}</td></tr>
+<tr><th align="left">Sent</th><td>{{.Sent.Format "2006-01-02 15:04 MST"}}</td></tr>
+{{if not .Expires.IsZero}}<tr><th align="left">Expires</th><td>{{.Expires.Format "2006-01-02 15:04 MST"}}</td></tr>
+{{end}}</table>{{end}}{{define "digest"}}<p>{{len .Alerts}} alert(s) from {{.Start.Format "2006-01-02 15:04 MST"}} to {{.End.Format "15:04 MST"}}</p>
+{{range .Alerts}}<hr>
+{{template "alert" .}}
+{{end}}{{end}}`
+
+// An Alert is the data the alert template is executed with.
+type Alert struct {
+	ID          string
+	Sender      string
+	Sent        time.Time
+	Event       string
+	Headline    string
+	Description string
+	Instruction string
+	Severity    string
+	Urgency     string
+	Certainty   string
+	Expires     time.Time
+
+	// Descriptions of the affected areas, and their UGC codes.
+	Zones []string
+	UGC   []string
+}
+
+// A Digest is the data the digest template is executed with.
+type Digest struct {
+	Start  time.Time
+	End    time.Time
+	Alerts []*Alert
+}
+
+// NewAlert returns the template data for the alert's info.
+func NewAlert(alert *capxml.Alert, info *capxml.Info) *Alert {
+	a := &Alert{
+		ID:          alert.ID(),
+		Sender:      info.SenderName,
+		Sent:        alert.Sent.Time,
+		Event:       info.Event,
+		Headline:    info.Headline,
+		Description: info.Description,
+		Instruction: info.Instruction,
+		Severity:    info.Severity.String(),
+		Urgency:     info.Urgency.String(),
+		Certainty:   info.Certainty.String(),
+		UGC:         notify.UGCs(info),
+	}
+	if a.Headline == "" {
+		a.Headline = info.Event
+	}
+	if info.Expires != nil {
+		a.Expires = info.Expires.Time
+	}
+
+	for _, area := range info.Areas {
+		for _, zone := range strings.Split(area.Description, ";") {
+			if zone = strings.TrimSpace(zone); zone != "" {
+				a.Zones = append(a.Zones, zone)
+			}
+		}
+	}
+
+	return a
+}
+
+// Templates render the text and HTML bodies of the emails. Each must
+// define an "alert" template, executed with an Alert, and a "digest"
+// template, executed with a Digest.
+type Templates struct {
+	Text *texttemplate.Template
+	HTML *htmltemplate.Template
+}
+
+var funcs = map[string]interface{}{
+	"join": strings.Join,
+}
+
+// LoadTemplates loads the templates from the files. If a filename is
+// empty, the default template is used.
+func LoadTemplates(textFile, htmlFile string) (*Templates, error) {
+	var err error
+	templates := new(Templates)
+
+	text := texttemplate.New("text").Funcs(funcs)
+	if textFile != "" {
+		templates.Text, err = text.ParseFiles(textFile)
+	} else {
+		templates.Text, err = text.Parse(defaultText)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	html := htmltemplate.New("html").Funcs(funcs)
+	if htmlFile != "" {
+		templates.HTML, err = html.ParseFiles(htmlFile)
+	} else {
+		templates.HTML, err = html.Parse(defaultHTML)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
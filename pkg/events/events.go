@@ -0,0 +1,241 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/alerting/alerts-nws/pkg/vtec"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+	"github.com/lovoo/goka"
+)
+
+// A State represents the state of an event.
+type State string
+
+const (
+	// StateActive represents an event that is in effect.
+	StateActive State = "active"
+
+	// StateCancelled represents an event that has been cancelled.
+	StateCancelled State = "cancelled"
+
+	// StateExpired represents an event that has been allowed to expire.
+	StateExpired State = "expired"
+
+	// StateUpgraded represents an event that has been upgraded to another event.
+	StateUpgraded State = "upgraded"
+)
+
+// An Update represents a change to an event, made by a single alert.
+type Update struct {
+	// Key of the event being updated.
+	Key string `json:"key"`
+
+	Action  vtec.Action `json:"action"`
+	AlertID string      `json:"alert_id"`
+	UGCs    []string    `json:"ugcs"`
+	Sent    time.Time   `json:"sent"`
+}
+
+// An Event represents a single hazard, tracked across the alerts
+// issued for it.
+type Event struct {
+	// Key of the event (office.phenomena.significance.etn.year).
+	Key string `json:"key"`
+
+	State      State       `json:"state"`
+	LastAction vtec.Action `json:"last_action"`
+
+	// IDs of the alerts issued for the event, in the order received.
+	AlertIDs []string `json:"alert_ids"`
+
+	// UGC codes of the zones where the event is active.
+	UGCs []string `json:"ugcs"`
+
+	First time.Time `json:"first"`
+	Last  time.Time `json:"last"`
+}
+
+// Key returns the key of the event the P-VTEC belongs to, for
+// an event first issued in the year.
+func Key(pvtec *vtec.PVTEC, year int) string {
+	return fmt.Sprintf("%s.%s.%s.%04d.%d",
+		pvtec.Office, pvtec.Phenomena, pvtec.Significance,
+		pvtec.EventTrackingNumber, year)
+}
+
+// A Lookup returns the event with the key, or nil if there is none.
+type Lookup func(key string) *Event
+
+// Resolve returns the key of the event the P-VTEC, sent at the time,
+// belongs to. The year of the key is the year the event was first
+// issued: the year new events are sent or, for updates, the year of
+// the event found with lookup, if any. Events remaining in effect over
+// New Year keep the previous year.
+func Resolve(pvtec *vtec.PVTEC, sent time.Time, lookup Lookup) string {
+	year := sent.UTC().Year()
+	if pvtec.Action != vtec.ActionNew && lookup != nil {
+		key := Key(pvtec, year-1)
+		if event := lookup(key); event != nil && event.State == StateActive && event.First.UTC().Year() < year {
+			return key
+		}
+	}
+	return Key(pvtec, year)
+}
+
+// Keys returns the keys of the info's P-VTEC events, in the order of
+// the P-VTEC strings. The keys added to the info's parameters (VTEC-key)
+// are used if present, otherwise they are resolved without a lookup.
+func Keys(alert *capxml.Alert, info *capxml.Info) ([]*vtec.PVTEC, []string) {
+	var pvtecs []*vtec.PVTEC
+	for _, str := range info.Parameters["VTEC"] {
+		parsed, err := vtec.ParseAllPVTEC(str)
+		if err != nil {
+			log.Printf("Unable to parse VTEC %q: %v", str, err)
+			continue
+		}
+		pvtecs = append(pvtecs, parsed...)
+	}
+
+	stored := info.Parameters["VTEC-key"]
+	keys := make([]string, len(pvtecs))
+	for i, pvtec := range pvtecs {
+		if len(stored) == len(pvtecs) && stored[i] != "" {
+			keys[i] = stored[i]
+		} else {
+			keys[i] = Resolve(pvtec, alert.Sent.Time, nil)
+		}
+	}
+	return pvtecs, keys
+}
+
+// Apply applies the update to the event.
+func (event *Event) Apply(update *Update) {
+	// Ignore duplicates
+	for _, id := range event.AlertIDs {
+		if id == update.AlertID {
+			return
+		}
+	}
+
+	event.Key = update.Key
+	event.AlertIDs = append(event.AlertIDs, update.AlertID)
+
+	if event.First.IsZero() || update.Sent.Before(event.First) {
+		event.First = update.Sent
+	}
+
+	// Updates may arrive out of order; only the latest
+	// update changes the state of the event.
+	if update.Sent.Before(event.Last) {
+		return
+	}
+	event.Last = update.Sent
+	event.LastAction = update.Action
+
+	ugcs := make(map[string]bool)
+	for _, ugc := range event.UGCs {
+		ugcs[ugc] = true
+	}
+
+	switch update.Action {
+	case vtec.ActionCancel, vtec.ActionExpire, vtec.ActionUpgrade:
+		for _, ugc := range update.UGCs {
+			delete(ugcs, ugc)
+		}
+	default:
+		for _, ugc := range update.UGCs {
+			ugcs[ugc] = true
+		}
+	}
+
+	event.UGCs = make([]string, 0, len(ugcs))
+	for ugc := range ugcs {
+		event.UGCs = append(event.UGCs, ugc)
+	}
+	sort.Strings(event.UGCs)
+
+	// The event remains active until no zones remain
+	event.State = StateActive
+	if len(event.UGCs) == 0 {
+		switch update.Action {
+		case vtec.ActionCancel:
+			event.State = StateCancelled
+		case vtec.ActionExpire:
+			event.State = StateExpired
+		case vtec.ActionUpgrade:
+			event.State = StateUpgraded
+		}
+	}
+}
+
+// UpdateCodec encodes and decodes updates.
+type UpdateCodec struct{}
+
+// Encode implements the goka.Codec interface.
+func (c *UpdateCodec) Encode(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case *Update:
+		return json.Marshal(v)
+	default:
+		return nil, errors.New("Unknown type provided")
+	}
+}
+
+// Decode implements the goka.Codec interface.
+func (c *UpdateCodec) Decode(data []byte) (interface{}, error) {
+	var update Update
+	err := json.Unmarshal(data, &update)
+	return &update, err
+}
+
+// EventCodec encodes and decodes events.
+type EventCodec struct{}
+
+// Encode implements the goka.Codec interface.
+func (c *EventCodec) Encode(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case *Event:
+		return json.Marshal(v)
+	default:
+		return nil, errors.New("Unknown type provided")
+	}
+}
+
+// Decode implements the goka.Codec interface.
+func (c *EventCodec) Decode(data []byte) (interface{}, error) {
+	var event Event
+	err := json.Unmarshal(data, &event)
+	return &event, err
+}
+
+func collect(gctx goka.Context, msg interface{}) {
+	update := msg.(*Update)
+
+	event, _ := gctx.Value().(*Event)
+	if event == nil {
+		event = new(Event)
+	}
+
+	event.Apply(update)
+	log.Printf("Event %s: %s (%s, %v)", event.Key, event.State, event.LastAction, event.UGCs)
+	gctx.SetValue(event)
+}
+
+// Define defines the processor group that keeps the event table, updated
+// from the updates in the topic. The updates must be keyed by event key.
+func Define(group goka.Group, topic goka.Stream) *goka.GroupGraph {
+	return goka.DefineGroup(group,
+		goka.Input(topic, new(UpdateCodec), collect),
+		goka.Persist(new(EventCodec)),
+	)
+}
+
+// NewView creates a view of the event table kept by the group.
+func NewView(brokers []string, group goka.Group, options ...goka.ViewOption) (*goka.View, error) {
+	return goka.NewView(brokers, goka.GroupTable(group), new(EventCodec), options...)
+}
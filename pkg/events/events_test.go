@@ -0,0 +1,216 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alerting/alerts-nws/pkg/vtec"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+func pvtec(t *testing.T, str string) *vtec.PVTEC {
+	p, err := vtec.ParsePVTEC(str)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func date(str string) time.Time {
+	t, _ := time.Parse(time.RFC3339, str)
+	return t
+}
+
+func TestResolve(t *testing.T) {
+	// The event table, with events first issued in December
+	table := map[string]*Event{
+		"KTOP.WS.W.0012.2019": {Key: "KTOP.WS.W.0012.2019", State: StateActive, First: date("2019-12-31T22:00:00Z")},
+		"KTOP.WS.W.0013.2019": {Key: "KTOP.WS.W.0013.2019", State: StateCancelled, First: date("2019-12-31T22:00:00Z")},
+	}
+	lookup := func(key string) *Event {
+		return table[key]
+	}
+
+	tests := []struct {
+		name   string
+		pvtec  string
+		sent   string
+		lookup Lookup
+		want   string
+	}{
+		{
+			"new",
+			"/O.NEW.KTOP.WS.W.0012.190528T2141Z-190529T1200Z/", "2019-05-28T21:41:00Z", lookup,
+			"KTOP.WS.W.0012.2019",
+		},
+		{
+			"new on New Year's Eve, beginning in January",
+			"/O.NEW.KTOP.WS.W.0001.200101T0600Z-200102T0000Z/", "2019-12-31T20:00:00Z", lookup,
+			"KTOP.WS.W.0001.2019",
+		},
+		{
+			"new in the local evening of New Year's Eve",
+			"/O.NEW.KTOP.WS.W.0001.200101T0300Z-200102T0000Z/", "2019-12-31T21:00:00-06:00", lookup,
+			"KTOP.WS.W.0001.2020",
+		},
+		{
+			"new in January, with last year's event active",
+			"/O.NEW.KTOP.WS.W.0012.200101T0600Z-200102T0000Z/", "2020-01-01T05:00:00Z", lookup,
+			"KTOP.WS.W.0012.2020",
+		},
+		{
+			"continued over New Year",
+			"/O.CON.KTOP.WS.W.0012.000000T0000Z-200101T1200Z/", "2020-01-01T03:00:00Z", lookup,
+			"KTOP.WS.W.0012.2019",
+		},
+		{
+			"continued over New Year, before it begins",
+			"/O.EXT.KTOP.WS.W.0012.200101T0600Z-200101T1800Z/", "2020-01-01T03:00:00Z", lookup,
+			"KTOP.WS.W.0012.2019",
+		},
+		{
+			"continued over New Year, without a lookup",
+			"/O.CON.KTOP.WS.W.0012.000000T0000Z-200101T1200Z/", "2020-01-01T03:00:00Z", nil,
+			"KTOP.WS.W.0012.2020",
+		},
+		{
+			"last year's event ended",
+			"/O.CON.KTOP.WS.W.0013.000000T0000Z-200101T1200Z/", "2020-01-01T03:00:00Z", lookup,
+			"KTOP.WS.W.0013.2020",
+		},
+		{
+			"unknown event",
+			"/O.CON.KTOP.WS.W.0014.000000T0000Z-200101T1200Z/", "2020-01-01T03:00:00Z", lookup,
+			"KTOP.WS.W.0014.2020",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Resolve(pvtec(t, test.pvtec), date(test.sent), test.lookup); got != test.want {
+				t.Errorf("Resolve() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestKeys(t *testing.T) {
+	alert := &capxml.Alert{Sent: capxml.Time{Time: date("2020-01-01T03:00:00Z")}}
+	info := &capxml.Info{
+		Parameters: capxml.KeyValue{
+			"VTEC": {"/O.CON.KTOP.WS.W.0012.000000T0000Z-200101T1200Z/\n/O.EXA.KTOP.WW.Y.0003.000000T0000Z-200101T1200Z/"},
+		},
+	}
+
+	pvtecs, keys := Keys(alert, info)
+	if want := []string{"KTOP.WS.W.0012.2020", "KTOP.WW.Y.0003.2020"}; len(pvtecs) != 2 || !reflect.DeepEqual(keys, want) {
+		t.Errorf("Keys() = %q, want %q", keys, want)
+	}
+
+	// The stored keys are used
+	info.Parameters["VTEC-key"] = []string{"KTOP.WS.W.0012.2019", "KTOP.WW.Y.0003.2019"}
+	if _, keys := Keys(alert, info); !reflect.DeepEqual(keys, info.Parameters["VTEC-key"]) {
+		t.Errorf("Keys() = %q, want the stored keys", keys)
+	}
+}
+
+func TestApply(t *testing.T) {
+	type step struct {
+		id     string
+		action vtec.Action
+		ugcs   []string
+		sent   string
+	}
+	tests := []struct {
+		name   string
+		steps  []step
+		state  State
+		last   vtec.Action
+		ugcs   []string
+		alerts int
+		first  string
+	}{
+		{
+			"new",
+			[]step{{"a", vtec.ActionNew, []string{"KSC161", "KSC149"}, "2019-05-28T21:00:00Z"}},
+			StateActive, vtec.ActionNew, []string{"KSC149", "KSC161"}, 1, "2019-05-28T21:00:00Z",
+		},
+		{
+			"extended in area",
+			[]step{
+				{"a", vtec.ActionNew, []string{"KSC161"}, "2019-05-28T21:00:00Z"},
+				{"b", vtec.ActionExtendArea, []string{"KSC177"}, "2019-05-28T21:30:00Z"},
+			},
+			StateActive, vtec.ActionExtendArea, []string{"KSC161", "KSC177"}, 2, "2019-05-28T21:00:00Z",
+		},
+		{
+			"partly cancelled",
+			[]step{
+				{"a", vtec.ActionNew, []string{"KSC161", "KSC149"}, "2019-05-28T21:00:00Z"},
+				{"b", vtec.ActionCancel, []string{"KSC149"}, "2019-05-28T21:30:00Z"},
+			},
+			StateActive, vtec.ActionCancel, []string{"KSC161"}, 2, "2019-05-28T21:00:00Z",
+		},
+		{
+			"cancelled",
+			[]step{
+				{"a", vtec.ActionNew, []string{"KSC161", "KSC149"}, "2019-05-28T21:00:00Z"},
+				{"b", vtec.ActionCancel, []string{"KSC161", "KSC149"}, "2019-05-28T21:30:00Z"},
+			},
+			StateCancelled, vtec.ActionCancel, []string{}, 2, "2019-05-28T21:00:00Z",
+		},
+		{
+			"expired",
+			[]step{
+				{"a", vtec.ActionNew, []string{"KSC161"}, "2019-05-28T21:00:00Z"},
+				{"b", vtec.ActionExpire, []string{"KSC161"}, "2019-05-28T22:00:00Z"},
+			},
+			StateExpired, vtec.ActionExpire, []string{}, 2, "2019-05-28T21:00:00Z",
+		},
+		{
+			"upgraded",
+			[]step{
+				{"a", vtec.ActionNew, []string{"KSC161"}, "2019-05-28T21:00:00Z"},
+				{"b", vtec.ActionUpgrade, []string{"KSC161"}, "2019-05-28T21:10:00Z"},
+			},
+			StateUpgraded, vtec.ActionUpgrade, []string{}, 2, "2019-05-28T21:00:00Z",
+		},
+		{
+			"out of order",
+			[]step{
+				{"b", vtec.ActionCancel, []string{"KSC161"}, "2019-05-28T21:30:00Z"},
+				{"a", vtec.ActionNew, []string{"KSC161"}, "2019-05-28T21:00:00Z"},
+			},
+			StateCancelled, vtec.ActionCancel, []string{}, 2, "2019-05-28T21:00:00Z",
+		},
+		{
+			"duplicate",
+			[]step{
+				{"a", vtec.ActionNew, []string{"KSC161"}, "2019-05-28T21:00:00Z"},
+				{"b", vtec.ActionCancel, []string{"KSC161"}, "2019-05-28T21:30:00Z"},
+				{"a", vtec.ActionNew, []string{"KSC161"}, "2019-05-28T21:40:00Z"},
+			},
+			StateCancelled, vtec.ActionCancel, []string{}, 2, "2019-05-28T21:00:00Z",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event := new(Event)
+			for _, s := range test.steps {
+				event.Apply(&Update{Key: "KTOP.TO.W.0012.2019", Action: s.action, AlertID: s.id, UGCs: s.ugcs, Sent: date(s.sent)})
+			}
+
+			if event.Key != "KTOP.TO.W.0012.2019" || event.State != test.state || event.LastAction != test.last {
+				t.Errorf("Event %s is %s after %s, want %s after %s", event.Key, event.State, event.LastAction, test.state, test.last)
+			}
+			if !reflect.DeepEqual(event.UGCs, test.ugcs) {
+				t.Errorf("UGCs = %q, want %q", event.UGCs, test.ugcs)
+			}
+			if len(event.AlertIDs) != test.alerts || !event.First.Equal(date(test.first)) {
+				t.Errorf("Alerts = %q, first %s, want %d alerts first %s", event.AlertIDs, event.First, test.alerts, test.first)
+			}
+		})
+	}
+}
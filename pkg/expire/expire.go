@@ -0,0 +1,272 @@
+package expire
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/lovoo/goka"
+)
+
+const (
+	// TypeExpired is the type of event emitted when an alert expires.
+	TypeExpired = "alert-expired"
+
+	// TypeEnded is the type of event emitted when an alert's event ends.
+	TypeEnded = "alert-ended"
+
+	// How often to check for expirations that are due.
+	sweepInterval = 30 * time.Second
+
+	// How long to remember that an alert was superseded.
+	supersededRetention = 7 * 24 * time.Hour
+)
+
+// A Schedule represents the upcoming expirations of an alert.
+type Schedule struct {
+	AlertID string `json:"alert_id"`
+	Event   string `json:"event"`
+
+	// Time the alert expires.
+	Expires time.Time `json:"expires"`
+
+	// Time the event ends, if known (ex. from VTEC).
+	Ends *time.Time `json:"ends,omitempty"`
+
+	ExpiredSent bool `json:"expired_sent,omitempty"`
+	EndedSent   bool `json:"ended_sent,omitempty"`
+
+	// The alert has been superseded or cancelled: nothing is emitted,
+	// and later schedules for the alert are ignored. The marker is
+	// removed once Expires passes.
+	Superseded bool `json:"superseded,omitempty"`
+}
+
+// A Message is a message on the schedule topic, keyed by alert ID.
+type Message struct {
+	// Schedule the expirations of the alert.
+	Schedule *Schedule `json:"schedule,omitempty"`
+
+	// The alert has been superseded or cancelled; remove its expirations.
+	Supersede bool `json:"supersede,omitempty"`
+
+	// Emit the expirations of the alert that are due.
+	Fire bool `json:"fire,omitempty"`
+}
+
+// An Expiration is emitted when an alert expires, or its event ends.
+type Expiration struct {
+	Type    string    `json:"type"`
+	AlertID string    `json:"alert_id"`
+	Event   string    `json:"event"`
+	Time    time.Time `json:"time"`
+}
+
+// MessageCodec encodes and decodes messages.
+type MessageCodec struct{}
+
+// Encode implements the goka.Codec interface.
+func (c *MessageCodec) Encode(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case *Message:
+		return json.Marshal(v)
+	default:
+		return nil, errors.New("Unknown type provided")
+	}
+}
+
+// Decode implements the goka.Codec interface.
+func (c *MessageCodec) Decode(data []byte) (interface{}, error) {
+	var msg Message
+	err := json.Unmarshal(data, &msg)
+	return &msg, err
+}
+
+// ScheduleCodec encodes and decodes schedules.
+type ScheduleCodec struct{}
+
+// Encode implements the goka.Codec interface.
+func (c *ScheduleCodec) Encode(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case *Schedule:
+		return json.Marshal(v)
+	default:
+		return nil, errors.New("Unknown type provided")
+	}
+}
+
+// Decode implements the goka.Codec interface.
+func (c *ScheduleCodec) Decode(data []byte) (interface{}, error) {
+	var schedule Schedule
+	err := json.Unmarshal(data, &schedule)
+	return &schedule, err
+}
+
+// ExpirationCodec encodes and decodes expirations.
+type ExpirationCodec struct{}
+
+// Encode implements the goka.Codec interface.
+func (c *ExpirationCodec) Encode(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case *Expiration:
+		return json.Marshal(v)
+	default:
+		return nil, errors.New("Unknown type provided")
+	}
+}
+
+// Decode implements the goka.Codec interface.
+func (c *ExpirationCodec) Decode(data []byte) (interface{}, error) {
+	var expiration Expiration
+	err := json.Unmarshal(data, &expiration)
+	return &expiration, err
+}
+
+// due returns whether any of the schedule's expirations are due
+// (or, for superseded alerts, whether the marker can be removed).
+func (schedule *Schedule) due(now time.Time) bool {
+	return (!schedule.ExpiredSent && !schedule.Expires.IsZero() && !now.Before(schedule.Expires)) ||
+		(!schedule.EndedSent && schedule.Ends != nil && !now.Before(*schedule.Ends))
+}
+
+func collect(expiredTopic goka.Stream) func(ctx goka.Context, msg interface{}) {
+	return func(gctx goka.Context, msg interface{}) {
+		m := msg.(*Message)
+
+		schedule, _ := gctx.Value().(*Schedule)
+		now := time.Now()
+
+		// Keep a marker, so the expirations of the alert
+		// aren't scheduled again if it arrives late
+		if m.Supersede {
+			if schedule == nil || !schedule.Superseded {
+				log.Printf("Removing expirations of superseded alert %s", gctx.Key())
+				gctx.SetValue(&Schedule{
+					AlertID:    gctx.Key(),
+					Expires:    now.Add(supersededRetention),
+					Superseded: true,
+				})
+			}
+			return
+		}
+
+		if m.Schedule != nil {
+			if schedule != nil && schedule.Superseded {
+				log.Printf("Ignoring expirations of superseded alert %s", gctx.Key())
+				return
+			}
+			gctx.SetValue(m.Schedule)
+			return
+		}
+
+		if !m.Fire || schedule == nil {
+			return
+		}
+
+		if schedule.Superseded {
+			if !now.Before(schedule.Expires) {
+				gctx.Delete()
+			}
+			return
+		}
+
+		if !schedule.EndedSent && schedule.Ends != nil && !now.Before(*schedule.Ends) {
+			log.Printf("Alert %s ended", schedule.AlertID)
+			gctx.Emit(expiredTopic, schedule.AlertID, &Expiration{
+				Type:    TypeEnded,
+				AlertID: schedule.AlertID,
+				Event:   schedule.Event,
+				Time:    *schedule.Ends,
+			})
+			schedule.EndedSent = true
+		}
+
+		if !schedule.ExpiredSent && !schedule.Expires.IsZero() && !now.Before(schedule.Expires) {
+			log.Printf("Alert %s expired", schedule.AlertID)
+			gctx.Emit(expiredTopic, schedule.AlertID, &Expiration{
+				Type:    TypeExpired,
+				AlertID: schedule.AlertID,
+				Event:   schedule.Event,
+				Time:    schedule.Expires,
+			})
+			schedule.ExpiredSent = true
+		}
+
+		// Keep the schedule until everything has been sent
+		if (schedule.ExpiredSent || schedule.Expires.IsZero()) && (schedule.EndedSent || schedule.Ends == nil) {
+			gctx.Delete()
+		} else {
+			gctx.SetValue(schedule)
+		}
+	}
+}
+
+// Define defines the processor group that keeps the table of upcoming
+// expirations, from the messages in the schedule topic, and emits the
+// expirations to the expired topic.
+func Define(group goka.Group, scheduleTopic, expiredTopic goka.Stream) *goka.GroupGraph {
+	return goka.DefineGroup(group,
+		goka.Input(scheduleTopic, new(MessageCodec), collect(expiredTopic)),
+		goka.Output(expiredTopic, new(ExpirationCodec)),
+		goka.Persist(new(ScheduleCodec)),
+	)
+}
+
+// Sweep periodically checks the group's table for expirations that are
+// due, requesting them to be emitted through the schedule topic. Since the
+// schedules are kept in the table, expirations that become due while the
+// processor is stopped are emitted once it is restarted.
+func Sweep(ctx context.Context, brokers []string, group goka.Group, scheduleTopic goka.Stream) error {
+	view, err := goka.NewView(brokers, goka.GroupTable(group), new(ScheduleCodec))
+	if err != nil {
+		return err
+	}
+
+	emitter, err := goka.NewEmitter(brokers, scheduleTopic, new(MessageCodec))
+	if err != nil {
+		return err
+	}
+	defer emitter.Finish()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- view.Run(ctx)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
+			return err
+		case <-time.After(sweepInterval):
+		}
+
+		if !view.Recovered() {
+			continue
+		}
+
+		it, err := view.Iterator()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for it.Next() {
+			value, err := it.Value()
+			if err != nil {
+				log.Println("Unable to read schedule:", err)
+				continue
+			}
+
+			if schedule, ok := value.(*Schedule); ok && schedule.due(now) {
+				if _, err := emitter.Emit(it.Key(), &Message{Fire: true}); err != nil {
+					log.Println("Unable to request expiration:", err)
+				}
+			}
+		}
+		it.Release()
+	}
+}
@@ -0,0 +1,151 @@
+package expire
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka"
+)
+
+// An emitted is a message emitted by the processor.
+type emitted struct {
+	topic goka.Stream
+	key   string
+	value interface{}
+}
+
+// testContext is a goka.Context for a single message, backed by a table.
+type testContext struct {
+	table   map[string]interface{}
+	key     string
+	emitted *[]emitted
+}
+
+func (c *testContext) Topic() goka.Stream                              { return "" }
+func (c *testContext) Key() string                                     { return c.key }
+func (c *testContext) Partition() int32                                { return 0 }
+func (c *testContext) Offset() int64                                   { return 0 }
+func (c *testContext) Value() interface{}                              { return c.table[c.key] }
+func (c *testContext) SetValue(value interface{})                      { c.table[c.key] = value }
+func (c *testContext) Delete()                                         { delete(c.table, c.key) }
+func (c *testContext) Timestamp() time.Time                            { return time.Time{} }
+func (c *testContext) Join(topic goka.Table) interface{}               { return nil }
+func (c *testContext) Lookup(topic goka.Table, key string) interface{} { return nil }
+func (c *testContext) Loopback(key string, value interface{})          {}
+func (c *testContext) Fail(err error)                                  { panic(err) }
+func (c *testContext) Context() context.Context                        { return context.Background() }
+func (c *testContext) Emit(topic goka.Stream, key string, value interface{}) {
+	*c.emitted = append(*c.emitted, emitted{topic, key, value})
+}
+
+// processor sends the messages for the alert to collect.
+type processor struct {
+	table   map[string]interface{}
+	emitted []emitted
+}
+
+func (p *processor) send(key string, msg *Message) {
+	collect("expired")(&testContext{table: p.table, key: key, emitted: &p.emitted}, msg)
+}
+
+func TestSuperseded(t *testing.T) {
+	p := &processor{table: make(map[string]interface{})}
+	past := time.Now().Add(-time.Minute)
+
+	p.send("a", &Message{Schedule: &Schedule{AlertID: "a", Event: "Tornado Warning", Expires: past, Ends: &past}})
+	p.send("a", &Message{Supersede: true})
+
+	// The schedule is replaced by the marker
+	marker, _ := p.table["a"].(*Schedule)
+	if marker == nil || !marker.Superseded || marker.Expires.Before(time.Now().Add(supersededRetention-time.Minute)) {
+		t.Fatalf("Schedule = %+v, want a superseded marker", p.table["a"])
+	}
+	if marker.due(time.Now()) {
+		t.Error("Marker is due before it expires")
+	}
+
+	// The schedule arriving late is ignored, and nothing fires
+	p.send("a", &Message{Schedule: &Schedule{AlertID: "a", Event: "Tornado Warning", Expires: past, Ends: &past}})
+	p.send("a", &Message{Fire: true})
+	if len(p.emitted) != 0 {
+		t.Errorf("Emitted %+v for a superseded alert", p.emitted)
+	}
+	if p.table["a"] != marker {
+		t.Errorf("Schedule = %+v, want the marker kept", p.table["a"])
+	}
+
+	// Superseding again keeps the marker
+	p.send("a", &Message{Supersede: true})
+	if p.table["a"] != marker {
+		t.Errorf("Schedule = %+v, want the marker kept", p.table["a"])
+	}
+
+	// The marker is removed once it expires
+	marker.Expires = past
+	if !marker.due(time.Now()) {
+		t.Error("Expired marker is not due")
+	}
+	p.send("a", &Message{Fire: true})
+	if _, ok := p.table["a"]; ok || len(p.emitted) != 0 {
+		t.Errorf("Schedule = %+v, emitted %+v, want the marker removed", p.table["a"], p.emitted)
+	}
+}
+
+func TestEndedThenExpired(t *testing.T) {
+	p := &processor{table: make(map[string]interface{})}
+	ends := time.Now().Add(-time.Minute)
+	expires := time.Now().Add(time.Hour)
+
+	p.send("a", &Message{Schedule: &Schedule{AlertID: "a", Event: "Flood Warning", Expires: expires, Ends: &ends}})
+	schedule := p.table["a"].(*Schedule)
+	if !schedule.due(time.Now()) {
+		t.Fatal("Ended schedule is not due")
+	}
+
+	// The event has ended, but the alert hasn't expired
+	p.send("a", &Message{Fire: true})
+	p.send("a", &Message{Fire: true})
+	if len(p.emitted) != 1 {
+		t.Fatalf("Emitted %d expirations, want 1", len(p.emitted))
+	}
+	if e := p.emitted[0]; e.topic != "expired" || e.key != "a" ||
+		*e.value.(*Expiration) != (Expiration{Type: TypeEnded, AlertID: "a", Event: "Flood Warning", Time: ends}) {
+		t.Errorf("Emitted %+v, want the alert ended", e.value)
+	}
+	if schedule.due(time.Now()) {
+		t.Error("Schedule is due once ended")
+	}
+
+	// Then the alert expires
+	schedule.Expires = time.Now().Add(-time.Second)
+	p.send("a", &Message{Fire: true})
+	p.send("a", &Message{Fire: true})
+	if len(p.emitted) != 2 {
+		t.Fatalf("Emitted %d expirations, want 2", len(p.emitted))
+	}
+	if e := p.emitted[1].value.(*Expiration); e.Type != TypeExpired || e.AlertID != "a" || !e.Time.Equal(schedule.Expires) {
+		t.Errorf("Emitted %+v, want the alert expired", e)
+	}
+	if _, ok := p.table["a"]; ok {
+		t.Errorf("Schedule kept once everything was sent: %+v", p.table["a"])
+	}
+}
+
+func TestFireNotDue(t *testing.T) {
+	p := &processor{table: make(map[string]interface{})}
+
+	// Nothing is due, or scheduled
+	p.send("a", &Message{Schedule: &Schedule{AlertID: "a", Expires: time.Now().Add(time.Hour)}})
+	p.send("a", &Message{Fire: true})
+	p.send("b", &Message{Fire: true})
+	if len(p.emitted) != 0 {
+		t.Errorf("Emitted %+v before the alert expired", p.emitted)
+	}
+	if _, ok := p.table["a"]; !ok {
+		t.Error("Schedule removed before the alert expired")
+	}
+	if _, ok := p.table["b"]; ok {
+		t.Error("Fire created a schedule")
+	}
+}
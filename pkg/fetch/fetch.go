@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/xml"
 	"errors"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
@@ -27,27 +28,46 @@ type Config struct {
 
 	AlertsTopic string
 	FetchURLs   []string
+
+	// Topic of the fetched bytes, keyed by alert ID. Optional.
+	RawTopic string
+}
+
+// RawCodec encodes the fetched bytes of alerts as is.
+type RawCodec struct{}
+
+func (c *RawCodec) Encode(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case []byte:
+		return v, nil
+	default:
+		return nil, errors.New("Unknown type provided")
+	}
+}
+
+func (c *RawCodec) Decode(data []byte) (interface{}, error) {
+	return data, nil
 }
 
-func fetch(ctx context.Context, conf *Config, ref *capxml.Reference) (*capxml.Alert, error) {
+func fetch(ctx context.Context, conf *Config, ref *capxml.Reference) (*capxml.Alert, []byte, error) {
 	// Generate the URL
 	resourceURL, err := url.Parse(ref.Identifier)
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	for i, fetchURL := range conf.FetchURLs {
 		baseURL, err := url.Parse(fetchURL)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		u := baseURL.ResolveReference(resourceURL)
 
 		log.Printf("Fetching %s", u.String())
 		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		req.Header.Set("User-Agent", "ZacharySeguinAlerts/1.0 (https://alerts.zacharyseguin.ca; contact@zacharyseguin.ca)")
@@ -55,7 +75,7 @@ func fetch(ctx context.Context, conf *Config, ref *capxml.Reference) (*capxml.Al
 
 		res, err := http.DefaultClient.Do(req)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		defer res.Body.Close()
 
@@ -63,21 +83,25 @@ func fetch(ctx context.Context, conf *Config, ref *capxml.Reference) (*capxml.Al
 		if res.StatusCode != 200 {
 			// If it's the last alert, and we have a 404
 			if res.StatusCode == 404 && i == len(conf.FetchURLs)-1 {
-				return nil, notFoundError
+				return nil, nil, notFoundError
 			}
 			continue
 		}
 
-		// Parse the alert
+		// Parse the alert, keeping the fetched bytes
+		data, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return nil, nil, err
+		}
+
 		var alert capxml.Alert
-		decoder := xml.NewDecoder(res.Body)
-		err = decoder.Decode(&alert)
+		err = xml.Unmarshal(data, &alert)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		return &alert, nil
+		return &alert, data, nil
 	}
-	return nil, errors.New("Unable to fetch alert")
+	return nil, nil, errors.New("Unable to fetch alert")
 }
 
 func collect(ctx context.Context, conf *Config) func(ctx goka.Context, msg interface{}) {
@@ -92,7 +116,7 @@ func collect(ctx context.Context, conf *Config) func(ctx goka.Context, msg inter
 
 		log.Printf("Received: %v, %v => %v", gctx.Topic(), gctx.Key(), ref)
 
-		alert, err := fetch(ctx, conf, &ref)
+		alert, data, err := fetch(ctx, conf, &ref)
 		if err != nil {
 			if err == notFoundError {
 				log.Printf("Alert not found: %v", ref)
@@ -101,7 +125,7 @@ func collect(ctx context.Context, conf *Config) func(ctx goka.Context, msg inter
 				time.Sleep(15 * time.Second)
 				log.Println(err)
 
-				alert, err = fetch(ctx, conf, &ref)
+				alert, data, err = fetch(ctx, conf, &ref)
 				if err != nil {
 					log.Println(err)
 					return
@@ -111,6 +135,9 @@ func collect(ctx context.Context, conf *Config) func(ctx goka.Context, msg inter
 		}
 
 		gctx.Emit(goka.Stream(conf.AlertsTopic), alert.ID(), alert)
+		if conf.RawTopic != "" {
+			gctx.Emit(goka.Stream(conf.RawTopic), alert.ID(), data)
+		}
 	}
 }
 
@@ -120,6 +147,9 @@ func Run(ctx context.Context, conf Config) error {
 		goka.Output(goka.Stream(conf.RetryTopic), new(codec.Reference)),
 		goka.Output(goka.Stream(conf.AlertsTopic), new(codec.Alert)),
 	}
+	if conf.RawTopic != "" {
+		edges = append(edges, goka.Output(goka.Stream(conf.RawTopic), new(RawCodec)))
+	}
 
 	kconf := kafka.NewConfig()
 	// 5 MB
@@ -0,0 +1,72 @@
+package gauges
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A Gauge represents a river gauge, identified by its NWS location identifier.
+type Gauge struct {
+	NWSLI string
+	Lat   float64
+	Lon   float64
+	River string
+}
+
+// Load loads the gauges from a CSV file, with the columns
+// NWSLI, latitude, longitude and river name.
+// A header row, if present, is skipped.
+func Load(filename string) (map[string]*Gauge, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	gauges := make(map[string]*Gauge)
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(record) < 4 {
+			return nil, fmt.Errorf("%s:%d: expected 4 columns, got %d", filename, line, len(record))
+		}
+
+		lat, err := strconv.ParseFloat(record[1], 64)
+		if err != nil {
+			// Skip the header
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("%s:%d: %v", filename, line, err)
+		}
+
+		lon, err := strconv.ParseFloat(record[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", filename, line, err)
+		}
+
+		nwsli := strings.ToUpper(strings.TrimSpace(record[0]))
+		gauges[nwsli] = &Gauge{
+			NWSLI: nwsli,
+			Lat:   lat,
+			Lon:   lon,
+			River: strings.TrimSpace(record[3]),
+		}
+	}
+
+	return gauges, nil
+}
@@ -0,0 +1,365 @@
+package kml
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alerting/alerts-nws/pkg/active"
+	"github.com/alerting/alerts-nws/pkg/archive"
+	"github.com/alerting/alerts-nws/pkg/zones"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+	"github.com/lovoo/goka"
+)
+
+const (
+	namespace = "http://www.opengis.net/kml/2.2"
+
+	// Opacity of the polygons' fill and outline (0 to 255).
+	fillOpacity = 0x80
+	lineOpacity = 0xff
+
+	// Format of the times shown in the balloons.
+	timeFormat = "Mon Jan 2 3:04 PM MST"
+)
+
+// Config is the configuration for the KML file sink.
+type Config struct {
+	// The active alerts table (see active.Config).
+	Active active.Config
+
+	// Zone geometries, for alerts without polygons.
+	Zones *zones.Store
+
+	// File to write; a KMZ if it ends in .kmz.
+	Output string
+
+	// How often the file is rewritten.
+	Interval time.Duration
+
+	// Name of the document.
+	Name string
+
+	// Only the alerts matching the filter are written, if set.
+	Filter *active.Filter
+}
+
+type cdata struct {
+	Value string `xml:",cdata"`
+}
+
+type lineStyle struct {
+	Color string `xml:"color"`
+	Width int    `xml:"width"`
+}
+
+type polyStyle struct {
+	Color string `xml:"color"`
+}
+
+type style struct {
+	ID        string    `xml:"id,attr"`
+	LineStyle lineStyle `xml:"LineStyle"`
+	PolyStyle polyStyle `xml:"PolyStyle"`
+}
+
+type linearRing struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type boundary struct {
+	LinearRing linearRing `xml:"LinearRing"`
+}
+
+type polygon struct {
+	OuterBoundaryIs boundary   `xml:"outerBoundaryIs"`
+	InnerBoundaryIs []boundary `xml:"innerBoundaryIs"`
+}
+
+type multiGeometry struct {
+	Polygons []polygon `xml:"Polygon"`
+}
+
+type timeSpan struct {
+	Begin string `xml:"begin,omitempty"`
+	End   string `xml:"end,omitempty"`
+}
+
+type placemark struct {
+	Name          string        `xml:"name"`
+	Description   cdata         `xml:"description"`
+	StyleURL      string        `xml:"styleUrl"`
+	TimeSpan      *timeSpan     `xml:"TimeSpan,omitempty"`
+	MultiGeometry multiGeometry `xml:"MultiGeometry"`
+}
+
+type folder struct {
+	Name       string       `xml:"name"`
+	Placemarks []*placemark `xml:"Placemark"`
+}
+
+type document struct {
+	Name    string    `xml:"name"`
+	Styles  []style   `xml:"Style"`
+	Folders []*folder `xml:"Folder"`
+}
+
+type kml struct {
+	XMLName  xml.Name `xml:"kml"`
+	XMLNS    string   `xml:"xmlns,attr"`
+	Document document `xml:"Document"`
+}
+
+// styleID returns the ID of the event's style.
+func styleID(event string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '-'
+	}, strings.TrimSpace(event))
+}
+
+// coordinates formats the ring as KML coordinates.
+func coordinates(ring [][]float64) string {
+	coords := make([]string, 0, len(ring))
+	for _, c := range ring {
+		if len(c) < 2 {
+			continue
+		}
+		coords = append(coords, strconv.FormatFloat(c[0], 'f', -1, 64)+","+strconv.FormatFloat(c[1], 'f', -1, 64))
+	}
+	return strings.Join(coords, " ")
+}
+
+// clockwise returns whether the points of the ring go clockwise.
+func clockwise(ring [][]float64) bool {
+	var area float64
+	for i := range ring {
+		a, b := ring[i], ring[(i+1)%len(ring)]
+		if len(a) < 2 || len(b) < 2 {
+			continue
+		}
+		area += (b[0] - a[0]) * (b[1] + a[1])
+	}
+	return area > 0
+}
+
+// polygons converts the rings of the polygon to KML polygons. The first
+// ring is an outer boundary; the rings wound the other way are holes in
+// the last outer boundary, and the rings wound the same way start another
+// polygon.
+func polygons(p *capxml.Polygon) []polygon {
+	var (
+		polygons []polygon
+		outer    bool
+	)
+	for _, ring := range p.Coordinates {
+		coords := coordinates(ring)
+		if coords == "" {
+			continue
+		}
+
+		b := boundary{LinearRing: linearRing{Coordinates: coords}}
+		if len(polygons) > 0 && clockwise(ring) != outer {
+			last := &polygons[len(polygons)-1]
+			last.InnerBoundaryIs = append(last.InnerBoundaryIs, b)
+			continue
+		}
+		if len(polygons) == 0 {
+			outer = clockwise(ring)
+		}
+		polygons = append(polygons, polygon{OuterBoundaryIs: b})
+	}
+	return polygons
+}
+
+// geometry returns the polygons of the info. Areas with polygons are
+// drawn with them, and the other areas with the polygons of their zones.
+func geometry(info *capxml.Info, set *zones.Set) multiGeometry {
+	var (
+		geometry multiGeometry
+		seen     = make(map[*capxml.Polygon]bool)
+	)
+	add := func(p *capxml.Polygon) {
+		if !seen[p] {
+			seen[p] = true
+			geometry.Polygons = append(geometry.Polygons, polygons(p)...)
+		}
+	}
+
+	for _, area := range info.Areas {
+		if len(area.Polygons) > 0 {
+			for _, p := range area.Polygons {
+				add(p)
+			}
+			continue
+		}
+
+		if set == nil {
+			continue
+		}
+		for _, ugc := range area.GeoCodes["UGC"] {
+			if p, ok := set.Polygons[ugc]; ok {
+				add(p)
+			}
+		}
+	}
+	return geometry
+}
+
+// balloon returns the HTML shown in the placemark's balloon.
+func balloon(info *capxml.Info, begin, end time.Time) string {
+	var b strings.Builder
+	if info.Headline != "" {
+		fmt.Fprintf(&b, "<h3>%s</h3>", html.EscapeString(info.Headline))
+	}
+
+	b.WriteString("<p>")
+	fmt.Fprintf(&b, "<b>Begins:</b> %s<br/>", html.EscapeString(begin.Format(timeFormat)))
+	if !end.IsZero() {
+		fmt.Fprintf(&b, "<b>Ends:</b> %s<br/>", html.EscapeString(end.In(begin.Location()).Format(timeFormat)))
+	}
+	fmt.Fprintf(&b, "<b>Severity:</b> %s, <b>Urgency:</b> %s, <b>Certainty:</b> %s",
+		info.Severity.String(), info.Urgency.String(), info.Certainty.String())
+	b.WriteString("</p>")
+
+	if info.Instruction != "" {
+		fmt.Fprintf(&b, "<p>%s</p>", strings.Replace(html.EscapeString(info.Instruction), "\n", "<br/>", -1))
+	}
+	return b.String()
+}
+
+// Render renders the alerts as a KML document, with a placemark for each
+// of their infos with a geometry, grouped into folders by event. Areas
+// without polygons are drawn using the polygons of their zones in the set.
+func Render(name string, alerts []*capxml.Alert, set *zones.Set) ([]byte, error) {
+	folders := make(map[string]*folder)
+	for _, alert := range alerts {
+		for _, info := range alert.Infos {
+			geometry := geometry(info, set)
+			if len(geometry.Polygons) == 0 {
+				continue
+			}
+
+			begin, end := active.Span(alert, info)
+			pm := &placemark{
+				Name:          info.Event,
+				Description:   cdata{Value: balloon(info, begin, end)},
+				StyleURL:      "#" + styleID(info.Event),
+				TimeSpan:      &timeSpan{Begin: begin.Format(time.RFC3339)},
+				MultiGeometry: geometry,
+			}
+			if info.Headline != "" {
+				pm.Name = info.Headline
+			}
+			if !end.IsZero() {
+				pm.TimeSpan.End = end.Format(time.RFC3339)
+			}
+
+			f, ok := folders[info.Event]
+			if !ok {
+				f = &folder{Name: info.Event}
+				folders[info.Event] = f
+			}
+			f.Placemarks = append(f.Placemarks, pm)
+		}
+	}
+
+	doc := &kml{
+		XMLNS:    namespace,
+		Document: document{Name: name},
+	}
+	for event, f := range folders {
+		doc.Document.Folders = append(doc.Document.Folders, f)
+		doc.Document.Styles = append(doc.Document.Styles, style{
+			ID:        styleID(event),
+			LineStyle: lineStyle{Color: kmlColor(Color(event), lineOpacity), Width: 2},
+			PolyStyle: polyStyle{Color: kmlColor(Color(event), fillOpacity)},
+		})
+	}
+	sort.Slice(doc.Document.Folders, func(i, j int) bool {
+		return doc.Document.Folders[i].Name < doc.Document.Folders[j].Name
+	})
+	sort.Slice(doc.Document.Styles, func(i, j int) bool {
+		return doc.Document.Styles[i].ID < doc.Document.Styles[j].ID
+	})
+
+	b, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(b, '\n')...), nil
+}
+
+// Zip packages the KML document as a KMZ.
+func Zip(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+
+	f, err := w.Create("doc.kml")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Export writes the alerts to the file, as a KMZ if it ends in .kmz,
+// or else as KML.
+func Export(file, name string, alerts []*capxml.Alert, set *zones.Set) error {
+	data, err := Render(name, alerts, set)
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(filepath.Ext(file), ".kmz") {
+		if data, err = Zip(data); err != nil {
+			return err
+		}
+	}
+	return archive.WriteFile(file, data)
+}
+
+// Run runs the processor keeping the active alerts, and
+// rewrites the file with the alerts periodically.
+func Run(ctx context.Context, conf Config) error {
+	return active.Run(ctx, conf.Active, func(ctx context.Context, view *goka.View) error {
+		for {
+			alerts, err := active.Alerts(view, conf.Filter)
+			if err != nil {
+				return err
+			}
+
+			if err := Export(conf.Output, conf.Name, alerts, conf.Zones.Load()); err != nil {
+				log.Printf("Unable to write %s: %v", conf.Output, err)
+			} else {
+				log.Printf("Wrote %d alert(s) to %s", len(alerts), conf.Output)
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(conf.Interval):
+			}
+		}
+	})
+}
@@ -0,0 +1,221 @@
+package kml
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alerting/alerts-nws/pkg/zones"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+func TestColor(t *testing.T) {
+	tests := []struct {
+		event string
+		want  string
+	}{
+		{"Tornado Warning", "FF0000"},
+		{"tornado warning", "FF0000"},
+		{" Flood Warning ", "00FF00"},
+		{"Unknown Event", DefaultColor},
+		{"", DefaultColor},
+	}
+
+	for _, test := range tests {
+		if got := Color(test.event); got != test.want {
+			t.Errorf("Color(%q) = %s, want %s", test.event, got, test.want)
+		}
+	}
+}
+
+func TestKMLColor(t *testing.T) {
+	tests := []struct {
+		rgb     string
+		opacity int
+		want    string
+	}{
+		{"FF0000", 0xff, "ff0000ff"},
+		{"00FF7F", 0x80, "807fff00"},
+		{"8B008B", 0x80, "808b008b"},
+		{"invalid", 0xff, "ffc0c0c0"},
+	}
+
+	for _, test := range tests {
+		if got := kmlColor(test.rgb, test.opacity); got != test.want {
+			t.Errorf("kmlColor(%q, %#x) = %s, want %s", test.rgb, test.opacity, got, test.want)
+		}
+	}
+}
+
+func TestStyleID(t *testing.T) {
+	tests := map[string]string{
+		"Tornado Warning":                        "tornado-warning",
+		" Urban And Small Stream Flood Advisory": "urban-and-small-stream-flood-advisory",
+		"Aviso de Tornado (Prueba)":              "aviso-de-tornado--prueba-",
+	}
+
+	for event, want := range tests {
+		if got := styleID(event); got != want {
+			t.Errorf("styleID(%q) = %s, want %s", event, got, want)
+		}
+	}
+}
+
+// square returns a ring around (lon, lat), clockwise if cw.
+func square(lon, lat, size float64, cw bool) [][]float64 {
+	ring := [][]float64{
+		{lon, lat},
+		{lon + size, lat},
+		{lon + size, lat + size},
+		{lon, lat + size},
+		{lon, lat},
+	}
+	if cw {
+		for i, j := 0, len(ring)-1; i < j; i, j = i+1, j-1 {
+			ring[i], ring[j] = ring[j], ring[i]
+		}
+	}
+	return ring
+}
+
+func TestPolygons(t *testing.T) {
+	p := &capxml.Polygon{
+		Coordinates: [][][]float64{
+			square(-97, 39, 1, false),
+			square(-96.75, 39.25, 0.5, true),
+			square(-95, 39, 1, false),
+			square(-94.75, 39.25, 0.25, true),
+			square(-94.5, 39.5, 0.25, true),
+		},
+	}
+
+	got := polygons(p)
+	if len(got) != 2 {
+		t.Fatalf("polygons() = %d polygons, want 2: %+v", len(got), got)
+	}
+	if len(got[0].InnerBoundaryIs) != 1 || len(got[1].InnerBoundaryIs) != 2 {
+		t.Errorf("polygons() holes = %d, %d, want 1, 2", len(got[0].InnerBoundaryIs), len(got[1].InnerBoundaryIs))
+	}
+	if want := "-97,39 -96,39 -96,40 -97,40 -97,39"; got[0].OuterBoundaryIs.LinearRing.Coordinates != want {
+		t.Errorf("Outer boundary = %s, want %s", got[0].OuterBoundaryIs.LinearRing.Coordinates, want)
+	}
+	if want := "-96.75,39.25 -96.75,39.75 -96.25,39.75 -96.25,39.25 -96.75,39.25"; got[0].InnerBoundaryIs[0].LinearRing.Coordinates != want {
+		t.Errorf("Inner boundary = %s, want %s", got[0].InnerBoundaryIs[0].LinearRing.Coordinates, want)
+	}
+
+	// The orientation is relative to the first ring
+	p.Coordinates[0], p.Coordinates[1] = square(-97, 39, 1, true), square(-96.75, 39.25, 0.5, false)
+	p.Coordinates = p.Coordinates[:2]
+	if got := polygons(p); len(got) != 1 || len(got[0].InnerBoundaryIs) != 1 {
+		t.Errorf("polygons() of a clockwise polygon = %+v, want a polygon with a hole", got)
+	}
+}
+
+func TestGeometry(t *testing.T) {
+	set := &zones.Set{
+		Polygons: map[string]*capxml.Polygon{
+			"KSC161": {Coordinates: [][][]float64{square(-97, 39, 1, false)}},
+			"KSC149": {Coordinates: [][][]float64{square(-96, 39, 1, false)}},
+		},
+	}
+	drawn := &capxml.Polygon{Coordinates: [][][]float64{square(-96.5, 39.5, 0.1, false)}}
+
+	info := &capxml.Info{
+		Areas: []*capxml.Area{
+			{Polygons: []*capxml.Polygon{drawn}, GeoCodes: capxml.KeyValue{"UGC": {"KSC161"}}},
+			{GeoCodes: capxml.KeyValue{"UGC": {"KSC149", "KSC177"}}},
+			{GeoCodes: capxml.KeyValue{"UGC": {"KSC149"}}},
+		},
+	}
+
+	// The area with a polygon uses it; the other areas use their zones, once
+	var want []polygon
+	for _, p := range []*capxml.Polygon{drawn, set.Polygons["KSC149"]} {
+		want = append(want, polygons(p)...)
+	}
+	if got := geometry(info, set); !reflect.DeepEqual(got.Polygons, want) {
+		t.Errorf("geometry() = %+v, want %+v", got.Polygons, want)
+	}
+
+	// Without zones, only the polygons are drawn
+	if got := geometry(info, nil); len(got.Polygons) != 1 {
+		t.Errorf("geometry() without zones = %d polygons, want 1", len(got.Polygons))
+	}
+}
+
+func TestRender(t *testing.T) {
+	area := func() []*capxml.Area {
+		return []*capxml.Area{
+			{Polygons: []*capxml.Polygon{{Coordinates: [][][]float64{square(-97, 39, 1, false)}}}},
+		}
+	}
+	sent := capxml.Time{Time: time.Date(2019, 5, 28, 21, 41, 0, 0, time.UTC)}
+
+	alerts := []*capxml.Alert{
+		{
+			Identifier: "a",
+			Sent:       sent,
+			Infos: []*capxml.Info{
+				{Event: "Tornado Warning", Headline: "Tornado Warning for Riley", Areas: area()},
+				{Event: "Severe Thunderstorm Warning", Areas: area()},
+				{Event: "Special Weather Statement"},
+			},
+		},
+		{
+			Identifier: "b",
+			Sent:       sent,
+			Infos: []*capxml.Info{
+				{Event: "Tornado Warning", Headline: "Tornado Warning for Geary", Areas: area()},
+			},
+		},
+	}
+
+	data, err := Render("Alerts", alerts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), xml.Header) {
+		t.Error("Render() is missing the XML header")
+	}
+
+	var doc kml
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.XMLName.Space != namespace || doc.Document.Name != "Alerts" {
+		t.Errorf("Document = %v %q", doc.XMLName, doc.Document.Name)
+	}
+
+	// A folder per event, in order, without the event lacking a geometry
+	var folders []string
+	for _, f := range doc.Document.Folders {
+		folders = append(folders, f.Name)
+	}
+	if want := []string{"Severe Thunderstorm Warning", "Tornado Warning"}; !reflect.DeepEqual(folders, want) {
+		t.Fatalf("Folders = %q, want %q", folders, want)
+	}
+
+	tornado := doc.Document.Folders[1]
+	if len(tornado.Placemarks) != 2 || tornado.Placemarks[0].Name != "Tornado Warning for Riley" || tornado.Placemarks[1].Name != "Tornado Warning for Geary" {
+		t.Errorf("Tornado Warning placemarks = %+v", tornado.Placemarks)
+	}
+	for _, pm := range tornado.Placemarks {
+		if pm.StyleURL != "#tornado-warning" {
+			t.Errorf("Placemark %q has style %s", pm.Name, pm.StyleURL)
+		}
+	}
+	if pm := doc.Document.Folders[0].Placemarks[0]; pm.Name != "Severe Thunderstorm Warning" || pm.StyleURL != "#severe-thunderstorm-warning" {
+		t.Errorf("Severe Thunderstorm Warning placemark = %s, %s", pm.Name, pm.StyleURL)
+	}
+
+	// A style per event, in order, with the event's colour
+	want := []style{
+		{ID: "severe-thunderstorm-warning", LineStyle: lineStyle{Color: "ff00a5ff", Width: 2}, PolyStyle: polyStyle{Color: "8000a5ff"}},
+		{ID: "tornado-warning", LineStyle: lineStyle{Color: "ff0000ff", Width: 2}, PolyStyle: polyStyle{Color: "800000ff"}},
+	}
+	if !reflect.DeepEqual(doc.Document.Styles, want) {
+		t.Errorf("Styles = %+v, want %+v", doc.Document.Styles, want)
+	}
+}
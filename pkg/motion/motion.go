@@ -0,0 +1,221 @@
+// Package motion parses the NWS eventMotionDescription parameter and
+// projects the storm's track forward.
+package motion
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+const (
+	// Mean radius of the earth, in metres.
+	earthRadius = 6371000.0
+
+	// Metres per second in a knot.
+	knot = 1852.0 / 3600.0
+)
+
+// A Point is a location, in degrees.
+type Point struct {
+	Lat float64
+	Lon float64
+}
+
+// String returns the point in CAP format (lat,lon).
+func (p Point) String() string {
+	return strconv.FormatFloat(p.Lat, 'f', 2, 64) + "," + strconv.FormatFloat(p.Lon, 'f', 2, 64)
+}
+
+// A Motion represents the motion of a storm (or line of storms).
+type Motion struct {
+	Time time.Time
+
+	// Kind of event, ex. storm or storms.
+	Kind string
+
+	// Direction the storm is moving from, in degrees.
+	Direction float64
+
+	// Speed, in knots.
+	Speed float64
+
+	// Location of the storm. A line of storms has multiple points.
+	Points []Point
+}
+
+// ErrInvalid is returned when the motion description cannot be parsed.
+var ErrInvalid = errors.New("Invalid event motion description")
+
+// Parse parses an event motion description,
+// ex. 2019-05-20T22:05:00-00:00...storm...235DEG...28KT...38.9,-95.7
+func Parse(str string) (*Motion, error) {
+	parts := strings.Split(strings.TrimSpace(str), "...")
+	if len(parts) != 5 {
+		return nil, ErrInvalid
+	}
+
+	var t capxml.Time
+	if err := t.UnmarshalText([]byte(parts[0])); err != nil {
+		return nil, err
+	}
+
+	direction, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToUpper(parts[2]), "DEG"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid direction %q: %v", parts[2], err)
+	}
+
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToUpper(parts[3]), "KT"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid speed %q: %v", parts[3], err)
+	}
+
+	motion := &Motion{
+		Time:      t.Time,
+		Kind:      strings.TrimSpace(parts[1]),
+		Direction: direction,
+		Speed:     speed,
+	}
+
+	for _, coord := range strings.Fields(parts[4]) {
+		latlon := strings.Split(coord, ",")
+		if len(latlon) != 2 {
+			return nil, fmt.Errorf("Invalid location %q", coord)
+		}
+
+		lat, err := strconv.ParseFloat(latlon[0], 64)
+		if err != nil {
+			return nil, err
+		}
+
+		lon, err := strconv.ParseFloat(latlon[1], 64)
+		if err != nil {
+			return nil, err
+		}
+
+		motion.Points = append(motion.Points, Point{Lat: lat, Lon: lon})
+	}
+
+	if len(motion.Points) == 0 {
+		return nil, ErrInvalid
+	}
+
+	return motion, nil
+}
+
+// Heading returns the direction the storm is moving towards, in degrees.
+func (motion *Motion) Heading() float64 {
+	return math.Mod(motion.Direction+180, 360)
+}
+
+// At returns the location of each of the storm's points at time t.
+func (motion *Motion) At(t time.Time) []Point {
+	distance := motion.Speed * knot * t.Sub(motion.Time).Seconds()
+
+	points := make([]Point, len(motion.Points))
+	for i, p := range motion.Points {
+		points[i] = destination(p, motion.Heading(), distance)
+	}
+	return points
+}
+
+// A Projection is the projected track of a storm.
+type Projection struct {
+	// Times of each step of the projection.
+	Times []time.Time
+
+	// Paths of each of the storm's points, with one point per step.
+	Paths [][]Point
+}
+
+// Project projects the storm's track forward until the given time,
+// in steps of interval.
+func (motion *Motion) Project(until time.Time, interval time.Duration) *Projection {
+	projection := &Projection{
+		Paths: make([][]Point, len(motion.Points)),
+	}
+
+	for t := motion.Time; !t.After(until); t = t.Add(interval) {
+		projection.Times = append(projection.Times, t)
+		for i, p := range motion.At(t) {
+			projection.Paths[i] = append(projection.Paths[i], p)
+		}
+	}
+
+	return projection
+}
+
+// ETA returns the time the storm is projected to be closest to the point,
+// and its distance (in metres) from the point at that time. If the storm
+// is moving away from the point, the motion time is returned.
+func (motion *Motion) ETA(p Point) (time.Time, float64) {
+	best := math.Inf(1)
+	var eta time.Time
+
+	heading := motion.Heading() * math.Pi / 180
+	for _, start := range motion.Points {
+		// Distance along, and across, the track
+		d := distance(start, p)
+		bearing := initialBearing(start, p) * math.Pi / 180
+		along := d * math.Cos(bearing-heading)
+		across := math.Abs(d * math.Sin(bearing-heading))
+
+		if along < 0 {
+			along, across = 0, d
+		}
+
+		if across < best {
+			best = across
+			seconds := 0.0
+			if motion.Speed > 0 {
+				seconds = along / (motion.Speed * knot)
+			}
+			eta = motion.Time.Add(time.Duration(seconds * float64(time.Second)))
+		}
+	}
+
+	return eta, best
+}
+
+// destination returns the point at the distance (metres) and bearing (degrees) from p.
+func destination(p Point, bearing, distance float64) Point {
+	lat1 := p.Lat * math.Pi / 180
+	lon1 := p.Lon * math.Pi / 180
+	brng := bearing * math.Pi / 180
+	d := distance / earthRadius
+
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(d) + math.Cos(lat1)*math.Sin(d)*math.Cos(brng))
+	lon2 := lon1 + math.Atan2(math.Sin(brng)*math.Sin(d)*math.Cos(lat1), math.Cos(d)-math.Sin(lat1)*math.Sin(lat2))
+
+	return Point{
+		Lat: lat2 * 180 / math.Pi,
+		Lon: math.Mod(lon2*180/math.Pi+540, 360) - 180,
+	}
+}
+
+// distance returns the great-circle distance between the points, in metres.
+func distance(a, b Point) float64 {
+	lat1 := a.Lat * math.Pi / 180
+	lat2 := b.Lat * math.Pi / 180
+	dlat := lat2 - lat1
+	dlon := (b.Lon - a.Lon) * math.Pi / 180
+
+	h := math.Sin(dlat/2)*math.Sin(dlat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dlon/2)*math.Sin(dlon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// initialBearing returns the bearing from a to b, in degrees.
+func initialBearing(a, b Point) float64 {
+	lat1 := a.Lat * math.Pi / 180
+	lat2 := b.Lat * math.Pi / 180
+	dlon := (b.Lon - a.Lon) * math.Pi / 180
+
+	y := math.Sin(dlon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dlon)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
@@ -0,0 +1,198 @@
+package motion
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+const example = "2019-05-20T22:05:00-00:00...storm...235DEG...28KT...38.9,-95.7"
+
+// near returns whether the points are within a metre of each other.
+func near(a, b Point) bool {
+	return distance(a, b) < 1
+}
+
+func parse(t *testing.T, str string) *Motion {
+	m, err := Parse(str)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestParse(t *testing.T) {
+	m := parse(t, example)
+
+	if want := time.Date(2019, 5, 20, 22, 5, 0, 0, time.UTC); !m.Time.Equal(want) {
+		t.Errorf("Time = %s, want %s", m.Time, want)
+	}
+	if m.Kind != "storm" || m.Direction != 235 || m.Speed != 28 {
+		t.Errorf("Motion = %s from %v at %v kt", m.Kind, m.Direction, m.Speed)
+	}
+	if len(m.Points) != 1 || m.Points[0] != (Point{Lat: 38.9, Lon: -95.7}) {
+		t.Errorf("Points = %v", m.Points)
+	}
+	if m.Heading() != 55 {
+		t.Errorf("Heading() = %v, want 55", m.Heading())
+	}
+
+	// A line of storms
+	m = parse(t, "2019-05-20T22:05:00-00:00...storms...300deg...15kt...38.9,-95.7 39.1,-95.5 39.3,-95.4")
+	if len(m.Points) != 3 || m.Points[2] != (Point{Lat: 39.3, Lon: -95.4}) {
+		t.Errorf("Points = %v", m.Points)
+	}
+	if m.Heading() != 120 {
+		t.Errorf("Heading() = %v, want 120", m.Heading())
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, str := range []string{
+		"",
+		"2019-05-20T22:05:00-00:00...storm...235DEG...28KT",
+		"yesterday...storm...235DEG...28KT...38.9,-95.7",
+		"2019-05-20T22:05:00-00:00...storm...SW...28KT...38.9,-95.7",
+		"2019-05-20T22:05:00-00:00...storm...235DEG...FAST...38.9,-95.7",
+		"2019-05-20T22:05:00-00:00...storm...235DEG...28KT...38.9",
+		"2019-05-20T22:05:00-00:00...storm...235DEG...28KT...38.9,west",
+		"2019-05-20T22:05:00-00:00...storm...235DEG...28KT... ",
+	} {
+		if m, err := Parse(str); err == nil {
+			t.Errorf("Parse(%q) = %+v, want an error", str, m)
+		}
+	}
+}
+
+func TestDestination(t *testing.T) {
+	// A degree of latitude, along a great circle
+	degree := earthRadius * math.Pi / 180
+	start := Point{Lat: 38.9, Lon: -95.7}
+
+	tests := []struct {
+		from     Point
+		bearing  float64
+		distance float64
+		want     Point
+	}{
+		{start, 0, degree, Point{Lat: 39.9, Lon: -95.7}},
+		{start, 180, 2 * degree, Point{Lat: 36.9, Lon: -95.7}},
+		{start, 90, 0, start},
+		// Across the antimeridian
+		{Point{Lat: 0, Lon: -180}, 270, degree, Point{Lat: 0, Lon: 179}},
+	}
+
+	for _, test := range tests {
+		got := destination(test.from, test.bearing, test.distance)
+		if !near(got, test.want) {
+			t.Errorf("destination(%v, %v, %v) = %v, want %v", test.from, test.bearing, test.distance, got, test.want)
+		}
+	}
+}
+
+func TestAt(t *testing.T) {
+	m := parse(t, example)
+
+	// An hour later, the storm has moved 28 nautical miles to the north east
+	p := m.At(m.Time.Add(time.Hour))[0]
+	if d := distance(m.Points[0], p); math.Abs(d-28*1852) > 1 {
+		t.Errorf("Moved %.0f m, want %d m", d, 28*1852)
+	}
+	if b := initialBearing(m.Points[0], p); math.Abs(b-55) > 0.01 {
+		t.Errorf("Moved towards %.2f°, want 55°", b)
+	}
+	if p.String() != "39.17,-95.21" {
+		t.Errorf("At() = %s, want 39.17,-95.21", p)
+	}
+
+	// At the motion time, the storm is where it was reported
+	if p := m.At(m.Time)[0]; !near(p, m.Points[0]) {
+		t.Errorf("At() the motion time = %v, want %v", p, m.Points[0])
+	}
+}
+
+func TestProject(t *testing.T) {
+	m := parse(t, "2019-05-20T22:05:00-00:00...storms...235DEG...28KT...38.9,-95.7 39.1,-95.5")
+
+	projection := m.Project(m.Time.Add(32*time.Minute), 5*time.Minute)
+	if len(projection.Times) != 7 || !projection.Times[0].Equal(m.Time) || !projection.Times[6].Equal(m.Time.Add(30*time.Minute)) {
+		t.Fatalf("Times = %v, want 7 steps of 5 minutes", projection.Times)
+	}
+	if len(projection.Paths) != 2 {
+		t.Fatalf("Projected %d paths, want 2", len(projection.Paths))
+	}
+
+	for i, path := range projection.Paths {
+		if len(path) != len(projection.Times) || !near(path[0], m.Points[i]) {
+			t.Fatalf("Path %d = %v", i, path)
+		}
+		for j := 1; j < len(path); j++ {
+			if d := distance(path[j-1], path[j]); math.Abs(d-28*1852/12.0) > 1 {
+				t.Errorf("Path %d step %d is %.0f m", i, j, d)
+			}
+		}
+	}
+
+	// Expired before the motion time
+	if projection := m.Project(m.Time.Add(-time.Minute), 5*time.Minute); len(projection.Times) != 0 {
+		t.Errorf("Projected %d steps back in time", len(projection.Times))
+	}
+}
+
+func TestETA(t *testing.T) {
+	m := parse(t, example)
+	start := m.Points[0]
+	speed := 28 * knot
+
+	ahead := destination(start, 55, 20000)
+	tests := []struct {
+		name     string
+		point    Point
+		eta      time.Duration
+		distance float64
+	}{
+		{"in the path", ahead, time.Duration(20000 / speed * float64(time.Second)), 0},
+		{"beside the path", destination(ahead, 145, 5000), time.Duration(20000 / speed * float64(time.Second)), 5000},
+		{"at the storm", start, 0, 0},
+		// Moving away: no ETA, the current distance
+		{"behind", destination(start, 235, 20000), 0, 20000},
+		{"behind and to the side", destination(start, 235+60, 20000), 0, 20000},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			eta, d := m.ETA(test.point)
+			if diff := eta.Sub(m.Time.Add(test.eta)); diff < -5*time.Second || diff > 5*time.Second {
+				t.Errorf("ETA() = %s, want %s", eta.Sub(m.Time), test.eta)
+			}
+			if math.Abs(d-test.distance) > 50 {
+				t.Errorf("ETA() distance = %.0f m, want %.0f m", d, test.distance)
+			}
+		})
+	}
+
+	// About 23 minutes for a point 20 km ahead
+	if eta, _ := m.ETA(ahead); eta.Sub(m.Time).Round(time.Minute) != 23*time.Minute {
+		t.Errorf("ETA() = %s, want about 23 minutes", eta.Sub(m.Time))
+	}
+}
+
+func TestETALine(t *testing.T) {
+	// The point is closest to the second storm of the line
+	m := parse(t, "2019-05-20T22:05:00-00:00...storms...270DEG...30KT...38.9,-95.7 39.5,-95.7")
+	point := destination(m.Points[1], 90, 30*1852)
+
+	eta, d := m.ETA(point)
+	if got := eta.Sub(m.Time).Round(time.Minute); got != time.Hour {
+		t.Errorf("ETA() = %s, want an hour", got)
+	}
+	if d > 100 {
+		t.Errorf("ETA() distance = %.0f m, want the point on the second storm's path", d)
+	}
+
+	// Stationary storms arrive now
+	m.Speed = 0
+	if eta, _ := m.ETA(point); !eta.Equal(m.Time) {
+		t.Errorf("ETA() of a stationary storm = %s", eta)
+	}
+}
@@ -0,0 +1,391 @@
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MQTT 3.1.1 control packet types.
+const (
+	packetConnect    = 1
+	packetConnAck    = 2
+	packetPublish    = 3
+	packetPubAck     = 4
+	packetPingReq    = 12
+	packetPingResp   = 13
+	packetDisconnect = 14
+)
+
+// How long to wait for the broker to acknowledge a packet.
+const ackTimeout = 30 * time.Second
+
+// A Client is a minimal MQTT 3.1.1 client, which only publishes. It
+// connects when first used, and reconnects after losing the connection.
+// Unacknowledged QoS 1 messages are sent again, as duplicates, when it
+// reconnects. With a client ID, the session is kept by the broker
+// across connections.
+type Client struct {
+	// Address of the broker (host:port).
+	Addr string
+
+	ClientID string
+	Username string
+	Password string
+
+	KeepAlive time.Duration
+
+	// If set, the connection uses TLS.
+	TLSConfig *tls.Config
+
+	mutex    sync.Mutex
+	conn     net.Conn
+	done     chan struct{}
+	packetID uint16
+	pending  map[uint16]*inflight
+}
+
+// An inflight is a QoS 1 message waiting to be acknowledged.
+type inflight struct {
+	packet []byte
+	ack    chan struct{}
+}
+
+// encodeLength encodes the remaining length of a packet.
+func encodeLength(n int) []byte {
+	var b []byte
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+// decodeLength decodes the remaining length of a packet.
+func decodeLength(r io.ByteReader) (int, error) {
+	n, multiplier := 0, 1
+	for i := 0; i < 4; i++ {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		n += int(digit&0x7f) * multiplier
+		if digit&0x80 == 0 {
+			return n, nil
+		}
+		multiplier *= 128
+	}
+	return 0, errors.New("Malformed packet length")
+}
+
+func encodeString(s string) []byte {
+	return append([]byte{byte(len(s) >> 8), byte(len(s))}, s...)
+}
+
+func packet(header byte, body []byte) []byte {
+	return append(append([]byte{header}, encodeLength(len(body))...), body...)
+}
+
+// connectPacket returns the client's CONNECT packet.
+func (client *Client) connectPacket() []byte {
+	// Protocol name, level 4 (3.1.1), flags, keep alive. Without a
+	// client ID, the broker assigns one, and the session must be clean.
+	var flags byte
+	if client.ClientID == "" {
+		flags |= 0x02
+	}
+	if client.Username != "" {
+		flags |= 0x80
+		if client.Password != "" {
+			flags |= 0x40
+		}
+	}
+	keepAlive := int(client.KeepAlive / time.Second)
+	body := append(encodeString("MQTT"), 4, flags, byte(keepAlive>>8), byte(keepAlive))
+	body = append(body, encodeString(client.ClientID)...)
+	if client.Username != "" {
+		body = append(body, encodeString(client.Username)...)
+		if client.Password != "" {
+			body = append(body, encodeString(client.Password)...)
+		}
+	}
+	return packet(packetConnect<<4, body)
+}
+
+// publishPacket returns a PUBLISH packet. The packet ID is only
+// included with QoS 1.
+func publishPacket(topic string, payload []byte, qos byte, retain bool, id uint16) []byte {
+	header := byte(packetPublish<<4) | qos<<1
+	if retain {
+		header |= 0x01
+	}
+
+	body := encodeString(topic)
+	if qos > 0 {
+		body = append(body, byte(id>>8), byte(id))
+	}
+	return packet(header, append(body, payload...))
+}
+
+// connect connects to the broker. The mutex must be held.
+func (client *Client) connect() error {
+	var conn net.Conn
+	var err error
+	if client.TLSConfig != nil {
+		conn, err = tls.Dial("tcp", client.Addr, client.TLSConfig)
+	} else {
+		conn, err = net.Dial("tcp", client.Addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	conn.SetDeadline(time.Now().Add(ackTimeout))
+	if _, err := conn.Write(client.connectPacket()); err != nil {
+		conn.Close()
+		return err
+	}
+
+	r := bufio.NewReader(conn)
+	header, ack, err := readPacket(r)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if header>>4 != packetConnAck || len(ack) < 2 {
+		conn.Close()
+		return fmt.Errorf("Expected CONNACK from MQTT broker, got packet type %d", header>>4)
+	}
+	if ack[1] != 0 {
+		conn.Close()
+		return fmt.Errorf("Connection refused by MQTT broker (code %d)", ack[1])
+	}
+
+	// Send the unacknowledged messages again, in the order they were sent
+	if client.pending == nil {
+		client.pending = make(map[uint16]*inflight)
+	}
+	ids := make([]int, 0, len(client.pending))
+	for id := range client.pending {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		msg := client.pending[uint16(id)]
+		msg.packet[0] |= 0x08 // DUP
+		if _, err := conn.Write(msg.packet); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	conn.SetDeadline(time.Time{})
+
+	client.conn = conn
+	client.done = make(chan struct{})
+	pong := make(chan struct{}, 1)
+	go client.read(conn, r, client.done, pong)
+	if client.KeepAlive > 0 {
+		go client.ping(conn, client.done, pong)
+	}
+
+	log.Printf("Connected to MQTT broker %s (%d message(s) sent again)", client.Addr, len(ids))
+	return nil
+}
+
+// readPacket reads a packet, returning its fixed header byte and its body.
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, err := decodeLength(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+// read reads the packets from the broker, until the connection is closed.
+// PINGRESPs are signalled on pong.
+func (client *Client) read(conn net.Conn, r *bufio.Reader, done chan struct{}, pong chan struct{}) {
+	defer client.disconnect(conn, done)
+
+	for {
+		header, body, err := readPacket(r)
+		if err != nil {
+			return
+		}
+
+		switch header >> 4 {
+		case packetPubAck:
+			if len(body) < 2 {
+				return
+			}
+			id := uint16(body[0])<<8 | uint16(body[1])
+			client.mutex.Lock()
+			if msg, ok := client.pending[id]; ok {
+				close(msg.ack)
+				delete(client.pending, id)
+			}
+			client.mutex.Unlock()
+		case packetPingResp:
+			select {
+			case pong <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// ping keeps the connection alive, disconnecting if the broker
+// does not answer a PINGREQ before the next one is due.
+func (client *Client) ping(conn net.Conn, done chan struct{}, pong chan struct{}) {
+	ticker := time.NewTicker(client.KeepAlive / 2)
+	defer ticker.Stop()
+
+	waiting := false
+	for {
+		select {
+		case <-done:
+			return
+		case <-pong:
+			waiting = false
+		case <-ticker.C:
+			if waiting {
+				log.Printf("No PINGRESP from MQTT broker %s", client.Addr)
+				client.disconnect(conn, done)
+				return
+			}
+			waiting = true
+
+			client.mutex.Lock()
+			_, err := conn.Write(packet(packetPingReq<<4, nil))
+			client.mutex.Unlock()
+			if err != nil {
+				client.disconnect(conn, done)
+				return
+			}
+		}
+	}
+}
+
+// disconnect closes the connection, if it is still the current one.
+func (client *Client) disconnect(conn net.Conn, done chan struct{}) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if client.conn != conn {
+		return
+	}
+
+	log.Printf("Disconnected from MQTT broker %s", client.Addr)
+	conn.Close()
+	close(done)
+	client.conn = nil
+}
+
+// Publish publishes the payload to the topic. With QoS 1, Publish waits
+// for the broker to acknowledge the message, reconnecting if the connection
+// is lost in the meantime. QoS 2 is not supported.
+func (client *Client) Publish(topic string, payload []byte, qos byte, retain bool) error {
+	if qos > 1 {
+		return errors.New("QoS 2 is not supported")
+	}
+
+	client.mutex.Lock()
+	if client.conn == nil {
+		if err := client.connect(); err != nil {
+			client.mutex.Unlock()
+			return err
+		}
+	}
+	conn, done := client.conn, client.done
+
+	var id uint16
+	if qos > 0 {
+		for {
+			client.packetID++
+			if client.packetID != 0 && client.pending[client.packetID] == nil {
+				break
+			}
+		}
+		id = client.packetID
+	}
+
+	p := publishPacket(topic, payload, qos, retain, id)
+	var msg *inflight
+	if qos > 0 {
+		msg = &inflight{packet: p, ack: make(chan struct{})}
+		client.pending[id] = msg
+	}
+
+	_, err := conn.Write(p)
+	client.mutex.Unlock()
+	if err != nil {
+		client.disconnect(conn, done)
+		if msg == nil {
+			return err
+		}
+	}
+
+	if msg == nil {
+		return nil
+	}
+
+	timeout := time.After(ackTimeout)
+	for {
+		select {
+		case <-msg.ack:
+			return nil
+		case <-done:
+			// Reconnecting sends the message again
+			client.mutex.Lock()
+			if client.conn == nil {
+				if err := client.connect(); err != nil {
+					delete(client.pending, id)
+					client.mutex.Unlock()
+					return err
+				}
+			}
+			done = client.done
+			client.mutex.Unlock()
+		case <-timeout:
+			client.mutex.Lock()
+			delete(client.pending, id)
+			client.mutex.Unlock()
+			return errors.New("Timed out waiting for the MQTT broker")
+		}
+	}
+}
+
+// Close disconnects from the broker.
+func (client *Client) Close() error {
+	client.mutex.Lock()
+	conn, done := client.conn, client.done
+	if conn != nil {
+		conn.Write(packet(packetDisconnect<<4, nil))
+	}
+	client.mutex.Unlock()
+
+	if conn != nil {
+		client.disconnect(conn, done)
+	}
+	return nil
+}
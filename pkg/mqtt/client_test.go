@@ -0,0 +1,420 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A PUBLISH received by the broker stand-in.
+type received struct {
+	conn    int
+	dup     bool
+	qos     byte
+	retain  bool
+	id      uint16
+	topic   string
+	payload []byte
+}
+
+// broker is a minimal MQTT broker, accepting PUBLISH and PINGREQ packets.
+type broker struct {
+	listener net.Listener
+
+	// CONNACK sent to the clients (default: accepted).
+	connAck []byte
+
+	// Close the first connection on its first QoS 1 PUBLISH, without acknowledging it.
+	dropFirst bool
+
+	// Don't answer PINGREQs.
+	noPong bool
+
+	mutex     sync.Mutex
+	conns     int
+	flags     []byte
+	publishes []*received
+	closed    chan int
+}
+
+func newBroker(t *testing.T) *broker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &broker{
+		listener: l,
+		connAck:  []byte{packetConnAck << 4, 2, 0, 0},
+		closed:   make(chan int, 10),
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			b.mutex.Lock()
+			b.conns++
+			n := b.conns
+			b.mutex.Unlock()
+			go b.serve(conn, n)
+		}
+	}()
+	return b
+}
+
+func (b *broker) Addr() string {
+	return b.listener.Addr().String()
+}
+
+func (b *broker) Close() {
+	b.listener.Close()
+}
+
+// Publishes returns the PUBLISH packets received.
+func (b *broker) Publishes() []*received {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.publishes
+}
+
+func (b *broker) serve(conn net.Conn, n int) {
+	defer func() {
+		conn.Close()
+		b.closed <- n
+	}()
+
+	r := bufio.NewReader(conn)
+	header, body, err := readPacket(r)
+	if err != nil || header>>4 != packetConnect || len(body) < 10 {
+		return
+	}
+	b.mutex.Lock()
+	b.flags = append(b.flags, body[7])
+	b.mutex.Unlock()
+
+	if _, err := conn.Write(b.connAck); err != nil {
+		return
+	}
+
+	for {
+		header, body, err := readPacket(r)
+		if err != nil {
+			return
+		}
+
+		switch header >> 4 {
+		case packetPublish:
+			p := &received{
+				conn:   n,
+				dup:    header&0x08 != 0,
+				qos:    header >> 1 & 0x03,
+				retain: header&0x01 != 0,
+			}
+			l := int(body[0])<<8 | int(body[1])
+			p.topic = string(body[2 : 2+l])
+			body = body[2+l:]
+			if p.qos > 0 {
+				p.id = uint16(body[0])<<8 | uint16(body[1])
+				body = body[2:]
+			}
+			p.payload = body
+
+			b.mutex.Lock()
+			b.publishes = append(b.publishes, p)
+			b.mutex.Unlock()
+
+			if p.qos == 0 {
+				continue
+			}
+			if b.dropFirst && n == 1 {
+				return
+			}
+			conn.Write([]byte{packetPubAck << 4, 2, byte(p.id >> 8), byte(p.id)})
+		case packetPingReq:
+			if !b.noPong {
+				conn.Write([]byte{packetPingResp << 4, 0})
+			}
+		case packetDisconnect:
+			return
+		}
+	}
+}
+
+func TestLength(t *testing.T) {
+	// The boundaries of the remaining length encoding (MQTT 3.1.1, table 2.4)
+	tests := []struct {
+		n    int
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{16383, []byte{0xff, 0x7f}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+		{2097151, []byte{0xff, 0xff, 0x7f}},
+		{2097152, []byte{0x80, 0x80, 0x80, 0x01}},
+		{268435455, []byte{0xff, 0xff, 0xff, 0x7f}},
+	}
+
+	for _, test := range tests {
+		b := encodeLength(test.n)
+		if !bytes.Equal(b, test.want) {
+			t.Errorf("encodeLength(%d) = % x, want % x", test.n, b, test.want)
+		}
+		got, err := decodeLength(bytes.NewReader(b))
+		if err != nil || got != test.n {
+			t.Errorf("decodeLength(% x) = %d, %v", b, got, err)
+		}
+	}
+
+	if _, err := decodeLength(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 0x01})); err == nil {
+		t.Error("Decoded a length of more than 4 bytes")
+	}
+}
+
+func TestConnectPacket(t *testing.T) {
+	tests := []struct {
+		name   string
+		client *Client
+		want   []byte
+	}{
+		{
+			// Clean session, no keep alive, and an empty client ID
+			"anonymous",
+			&Client{},
+			[]byte{
+				0x10, 12,
+				0x00, 0x04, 'M', 'Q', 'T', 'T', 0x04, 0x02, 0x00, 0x00,
+				0x00, 0x00,
+			},
+		},
+		{
+			// User name and password flags, keep alive of 10 seconds (MQTT 3.1.1, 3.1.2.10)
+			"authenticated",
+			&Client{ClientID: "test", Username: "user", Password: "pass", KeepAlive: 10 * time.Second},
+			[]byte{
+				0x10, 28,
+				0x00, 0x04, 'M', 'Q', 'T', 'T', 0x04, 0xc0, 0x00, 0x0a,
+				0x00, 0x04, 't', 'e', 's', 't',
+				0x00, 0x04, 'u', 's', 'e', 'r',
+				0x00, 0x04, 'p', 'a', 's', 's',
+			},
+		},
+		{
+			"user name only",
+			&Client{ClientID: "test", Username: "user", KeepAlive: 90 * time.Second},
+			[]byte{
+				0x10, 22,
+				0x00, 0x04, 'M', 'Q', 'T', 'T', 0x04, 0x80, 0x00, 0x5a,
+				0x00, 0x04, 't', 'e', 's', 't',
+				0x00, 0x04, 'u', 's', 'e', 'r',
+			},
+		},
+	}
+
+	for _, test := range tests {
+		if got := test.client.connectPacket(); !bytes.Equal(got, test.want) {
+			t.Errorf("%s: connectPacket() = % x, want % x", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPublishPacket(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		qos     byte
+		retain  bool
+		id      uint16
+		want    []byte
+	}{
+		{
+			// The packet ID is not sent with QoS 0
+			"QoS 0",
+			[]byte("on"), 0, false, 10,
+			[]byte{0x30, 7, 0x00, 0x03, 'a', '/', 'b', 'o', 'n'},
+		},
+		{
+			// Topic a/b with packet ID 10 (MQTT 3.1.1, 3.3.2.3)
+			"QoS 1, retained",
+			[]byte("on"), 1, true, 10,
+			[]byte{0x33, 9, 0x00, 0x03, 'a', '/', 'b', 0x00, 0x0a, 'o', 'n'},
+		},
+		{
+			// Clears the retained message
+			"empty",
+			nil, 1, true, 0x1234,
+			[]byte{0x33, 7, 0x00, 0x03, 'a', '/', 'b', 0x12, 0x34},
+		},
+	}
+
+	for _, test := range tests {
+		if got := publishPacket("a/b", test.payload, test.qos, test.retain, test.id); !bytes.Equal(got, test.want) {
+			t.Errorf("%s: publishPacket() = % x, want % x", test.name, got, test.want)
+		}
+	}
+
+	// A long payload needs two bytes of remaining length
+	got := publishPacket("a/b", make([]byte, 200), 0, false, 0)
+	if !bytes.Equal(got[:3], []byte{0x30, 0xcd, 0x01}) || len(got) != 3+205 {
+		t.Errorf("publishPacket() = % x..., %d bytes", got[:3], len(got))
+	}
+}
+
+func TestControlPackets(t *testing.T) {
+	if got := packet(packetPingReq<<4, nil); !bytes.Equal(got, []byte{0xc0, 0x00}) {
+		t.Errorf("PINGREQ = % x, want c0 00", got)
+	}
+	if got := packet(packetDisconnect<<4, nil); !bytes.Equal(got, []byte{0xe0, 0x00}) {
+		t.Errorf("DISCONNECT = % x, want e0 00", got)
+	}
+
+	// PUBACK of packet ID 10, CONNACK accepting the connection, and PINGRESP
+	r := bufio.NewReader(bytes.NewReader([]byte{0x40, 0x02, 0x00, 0x0a, 0x20, 0x02, 0x00, 0x00, 0xd0, 0x00}))
+	for _, want := range []struct {
+		header byte
+		body   []byte
+	}{
+		{packetPubAck << 4, []byte{0x00, 0x0a}},
+		{packetConnAck << 4, []byte{0x00, 0x00}},
+		{packetPingResp << 4, []byte{}},
+	} {
+		header, body, err := readPacket(r)
+		if err != nil || header != want.header || !bytes.Equal(body, want.body) {
+			t.Errorf("readPacket() = %x, % x, %v, want %x, % x", header, body, err, want.header, want.body)
+		}
+	}
+	if _, _, err := readPacket(r); err == nil {
+		t.Error("readPacket() at the end did not fail")
+	}
+}
+
+func TestConnAck(t *testing.T) {
+	tests := []struct {
+		name    string
+		connAck []byte
+		err     string
+	}{
+		{"accepted", []byte{0x20, 2, 0, 0}, ""},
+		{"session present", []byte{0x20, 2, 1, 0}, ""},
+		{"not authorized", []byte{0x20, 2, 0, 5}, "code 5"},
+		{"not a CONNACK", []byte{0xd0, 0}, "Expected CONNACK"},
+		{"truncated", []byte{0x20, 1, 0}, "Expected CONNACK"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := newBroker(t)
+			defer b.Close()
+			b.connAck = test.connAck
+
+			client := &Client{Addr: b.Addr(), ClientID: "test"}
+			defer client.Close()
+
+			err := client.Publish("a/b", []byte("payload"), 0, false)
+			if test.err == "" && err != nil {
+				t.Errorf("Publish() error = %v", err)
+			} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("Publish() error = %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestPublish(t *testing.T) {
+	b := newBroker(t)
+	defer b.Close()
+
+	client := &Client{Addr: b.Addr()}
+	if err := client.Publish("nws/alerts/KS/KSC161/tornado-warning", []byte("one"), 1, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Publish("nws/alerts/KS/KSC161/tornado-warning", nil, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	<-b.closed
+
+	// Without a client ID, the session is clean
+	if len(b.flags) != 1 || b.flags[0]&0x02 == 0 {
+		t.Errorf("CONNECT flags = %x, want a clean session", b.flags)
+	}
+
+	publishes := b.Publishes()
+	if len(publishes) != 2 {
+		t.Fatalf("Received %d PUBLISH(es), want 2", len(publishes))
+	}
+
+	p := publishes[0]
+	if p.topic != "nws/alerts/KS/KSC161/tornado-warning" || p.qos != 1 || !p.retain || p.dup || p.id == 0 || string(p.payload) != "one" {
+		t.Errorf("PUBLISH = %+v", p)
+	}
+	p = publishes[1]
+	if p.qos != 0 || p.retain || p.id != 0 || len(p.payload) != 0 {
+		t.Errorf("PUBLISH = %+v", p)
+	}
+}
+
+func TestResendAfterReconnect(t *testing.T) {
+	b := newBroker(t)
+	defer b.Close()
+	b.dropFirst = true
+
+	client := &Client{Addr: b.Addr(), ClientID: "test"}
+	defer client.Close()
+
+	if err := client.Publish("a/b", []byte("payload"), 1, true); err != nil {
+		t.Fatal(err)
+	}
+
+	publishes := b.Publishes()
+	if len(publishes) != 2 {
+		t.Fatalf("Received %d PUBLISH(es), want 2", len(publishes))
+	}
+	first, second := publishes[0], publishes[1]
+	if first.conn != 1 || first.dup {
+		t.Errorf("First PUBLISH = %+v", first)
+	}
+	if second.conn != 2 || !second.dup || second.id != first.id || second.topic != first.topic || !bytes.Equal(second.payload, first.payload) {
+		t.Errorf("Second PUBLISH = %+v, want a duplicate of %+v", second, first)
+	}
+
+	// With a client ID, the session is kept
+	for _, flags := range b.flags {
+		if flags&0x02 != 0 {
+			t.Errorf("CONNECT flags = %x, want the session kept", flags)
+		}
+	}
+}
+
+func TestPingResp(t *testing.T) {
+	for _, noPong := range []bool{false, true} {
+		b := newBroker(t)
+		b.noPong = noPong
+
+		client := &Client{Addr: b.Addr(), KeepAlive: 100 * time.Millisecond}
+		if err := client.Publish("a/b", nil, 0, false); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case <-b.closed:
+			if !noPong {
+				t.Error("Disconnected, with the broker answering PINGREQs")
+			}
+		case <-time.After(500 * time.Millisecond):
+			if noPong {
+				t.Error("Still connected, without the broker answering PINGREQs")
+			}
+		}
+
+		client.Close()
+		b.Close()
+	}
+}
@@ -0,0 +1,302 @@
+// Package mqtt publishes active alerts to an MQTT broker, as retained
+// messages on a topic per zone and event.
+//
+// The client (see Client) is a minimal MQTT 3.1.1 publisher, rather than
+// an established library such as github.com/eclipse/paho.mqtt.golang.
+// The processor only publishes, so it needs CONNECT, PUBLISH with QoS 0
+// or 1, PUBACK, PINGREQ/PINGRESP and DISCONNECT. Paho brings a message
+// router, persistent stores, WebSocket and proxy support (and the
+// golang.org/x/net packages for them) into the vendor tree, for none of
+// which the processor has a use. Subscriptions, QoS 2 and wills are not
+// implemented. The packets are tested against the byte layouts of the
+// MQTT 3.1.1 specification.
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alerting/alerts-naads/pkg/codec"
+	"github.com/alerting/alerts-nws/pkg/expire"
+	"github.com/alerting/alerts-nws/pkg/vtec"
+	"github.com/alerting/alerts-nws/pkg/zones"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+	"github.com/lovoo/goka"
+)
+
+// Config is the configuration for the MQTT processor.
+type Config struct {
+	Brokers []string
+	Group   string
+
+	// Topic of stored alerts (see consume.Config.StoredTopic).
+	StoredTopic string
+
+	// Topic of expirations (see consume.Config.ExpiredTopic). If set,
+	// the retained messages are cleared when the alerts expire.
+	ExpiredTopic string
+
+	Client *Client
+
+	// Prefix of the MQTT topics (ex. nws/alerts).
+	Prefix string
+
+	// QoS of the published messages (0 or 1).
+	QoS byte
+}
+
+// A Payload is the compact message published for an alert.
+type Payload struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	Headline  string    `json:"headline,omitempty"`
+	Severity  string    `json:"severity"`
+	Urgency   string    `json:"urgency"`
+	Certainty string    `json:"certainty"`
+	Sent      time.Time `json:"sent"`
+	Expires   time.Time `json:"expires,omitempty"`
+	VTEC      []string  `json:"vtec,omitempty"`
+}
+
+// published is the group table's value. Keyed by alert ID, it holds the
+// MQTT topics with a retained message for the alert. Keyed by MQTT topic,
+// it holds the alert whose message is retained on the topic.
+type published struct {
+	Topics []string `json:"topics,omitempty"`
+	Owner  string   `json:"owner,omitempty"`
+}
+
+// A clear is a loopback message. Keyed by alert ID, it requests the
+// alert's retained messages to be cleared. Keyed by MQTT topic, it claims
+// the topic for an alert, or releases it, clearing the retained message
+// if the alert still owns the topic.
+type clear struct {
+	// Topics to keep, as they have been replaced by a newer alert.
+	Keep []string `json:"keep,omitempty"`
+
+	Claim   string `json:"claim,omitempty"`
+	Release string `json:"release,omitempty"`
+}
+
+type publishedCodec struct{}
+
+func (c *publishedCodec) Encode(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case *published:
+		return json.Marshal(v)
+	default:
+		return nil, errors.New("Unknown type provided")
+	}
+}
+
+func (c *publishedCodec) Decode(data []byte) (interface{}, error) {
+	var p published
+	err := json.Unmarshal(data, &p)
+	return &p, err
+}
+
+type clearCodec struct{}
+
+func (c *clearCodec) Encode(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case *clear:
+		return json.Marshal(v)
+	default:
+		return nil, errors.New("Unknown type provided")
+	}
+}
+
+func (c *clearCodec) Decode(data []byte) (interface{}, error) {
+	var cl clear
+	err := json.Unmarshal(data, &cl)
+	return &cl, err
+}
+
+// Topic returns the MQTT topic for the event in the zone:
+// <prefix>/<state>/<ugc>/<event>, with the event in lower case,
+// and spaces replaced by dashes. Marine zones use "marine" as
+// their state.
+func Topic(prefix, ugc, event string) string {
+	state := zones.State(ugc)
+	if state == "" {
+		state = "marine"
+	}
+
+	slug := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ':
+			return '-'
+		case '/', '+', '#':
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(event)))
+
+	return strings.Join([]string{prefix, state, ugc, slug}, "/")
+}
+
+// ended returns whether the info ends its VTEC events.
+func ended(info *capxml.Info) bool {
+	found := false
+	for _, str := range info.Parameters["VTEC"] {
+		pvtec, err := vtec.ParsePVTEC(str)
+		if err != nil {
+			continue
+		}
+		found = true
+
+		switch pvtec.Action {
+		case vtec.ActionCancel, vtec.ActionExpire, vtec.ActionUpgrade:
+		default:
+			return false
+		}
+	}
+	return found
+}
+
+// publish publishes the topics, as retained messages.
+func publish(conf *Config, topics []string, payload []byte) {
+	for _, topic := range topics {
+		if err := conf.Client.Publish(topic, payload, conf.QoS, true); err != nil {
+			log.Printf("Unable to publish to %s: %v", topic, err)
+		}
+	}
+}
+
+func collectAlert(conf *Config) func(ctx goka.Context, msg interface{}) {
+	return func(gctx goka.Context, msg interface{}) {
+		alert := msg.(capxml.Alert)
+
+		// Publish the active alert to each of its zones, once per event
+		topics := make(map[string]bool)
+		if alert.MessageType != capxml.MessageTypeCancel {
+			for _, info := range alert.Infos {
+				if ended(info) {
+					continue
+				}
+
+				payload := &Payload{
+					ID:        alert.ID(),
+					Event:     info.Event,
+					Headline:  info.Headline,
+					Severity:  info.Severity.String(),
+					Urgency:   info.Urgency.String(),
+					Certainty: info.Certainty.String(),
+					Sent:      alert.Sent.Time,
+					VTEC:      info.Parameters["VTEC"],
+				}
+				if info.Expires != nil {
+					payload.Expires = info.Expires.Time
+				}
+
+				b, err := json.Marshal(payload)
+				if err != nil {
+					log.Println("Unable to encode payload:", err)
+					continue
+				}
+
+				var infoTopics []string
+				for _, area := range info.Areas {
+					for _, ugc := range area.GeoCodes["UGC"] {
+						topic := Topic(conf.Prefix, ugc, info.Event)
+						if !topics[topic] {
+							topics[topic] = true
+							infoTopics = append(infoTopics, topic)
+						}
+					}
+				}
+				publish(conf, infoTopics, b)
+			}
+		}
+
+		keep := make([]string, 0, len(topics))
+		for topic := range topics {
+			keep = append(keep, topic)
+		}
+		sort.Strings(keep)
+
+		if len(keep) > 0 {
+			log.Printf("Published %s to %d topic(s)", alert.ID(), len(keep))
+			gctx.SetValue(&published{Topics: keep})
+			for _, topic := range keep {
+				gctx.Loopback(topic, &clear{Claim: alert.ID()})
+			}
+		}
+
+		// Clear the alerts that were updated or cancelled
+		for _, reference := range alert.References {
+			gctx.Loopback(reference.ID(), &clear{Keep: keep})
+		}
+	}
+}
+
+func collectExpiration(gctx goka.Context, msg interface{}) {
+	gctx.Loopback(gctx.Key(), new(clear))
+}
+
+func collectClear(conf *Config) func(ctx goka.Context, msg interface{}) {
+	return func(gctx goka.Context, msg interface{}) {
+		cl := msg.(*clear)
+		p, _ := gctx.Value().(*published)
+
+		switch {
+		case cl.Claim != "":
+			gctx.SetValue(&published{Owner: cl.Claim})
+		case cl.Release != "":
+			// Leave the message of a newer alert published to the topic.
+			// Topics without an owner are cleared, in case it was lost.
+			if p != nil && p.Owner != cl.Release {
+				return
+			}
+
+			// An empty retained message clears the topic
+			publish(conf, []string{gctx.Key()}, nil)
+			gctx.Delete()
+		default:
+			if p == nil {
+				return
+			}
+
+			keep := make(map[string]bool)
+			for _, topic := range cl.Keep {
+				keep[topic] = true
+			}
+
+			n := 0
+			for _, topic := range p.Topics {
+				if !keep[topic] {
+					gctx.Loopback(topic, &clear{Release: gctx.Key()})
+					n++
+				}
+			}
+
+			log.Printf("Clearing %d topic(s) of %s", n, gctx.Key())
+			gctx.Delete()
+		}
+	}
+}
+
+// Run runs the MQTT processor, publishing the stored alerts.
+func Run(ctx context.Context, conf Config) error {
+	defer conf.Client.Close()
+
+	edges := []goka.Edge{
+		goka.Input(goka.Stream(conf.StoredTopic), new(codec.Alert), collectAlert(&conf)),
+		goka.Loop(new(clearCodec), collectClear(&conf)),
+		goka.Persist(new(publishedCodec)),
+	}
+	if conf.ExpiredTopic != "" {
+		edges = append(edges, goka.Input(goka.Stream(conf.ExpiredTopic), new(expire.ExpirationCodec), collectExpiration))
+	}
+
+	p, err := goka.NewProcessor(conf.Brokers, goka.DefineGroup(goka.Group(conf.Group), edges...))
+	if err != nil {
+		return err
+	}
+	return p.Run(ctx)
+}
@@ -0,0 +1,127 @@
+package mqtt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka"
+)
+
+func TestTopic(t *testing.T) {
+	tests := []struct {
+		ugc   string
+		event string
+		want  string
+	}{
+		{"KSC161", "Tornado Warning", "nws/alerts/KS/KSC161/tornado-warning"},
+		{"KSZ035", " Winter Storm Watch ", "nws/alerts/KS/KSZ035/winter-storm-watch"},
+		{"AMZ250", "Small Craft Advisory", "nws/alerts/marine/AMZ250/small-craft-advisory"},
+		{"GMZ870", "Gale Warning", "nws/alerts/marine/GMZ870/gale-warning"},
+		{"LMZ646", "Special Marine Warning", "nws/alerts/marine/LMZ646/special-marine-warning"},
+		{"PKC013", "Flood Warning", "nws/alerts/PK/PKC013/flood-warning"},
+		{"TXC001", "Fire Weather Watch/Red Flag", "nws/alerts/TX/TXC001/fire-weather-watchred-flag"},
+	}
+
+	for _, test := range tests {
+		if got := Topic("nws/alerts", test.ugc, test.event); got != test.want {
+			t.Errorf("Topic(%q, %q) = %q, want %q", test.ugc, test.event, got, test.want)
+		}
+	}
+}
+
+// A message to process in a testContext.
+type message struct {
+	key   string
+	value interface{}
+}
+
+// testContext is a goka.Context for a single message, backed by a table.
+type testContext struct {
+	table    map[string]interface{}
+	key      string
+	loopback []*message
+}
+
+func (c *testContext) Topic() goka.Stream                                    { return "" }
+func (c *testContext) Key() string                                           { return c.key }
+func (c *testContext) Partition() int32                                      { return 0 }
+func (c *testContext) Offset() int64                                         { return 0 }
+func (c *testContext) Value() interface{}                                    { return c.table[c.key] }
+func (c *testContext) SetValue(value interface{})                            { c.table[c.key] = value }
+func (c *testContext) Delete()                                               { delete(c.table, c.key) }
+func (c *testContext) Timestamp() time.Time                                  { return time.Time{} }
+func (c *testContext) Join(topic goka.Table) interface{}                     { return nil }
+func (c *testContext) Lookup(topic goka.Table, key string) interface{}       { return nil }
+func (c *testContext) Emit(topic goka.Stream, key string, value interface{}) {}
+func (c *testContext) Fail(err error)                                        { panic(err) }
+func (c *testContext) Context() context.Context                              { return context.Background() }
+
+func (c *testContext) Loopback(key string, value interface{}) {
+	c.loopback = append(c.loopback, &message{key: key, value: value})
+}
+
+// process processes the clear requests, and the loopback messages they emit, in order.
+func process(conf *Config, table map[string]interface{}, messages ...*message) {
+	cb := collectClear(conf)
+	for len(messages) > 0 {
+		ctx := &testContext{table: table, key: messages[0].key}
+		cb(ctx, messages[0].value)
+		messages = append(messages[1:], ctx.loopback...)
+	}
+}
+
+func TestClear(t *testing.T) {
+	b := newBroker(t)
+	defer b.Close()
+
+	conf := &Config{Client: &Client{Addr: b.Addr()}}
+	defer conf.Client.Close()
+
+	// Alerts A and B share a topic, which B published to last
+	table := map[string]interface{}{
+		"A": &published{Topics: []string{"a", "shared"}},
+		"B": &published{Topics: []string{"b", "shared"}},
+	}
+	process(conf, table,
+		&message{"a", &clear{Claim: "A"}},
+		&message{"shared", &clear{Claim: "A"}},
+		&message{"b", &clear{Claim: "B"}},
+		&message{"shared", &clear{Claim: "B"}},
+	)
+	if owner := table["shared"].(*published).Owner; owner != "B" {
+		t.Fatalf("shared is owned by %q, want B", owner)
+	}
+
+	// Clearing A leaves B's message
+	process(conf, table, &message{"A", new(clear)})
+	if _, ok := table["A"]; ok {
+		t.Error("A was not deleted")
+	}
+	if _, ok := table["shared"]; !ok {
+		t.Error("shared was released by A")
+	}
+
+	// Clearing B, keeping b as it has been updated, clears shared
+	process(conf, table, &message{"B", &clear{Keep: []string{"b"}}})
+	if _, ok := table["shared"]; ok {
+		t.Error("shared was not released by B")
+	}
+
+	// Wait for the last PUBLISH, as QoS 0 isn't acknowledged
+	deadline := time.Now().Add(5 * time.Second)
+	for len(b.Publishes()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var cleared []string
+	for _, p := range b.Publishes() {
+		if len(p.payload) != 0 || !p.retain {
+			t.Errorf("PUBLISH = %+v, want an empty retained message", p)
+		}
+		cleared = append(cleared, p.topic)
+	}
+	if len(cleared) != 2 || cleared[0] != "a" || cleared[1] != "shared" {
+		t.Errorf("Cleared %q, want [a shared]", cleared)
+	}
+}
@@ -0,0 +1,107 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+// A Filter selects alerts by event, severity and UGC. An alert matches
+// if any of its infos match all of the filters. Empty filters match everything.
+type Filter struct {
+	Events     []string `json:"events,omitempty"`
+	Severities []string `json:"severities,omitempty"`
+
+	// UGC codes, or prefixes of UGC codes (ex. OK for Oklahoma,
+	// or OKC for its counties).
+	UGC []string `json:"ugc,omitempty"`
+}
+
+// An Endpoint is a webhook that is notified of stored alerts.
+type Endpoint struct {
+	Filter
+
+	URL string `json:"url"`
+
+	// Secret used to sign the payloads. If empty, payloads are not signed.
+	Secret string `json:"secret,omitempty"`
+}
+
+// LoadEndpoints loads the endpoints from a JSON file, containing a list of endpoints.
+func LoadEndpoints(filename string) ([]*Endpoint, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var endpoints []*Endpoint
+	if err := json.NewDecoder(f).Decode(&endpoints); err != nil {
+		return nil, err
+	}
+
+	for _, endpoint := range endpoints {
+		if endpoint.URL == "" {
+			return nil, errors.New("Endpoint is missing its URL")
+		}
+	}
+
+	return endpoints, nil
+}
+
+// Matches returns whether the alert passes the filter.
+func (filter *Filter) Matches(alert *capxml.Alert) bool {
+	for _, info := range alert.Infos {
+		if filter.MatchesInfo(info) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesInfo returns whether the info passes the filter.
+func (filter *Filter) MatchesInfo(info *capxml.Info) bool {
+	if len(filter.Events) > 0 && !containsFold(filter.Events, info.Event) {
+		return false
+	}
+
+	if len(filter.Severities) > 0 && !containsFold(filter.Severities, info.Severity.String()) {
+		return false
+	}
+
+	if len(filter.UGC) > 0 {
+		for _, code := range UGCs(info) {
+			for _, prefix := range filter.UGC {
+				if strings.HasPrefix(code, strings.ToUpper(prefix)) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// UGCs returns the UGC codes of the info's areas, including
+// those derived from the areas' polygons.
+func UGCs(info *capxml.Info) []string {
+	var codes []string
+	for _, area := range info.Areas {
+		codes = append(codes, area.GeoCodes["UGC"]...)
+		codes = append(codes, area.GeoCodes["UGC-derived"]...)
+	}
+	return codes
+}
+
+func containsFold(values []string, str string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, str) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,353 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alerting/alerts-naads/pkg/codec"
+	"github.com/alerting/alerts-nws/pkg/convert"
+	"github.com/alerting/alerts-nws/pkg/parameters"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/lovoo/goka"
+)
+
+const (
+	// Header containing the HMAC-SHA256 signature of the payload, as sha256=<hex>.
+	SignatureHeader = "X-Alerts-Signature"
+
+	// Header containing the ID of the alert.
+	AlertHeader = "X-Alerts-Alert"
+
+	// Header containing the delivery attempt, starting at 1.
+	AttemptHeader = "X-Alerts-Attempt"
+
+	// Longest wait between delivery attempts.
+	maxBackoff = 5 * time.Minute
+
+	// Default number of deliveries made at once.
+	defaultWorkers = 4
+)
+
+// Config is the configuration for the notify processor.
+type Config struct {
+	Brokers []string
+	Group   string
+
+	// Topic of stored alerts (see consume.Config.StoredTopic).
+	StoredTopic string
+
+	Notifier *Notifier
+}
+
+// NWS contains the decoded NWS fields of an info.
+type NWS struct {
+	Language   string                 `json:"language"`
+	Event      string                 `json:"event"`
+	UGC        []string               `json:"ugc,omitempty"`
+	VTEC       []string               `json:"vtec,omitempty"`
+	Parameters *parameters.Parameters `json:"parameters"`
+}
+
+// A Payload is the body posted to the endpoints.
+type Payload struct {
+	AlertID string          `json:"alert_id"`
+	Alert   json.RawMessage `json:"alert"`
+	NWS     []*NWS          `json:"nws"`
+}
+
+// A Delivery is a record of an attempt to deliver an alert to an endpoint.
+type Delivery struct {
+	Time     time.Time     `json:"time"`
+	AlertID  string        `json:"alert_id"`
+	URL      string        `json:"url"`
+	Attempt  int           `json:"attempt"`
+	Status   int           `json:"status,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// A Notifier delivers alerts to webhook endpoints. Failed deliveries
+// are retried, with exponential backoff. Deliveries are made by a fixed
+// number of workers; Notify blocks while they are all busy.
+type Notifier struct {
+	Endpoints []*Endpoint
+	Client    *http.Client
+
+	// Attempts made to deliver an alert to an endpoint.
+	MaxAttempts int
+
+	// Wait before the first retry, doubled after each attempt.
+	Backoff time.Duration
+
+	// If set, deliveries are logged as JSON lines.
+	DeliveryLog io.Writer
+
+	System string
+
+	// Number of deliveries made at once (4 if not set).
+	Workers int
+
+	mutex sync.Mutex
+	once  sync.Once
+	jobs  chan *job
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// A job is the delivery of an alert to an endpoint.
+type job struct {
+	endpoint *Endpoint
+	alertID  string
+	body     []byte
+}
+
+// Sign returns the signature of the body, as sha256=<hex>.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewPayload returns the payload for the alert.
+func NewPayload(alert *capxml.Alert, system string) (*Payload, error) {
+	cAlert, err := convert.Alert(alert)
+	if err != nil {
+		return nil, err
+	}
+	cAlert.System = system
+
+	enc := jsonpb.Marshaler{}
+	str, err := enc.MarshalToString(cAlert)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := &Payload{
+		AlertID: alert.ID(),
+		Alert:   json.RawMessage(str),
+	}
+
+	for _, info := range alert.Infos {
+		params, _ := parameters.Decode(info.Parameters)
+		payload.NWS = append(payload.NWS, &NWS{
+			Language:   info.Language,
+			Event:      info.Event,
+			UGC:        UGCs(info),
+			VTEC:       info.Parameters["VTEC"],
+			Parameters: params,
+		})
+	}
+
+	return payload, nil
+}
+
+// start starts the workers, if they haven't been started.
+func (notifier *Notifier) start() {
+	notifier.once.Do(func() {
+		workers := notifier.Workers
+		if workers <= 0 {
+			workers = defaultWorkers
+		}
+
+		notifier.jobs = make(chan *job)
+		notifier.stop = make(chan struct{})
+		for i := 0; i < workers; i++ {
+			notifier.wg.Add(1)
+			go func() {
+				defer notifier.wg.Done()
+				for j := range notifier.jobs {
+					notifier.deliver(j.endpoint, j.alertID, j.body)
+				}
+			}()
+		}
+	})
+}
+
+// Notify queues the alert for delivery to the endpoints it matches,
+// waiting for a worker to be free, or the context to be done.
+func (notifier *Notifier) Notify(ctx context.Context, alert *capxml.Alert) error {
+	var endpoints []*Endpoint
+	for _, endpoint := range notifier.Endpoints {
+		if endpoint.Matches(alert) {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	if len(endpoints) == 0 {
+		return nil
+	}
+
+	payload, err := NewPayload(alert, notifier.System)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	notifier.start()
+	for _, endpoint := range endpoints {
+		select {
+		case notifier.jobs <- &job{endpoint: endpoint, alertID: payload.AlertID, body: body}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Close stops the workers, once the deliveries in progress have been
+// attempted. Deliveries are not retried once the notifier is closing.
+// Notify must not be called after Close.
+func (notifier *Notifier) Close() {
+	notifier.start()
+	close(notifier.stop)
+	close(notifier.jobs)
+	notifier.wg.Wait()
+}
+
+// deliver posts the body to the endpoint, retrying until it succeeds,
+// the attempts run out, the endpoint rejects it, or the notifier closes.
+func (notifier *Notifier) deliver(endpoint *Endpoint, alertID string, body []byte) {
+	backoff := notifier.Backoff
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		status, err := notifier.post(endpoint, alertID, attempt, body)
+
+		delivery := &Delivery{
+			Time:     start,
+			AlertID:  alertID,
+			URL:      endpoint.URL,
+			Attempt:  attempt,
+			Status:   status,
+			Duration: time.Since(start),
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		notifier.record(delivery)
+
+		if err == nil {
+			return
+		}
+
+		if attempt >= notifier.MaxAttempts || !retryable(status) {
+			log.Printf("Giving up delivering %s to %s after %d attempt(s)", alertID, endpoint.URL, attempt)
+			return
+		}
+
+		select {
+		case <-notifier.stop:
+			log.Printf("Giving up delivering %s to %s: shutting down", alertID, endpoint.URL)
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// post posts the body to the endpoint, returning the response status.
+func (notifier *Notifier) post(endpoint *Endpoint, alertID string, attempt int, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(AlertHeader, alertID)
+	req.Header.Set(AttemptHeader, strconv.Itoa(attempt))
+	if endpoint.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(endpoint.Secret, body))
+	}
+
+	client := notifier.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("Unexpected status: %s", res.Status)
+	}
+	return res.StatusCode, nil
+}
+
+// retryable returns whether a delivery with the status should be retried.
+// Connection errors (status 0), server errors and rate limiting are retried.
+func retryable(status int) bool {
+	return status == 0 || status == http.StatusTooManyRequests || status >= 500
+}
+
+// record logs the delivery.
+func (notifier *Notifier) record(delivery *Delivery) {
+	if delivery.Error != "" {
+		log.Printf("Delivery of %s to %s failed (attempt %d): %s", delivery.AlertID, delivery.URL, delivery.Attempt, delivery.Error)
+	} else {
+		log.Printf("Delivered %s to %s (attempt %d)", delivery.AlertID, delivery.URL, delivery.Attempt)
+	}
+
+	if notifier.DeliveryLog == nil {
+		return
+	}
+
+	b, err := json.Marshal(delivery)
+	if err != nil {
+		log.Println("Unable to encode delivery:", err)
+		return
+	}
+
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	if _, err := notifier.DeliveryLog.Write(append(b, '\n')); err != nil {
+		log.Println("Unable to write delivery log:", err)
+	}
+}
+
+func collect(ctx context.Context, conf *Config) func(ctx goka.Context, msg interface{}) {
+	return func(gctx goka.Context, msg interface{}) {
+		alert := msg.(capxml.Alert)
+		if err := conf.Notifier.Notify(ctx, &alert); err != nil {
+			log.Printf("Unable to notify %s: %v", alert.ID(), err)
+		}
+	}
+}
+
+// Run runs the notify processor, delivering the stored alerts to the endpoints.
+func Run(ctx context.Context, conf Config) error {
+	g := goka.DefineGroup(goka.Group(conf.Group),
+		goka.Input(goka.Stream(conf.StoredTopic), new(codec.Alert), collect(ctx, &conf)),
+	)
+
+	p, err := goka.NewProcessor(conf.Brokers, g)
+	if err != nil {
+		return err
+	}
+
+	err = p.Run(ctx)
+	conf.Notifier.Close()
+	return err
+}
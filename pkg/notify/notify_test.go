@@ -0,0 +1,322 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+func testAlert(identifier string) *capxml.Alert {
+	sent, _ := time.Parse(time.RFC3339, "2019-05-28T16:45:00-05:00")
+	return &capxml.Alert{
+		Identifier:  identifier,
+		Sender:      "w-nws.webmaster@noaa.gov",
+		Sent:        capxml.Time{Time: sent},
+		Status:      capxml.StatusActual,
+		MessageType: capxml.MessageTypeAlert,
+		Scope:       capxml.ScopePublic,
+		Infos: []*capxml.Info{
+			{
+				Event:    "Severe Thunderstorm Warning",
+				Severity: capxml.SeveritySevere,
+				Parameters: capxml.KeyValue{
+					"maxHailSize": {"1.00"},
+				},
+				Areas: []*capxml.Area{
+					{
+						Description: "Riley",
+						GeoCodes:    capxml.KeyValue{"UGC": {"KSC161"}},
+					},
+				},
+			},
+		},
+	}
+}
+
+// A request received by the test server.
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+// server returns a server responding with the statuses in turn (the last
+// status is repeated), and the requests it received.
+func server(statuses ...int) (*httptest.Server, func() []*request) {
+	var mutex sync.Mutex
+	var requests []*request
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		mutex.Lock()
+		requests = append(requests, &request{header: r.Header, body: body})
+		n := len(requests)
+		mutex.Unlock()
+
+		if n > len(statuses) {
+			n = len(statuses)
+		}
+		w.WriteHeader(statuses[n-1])
+	}))
+
+	return srv, func() []*request {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return requests
+	}
+}
+
+// notify queues the alerts, then closes the notifier, waiting for the
+// deliveries to be attempted.
+func notify(t *testing.T, notifier *Notifier, alerts ...*capxml.Alert) {
+	for _, alert := range alerts {
+		if err := notifier.Notify(context.Background(), alert); err != nil {
+			t.Fatal(err)
+		}
+	}
+	notifier.Close()
+}
+
+// deliver delivers the alert to the endpoints without closing the notifier,
+// so failed deliveries are retried.
+func deliver(t *testing.T, notifier *Notifier, alert *capxml.Alert) {
+	payload, err := NewPayload(alert, notifier.System)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notifier.start()
+	defer notifier.Close()
+	for _, endpoint := range notifier.Endpoints {
+		notifier.deliver(endpoint, payload.AlertID, body)
+	}
+}
+
+func TestSignature(t *testing.T) {
+	srv, requests := server(http.StatusOK)
+	defer srv.Close()
+
+	secret := "s3cr3t"
+	notifier := &Notifier{
+		Endpoints:   []*Endpoint{{URL: srv.URL, Secret: secret}},
+		MaxAttempts: 1,
+	}
+	alert := testAlert("signed")
+	notify(t, notifier, alert)
+
+	reqs := requests()
+	if len(reqs) != 1 {
+		t.Fatalf("Received %d request(s), want 1", len(reqs))
+	}
+	req := reqs[0]
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(req.body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := req.header.Get(SignatureHeader); got != want {
+		t.Errorf("%s = %q, want %q", SignatureHeader, got, want)
+	}
+
+	if got := req.header.Get(AlertHeader); got != alert.ID() {
+		t.Errorf("%s = %q, want %q", AlertHeader, got, alert.ID())
+	}
+	if got := req.header.Get(AttemptHeader); got != "1" {
+		t.Errorf("%s = %q, want 1", AttemptHeader, got)
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.AlertID != alert.ID() {
+		t.Errorf("Payload alert ID = %q, want %q", payload.AlertID, alert.ID())
+	}
+	if len(payload.NWS) != 1 || payload.NWS[0].Parameters.MaxHailSize == nil || payload.NWS[0].Parameters.MaxHailSize.Value != 1 {
+		t.Errorf("Payload parameters not decoded: %s", req.body)
+	}
+}
+
+func TestUnsigned(t *testing.T) {
+	srv, requests := server(http.StatusOK)
+	defer srv.Close()
+
+	notifier := &Notifier{
+		Endpoints:   []*Endpoint{{URL: srv.URL}},
+		MaxAttempts: 1,
+	}
+	notify(t, notifier, testAlert("unsigned"))
+
+	for _, req := range requests() {
+		if sig := req.header.Get(SignatureHeader); sig != "" {
+			t.Errorf("Unsigned endpoint received %s: %q", SignatureHeader, sig)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name        string
+		statuses    []int
+		maxAttempts int
+		attempts    int
+	}{
+		{"success", []int{http.StatusNoContent}, 5, 1},
+		{"server errors", []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK}, 5, 3},
+		{"rate limited", []int{http.StatusTooManyRequests, http.StatusAccepted}, 5, 2},
+		{"attempts run out", []int{http.StatusInternalServerError}, 3, 3},
+		{"rejected", []int{http.StatusBadRequest}, 5, 1},
+		{"not found", []int{http.StatusNotFound}, 5, 1},
+		{"redirect", []int{http.StatusNotModified}, 5, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv, requests := server(test.statuses...)
+			defer srv.Close()
+
+			var log bytes.Buffer
+			notifier := &Notifier{
+				Endpoints:   []*Endpoint{{URL: srv.URL}},
+				MaxAttempts: test.maxAttempts,
+				Backoff:     time.Millisecond,
+				DeliveryLog: &log,
+			}
+			deliver(t, notifier, testAlert(test.name))
+
+			reqs := requests()
+			if len(reqs) != test.attempts {
+				t.Fatalf("Made %d attempt(s), want %d", len(reqs), test.attempts)
+			}
+			for i, req := range reqs {
+				if got := req.header.Get(AttemptHeader); got != strconv.Itoa(i+1) {
+					t.Errorf("Attempt %d: %s = %q", i+1, AttemptHeader, got)
+				}
+			}
+
+			// Each attempt is logged, with its status
+			dec := json.NewDecoder(&log)
+			for i := 0; i < test.attempts; i++ {
+				var delivery Delivery
+				if err := dec.Decode(&delivery); err != nil {
+					t.Fatalf("Delivery %d: %v", i+1, err)
+				}
+
+				status := test.statuses[len(test.statuses)-1]
+				if i < len(test.statuses) {
+					status = test.statuses[i]
+				}
+				ok := status >= 200 && status <= 299
+				if delivery.Attempt != i+1 || delivery.Status != status || (delivery.Error == "") != ok {
+					t.Errorf("Delivery %d = %+v, want status %d", i+1, delivery, status)
+				}
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	srv, requests := server(http.StatusServiceUnavailable)
+	defer srv.Close()
+
+	backoff := 20 * time.Millisecond
+	notifier := &Notifier{
+		Endpoints:   []*Endpoint{{URL: srv.URL}},
+		MaxAttempts: 3,
+		Backoff:     backoff,
+	}
+
+	start := time.Now()
+	deliver(t, notifier, testAlert("backoff"))
+
+	// Waits of backoff, then twice backoff
+	if elapsed := time.Since(start); elapsed < 3*backoff {
+		t.Errorf("Attempts took %v, want at least %v", elapsed, 3*backoff)
+	}
+	if n := len(requests()); n != 3 {
+		t.Errorf("Made %d attempt(s), want 3", n)
+	}
+}
+
+func TestCloseDrains(t *testing.T) {
+	srv, requests := server(http.StatusOK)
+	defer srv.Close()
+
+	notifier := &Notifier{
+		Endpoints:   []*Endpoint{{URL: srv.URL}, {URL: srv.URL}},
+		MaxAttempts: 1,
+		Workers:     1,
+	}
+	notify(t, notifier, testAlert("a"), testAlert("b"), testAlert("c"))
+
+	if n := len(requests()); n != 6 {
+		t.Errorf("Delivered %d time(s) before closing, want 6", n)
+	}
+}
+
+func TestCloseStopsRetries(t *testing.T) {
+	srv, requests := server(http.StatusServiceUnavailable)
+	defer srv.Close()
+
+	notifier := &Notifier{
+		Endpoints:   []*Endpoint{{URL: srv.URL}},
+		MaxAttempts: 5,
+		Backoff:     time.Hour,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		notify(t, notifier, testAlert("closing"))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close waited for the retries")
+	}
+	if n := len(requests()); n != 1 {
+		t.Errorf("Made %d attempt(s), want 1", n)
+	}
+}
+
+func TestNotifyBlocked(t *testing.T) {
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer srv.Close()
+	defer close(block)
+
+	notifier := &Notifier{
+		Endpoints:   []*Endpoint{{URL: srv.URL}},
+		MaxAttempts: 1,
+		Workers:     1,
+	}
+
+	// The first delivery occupies the worker
+	if err := notifier.Notify(context.Background(), testAlert("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := notifier.Notify(ctx, testAlert("second")); err != context.DeadlineExceeded {
+		t.Errorf("Notify() with a busy worker = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,287 @@
+// Package parameters decodes the NWS-specific parameters of CAP alerts.
+package parameters
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+// Prefix of the decoded parameters, as key-value pairs.
+const Prefix = "NWS-"
+
+// A Detection represents how a threat was detected.
+type Detection string
+
+const (
+	// DetectionRadarIndicated represents a threat indicated by radar.
+	DetectionRadarIndicated Detection = "radar-indicated"
+
+	// DetectionObserved represents a threat that has been observed.
+	DetectionObserved Detection = "observed"
+
+	// DetectionPossible represents a threat that is possible.
+	DetectionPossible Detection = "possible"
+)
+
+// A DamageThreat represents the damage threat tag of a warning.
+type DamageThreat string
+
+const (
+	// DamageThreatBase represents a warning without a damage threat tag.
+	DamageThreatBase DamageThreat = "base"
+
+	// DamageThreatConsiderable represents a considerable damage threat.
+	DamageThreatConsiderable DamageThreat = "considerable"
+
+	// DamageThreatDestructive represents a destructive damage threat.
+	DamageThreatDestructive DamageThreat = "destructive"
+
+	// DamageThreatCatastrophic represents a catastrophic damage threat.
+	DamageThreatCatastrophic DamageThreat = "catastrophic"
+)
+
+// A Measurement represents a measured value, with its unit.
+type Measurement struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+
+	// Qualifier of the value, such as < or >.
+	Qualifier string `json:"qualifier,omitempty"`
+}
+
+// String returns the measurement, ex. <0.75 in.
+func (m *Measurement) String() string {
+	return fmt.Sprintf("%s%s %s", m.Qualifier, strconv.FormatFloat(m.Value, 'f', -1, 64), m.Unit)
+}
+
+// A WMOIdentifier represents the WMO heading of a product (ex. WUUS53 KTOP 202205).
+type WMOIdentifier struct {
+	DataType string `json:"data_type"`
+	Office   string `json:"office"`
+	Issued   string `json:"issued"`
+}
+
+// An AWIPSIdentifier represents the AWIPS identifier of a product (ex. SVRTOP).
+type AWIPSIdentifier struct {
+	Product string `json:"product"`
+	Office  string `json:"office"`
+}
+
+// Parameters represents the decoded NWS-specific parameters of an info.
+type Parameters struct {
+	Headline                 string           `json:"headline,omitempty"`
+	EventMotionDescription   string           `json:"event_motion_description,omitempty"`
+	MaxHailSize              *Measurement     `json:"max_hail_size,omitempty"`
+	MaxWindGust              *Measurement     `json:"max_wind_gust,omitempty"`
+	HailThreat               Detection        `json:"hail_threat,omitempty"`
+	WindThreat               Detection        `json:"wind_threat,omitempty"`
+	TornadoDetection         Detection        `json:"tornado_detection,omitempty"`
+	ThunderstormDamageThreat DamageThreat     `json:"thunderstorm_damage_threat,omitempty"`
+	TornadoDamageThreat      DamageThreat     `json:"tornado_damage_threat,omitempty"`
+	WMOIdentifier            *WMOIdentifier   `json:"wmo_identifier,omitempty"`
+	AWIPSIdentifier          *AWIPSIdentifier `json:"awips_identifier,omitempty"`
+	BlockChannels            []string         `json:"block_channels,omitempty"`
+	EASOrg                   string           `json:"eas_org,omitempty"`
+}
+
+// first returns the first, whitespace-trimmed value for the key.
+func first(kv capxml.KeyValue, key string) string {
+	if values := kv[key]; len(values) > 0 {
+		return strings.TrimSpace(values[0])
+	}
+	return ""
+}
+
+// ex. <.75, 1.00 IN, 60 MPH, 50KTS
+var measurementRegexp = regexp.MustCompile(`(?i)^(<|>|UP TO )?\s*([0-9]*\.?[0-9]+)\s*([A-Z]*)$`)
+
+// parseMeasurement parses a measurement, using the default unit if the
+// value does not have one. Units are normalised to lowercase abbreviations.
+func parseMeasurement(str, defaultUnit string) (*Measurement, error) {
+	match := measurementRegexp.FindStringSubmatch(strings.TrimSpace(str))
+	if match == nil {
+		return nil, fmt.Errorf("Invalid measurement: %q", str)
+	}
+
+	value, err := strconv.ParseFloat(match[2], 64)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Measurement{
+		Value: value,
+		Unit:  defaultUnit,
+	}
+
+	switch strings.ToUpper(strings.TrimSpace(match[1])) {
+	case "<", "UP TO":
+		m.Qualifier = "<"
+	case ">":
+		m.Qualifier = ">"
+	}
+
+	switch strings.ToUpper(match[3]) {
+	case "":
+	case "IN", "INCH", "INCHES":
+		m.Unit = "in"
+	case "MPH":
+		m.Unit = "mph"
+	case "KT", "KTS", "KNOTS":
+		m.Unit = "kt"
+	case "KMH", "KPH":
+		m.Unit = "km/h"
+	default:
+		return nil, fmt.Errorf("Unknown unit: %q", match[3])
+	}
+
+	return m, nil
+}
+
+// parseDetection parses a detection, ex. RADAR INDICATED.
+func parseDetection(str string) (Detection, error) {
+	switch strings.Join(strings.Fields(strings.ToUpper(str)), " ") {
+	case "":
+		return "", nil
+	case "RADAR INDICATED", "RADAR-INDICATED", "RADAR":
+		return DetectionRadarIndicated, nil
+	case "OBSERVED":
+		return DetectionObserved, nil
+	case "POSSIBLE":
+		return DetectionPossible, nil
+	}
+	return "", fmt.Errorf("Unknown detection: %q", str)
+}
+
+// parseDamageThreat parses a damage threat, ex. CONSIDERABLE.
+func parseDamageThreat(str string) (DamageThreat, error) {
+	switch strings.ToUpper(strings.TrimSpace(str)) {
+	case "":
+		return "", nil
+	case "BASE", "NONE":
+		return DamageThreatBase, nil
+	case "CONSIDERABLE":
+		return DamageThreatConsiderable, nil
+	case "DESTRUCTIVE":
+		return DamageThreatDestructive, nil
+	case "CATASTROPHIC":
+		return DamageThreatCatastrophic, nil
+	}
+	return "", fmt.Errorf("Unknown damage threat: %q", str)
+}
+
+// Decode decodes the NWS-specific parameters. Parameters that
+// cannot be decoded are skipped, and their errors returned.
+func Decode(kv capxml.KeyValue) (*Parameters, []error) {
+	var errs []error
+	params := &Parameters{
+		Headline:               first(kv, "NWSheadline"),
+		EventMotionDescription: first(kv, "eventMotionDescription"),
+		EASOrg:                 strings.ToUpper(first(kv, "EAS-ORG")),
+	}
+
+	var err error
+	if str := first(kv, "maxHailSize"); str != "" {
+		if params.MaxHailSize, err = parseMeasurement(str, "in"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if str := first(kv, "maxWindGust"); str != "" {
+		if params.MaxWindGust, err = parseMeasurement(str, "mph"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if params.HailThreat, err = parseDetection(first(kv, "hailThreat")); err != nil {
+		errs = append(errs, err)
+	}
+	if params.WindThreat, err = parseDetection(first(kv, "windThreat")); err != nil {
+		errs = append(errs, err)
+	}
+	if params.TornadoDetection, err = parseDetection(first(kv, "tornadoDetection")); err != nil {
+		errs = append(errs, err)
+	}
+	if params.ThunderstormDamageThreat, err = parseDamageThreat(first(kv, "thunderstormDamageThreat")); err != nil {
+		errs = append(errs, err)
+	}
+	if params.TornadoDamageThreat, err = parseDamageThreat(first(kv, "tornadoDamageThreat")); err != nil {
+		errs = append(errs, err)
+	}
+
+	// ex. WUUS53 KTOP 202205
+	if str := first(kv, "WMOidentifier"); str != "" {
+		fields := strings.Fields(str)
+		if len(fields) >= 3 {
+			params.WMOIdentifier = &WMOIdentifier{
+				DataType: fields[0],
+				Office:   fields[1],
+				Issued:   fields[2],
+			}
+		} else {
+			errs = append(errs, fmt.Errorf("Invalid WMO identifier: %q", str))
+		}
+	}
+
+	// ex. SVRTOP
+	if str := strings.ToUpper(first(kv, "AWIPSidentifier")); str != "" {
+		if len(str) >= 4 && len(str) <= 6 {
+			params.AWIPSIdentifier = &AWIPSIdentifier{
+				Product: str[:3],
+				Office:  str[3:],
+			}
+		} else {
+			errs = append(errs, fmt.Errorf("Invalid AWIPS identifier: %q", str))
+		}
+	}
+
+	// Block channels may be repeated, or space separated
+	for _, value := range kv["BLOCKCHANNEL"] {
+		for _, channel := range strings.Fields(value) {
+			params.BlockChannels = append(params.BlockChannels, strings.ToUpper(channel))
+		}
+	}
+
+	return params, errs
+}
+
+// KeyValue returns the decoded parameters as normalised key-value pairs,
+// prefixed by NWS-.
+func (params *Parameters) KeyValue() capxml.KeyValue {
+	kv := make(capxml.KeyValue)
+	add := func(key string, values ...string) {
+		for _, value := range values {
+			if value != "" {
+				kv[Prefix+key] = append(kv[Prefix+key], value)
+			}
+		}
+	}
+
+	add("headline", params.Headline)
+	if params.MaxHailSize != nil {
+		add("maxHailSize", params.MaxHailSize.String())
+	}
+	if params.MaxWindGust != nil {
+		add("maxWindGust", params.MaxWindGust.String())
+	}
+	add("hailThreat", string(params.HailThreat))
+	add("windThreat", string(params.WindThreat))
+	add("tornadoDetection", string(params.TornadoDetection))
+	add("thunderstormDamageThreat", string(params.ThunderstormDamageThreat))
+	add("tornadoDamageThreat", string(params.TornadoDamageThreat))
+	if params.WMOIdentifier != nil {
+		add("wmoDataType", params.WMOIdentifier.DataType)
+		add("wmoOffice", params.WMOIdentifier.Office)
+		add("wmoIssued", params.WMOIdentifier.Issued)
+	}
+	if params.AWIPSIdentifier != nil {
+		add("awipsProduct", params.AWIPSIdentifier.Product)
+		add("awipsOffice", params.AWIPSIdentifier.Office)
+	}
+	add("blockChannel", params.BlockChannels...)
+	add("easOrg", params.EASOrg)
+
+	return kv
+}
@@ -0,0 +1,202 @@
+package parameters
+
+import (
+	"reflect"
+	"testing"
+
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+func TestParseMeasurement(t *testing.T) {
+	tests := []struct {
+		str         string
+		defaultUnit string
+		want        string
+	}{
+		{"1.00", "in", "1 in"},
+		{"<.75", "in", "<0.75 in"},
+		{"< .75", "in", "<0.75 in"},
+		{"1.75 IN", "in", "1.75 in"},
+		{"2.00 INCHES", "in", "2 in"},
+		{"1 inch", "in", "1 in"},
+		{"60 MPH", "mph", "60 mph"},
+		{"60MPH", "mph", "60 mph"},
+		{"UP TO 60 MPH", "mph", "<60 mph"},
+		{"up to 40", "mph", "<40 mph"},
+		{">70 MPH", "mph", ">70 mph"},
+		{"50KTS", "mph", "50 kt"},
+		{"35 KT", "mph", "35 kt"},
+		{"40 knots", "mph", "40 kt"},
+		{"100 KMH", "mph", "100 km/h"},
+		{" 80 kph ", "mph", "80 km/h"},
+
+		// Invalid
+		{"", "in", ""},
+		{"LARGE", "in", ""},
+		{"60 FEET", "mph", ""},
+		{"60-70 MPH", "mph", ""},
+	}
+
+	for _, test := range tests {
+		m, err := parseMeasurement(test.str, test.defaultUnit)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("parseMeasurement(%q) = %s, want an error", test.str, m)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("parseMeasurement(%q) error = %v", test.str, err)
+		} else if got := m.String(); got != test.want {
+			t.Errorf("parseMeasurement(%q) = %s, want %s", test.str, got, test.want)
+		}
+	}
+}
+
+func TestParseDetection(t *testing.T) {
+	tests := []struct {
+		str  string
+		want Detection
+		err  bool
+	}{
+		{"RADAR INDICATED", DetectionRadarIndicated, false},
+		{"RADAR-INDICATED", DetectionRadarIndicated, false},
+		{"Radar  Indicated", DetectionRadarIndicated, false},
+		{"RADAR", DetectionRadarIndicated, false},
+		{"OBSERVED", DetectionObserved, false},
+		{" observed ", DetectionObserved, false},
+		{"POSSIBLE", DetectionPossible, false},
+		{"", "", false},
+		{"CONFIRMED", "", true},
+	}
+
+	for _, test := range tests {
+		got, err := parseDetection(test.str)
+		if (err != nil) != test.err || got != test.want {
+			t.Errorf("parseDetection(%q) = %q, %v, want %q (error: %v)", test.str, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestParseDamageThreat(t *testing.T) {
+	tests := []struct {
+		str  string
+		want DamageThreat
+		err  bool
+	}{
+		{"BASE", DamageThreatBase, false},
+		{"NONE", DamageThreatBase, false},
+		{"CONSIDERABLE", DamageThreatConsiderable, false},
+		{" Destructive", DamageThreatDestructive, false},
+		{"catastrophic", DamageThreatCatastrophic, false},
+		{"", "", false},
+		{"SEVERE", "", true},
+	}
+
+	for _, test := range tests {
+		got, err := parseDamageThreat(test.str)
+		if (err != nil) != test.err || got != test.want {
+			t.Errorf("parseDamageThreat(%q) = %q, %v, want %q (error: %v)", test.str, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	kv := capxml.KeyValue{
+		"NWSheadline":              {" SEVERE THUNDERSTORM WARNING IN EFFECT UNTIL 515 PM CDT "},
+		"eventMotionDescription":   {"2019-05-28T21:41:00-00:00...storm...245DEG...35KT...39.19,-96.6"},
+		"maxHailSize":              {"1.75"},
+		"maxWindGust":              {"UP TO 60 MPH"},
+		"hailThreat":               {"RADAR INDICATED"},
+		"windThreat":               {"OBSERVED"},
+		"tornadoDetection":         {"POSSIBLE"},
+		"thunderstormDamageThreat": {"CONSIDERABLE"},
+		"WMOidentifier":            {"WUUS53 KTOP 282141"},
+		"AWIPSidentifier":          {"svrtop"},
+		"BLOCKCHANNEL":             {"EAS NWEM", "cmas"},
+		"EAS-ORG":                  {"wxr"},
+	}
+
+	params, errs := Decode(kv)
+	if len(errs) != 0 {
+		t.Fatalf("Decode() errors = %v", errs)
+	}
+
+	want := &Parameters{
+		Headline:                 "SEVERE THUNDERSTORM WARNING IN EFFECT UNTIL 515 PM CDT",
+		EventMotionDescription:   "2019-05-28T21:41:00-00:00...storm...245DEG...35KT...39.19,-96.6",
+		MaxHailSize:              &Measurement{Value: 1.75, Unit: "in"},
+		MaxWindGust:              &Measurement{Value: 60, Unit: "mph", Qualifier: "<"},
+		HailThreat:               DetectionRadarIndicated,
+		WindThreat:               DetectionObserved,
+		TornadoDetection:         DetectionPossible,
+		ThunderstormDamageThreat: DamageThreatConsiderable,
+		WMOIdentifier:            &WMOIdentifier{DataType: "WUUS53", Office: "KTOP", Issued: "282141"},
+		AWIPSIdentifier:          &AWIPSIdentifier{Product: "SVR", Office: "TOP"},
+		BlockChannels:            []string{"EAS", "NWEM", "CMAS"},
+		EASOrg:                   "WXR",
+	}
+	if !reflect.DeepEqual(params, want) {
+		t.Errorf("Decode() = %+v, want %+v", params, want)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	kv := capxml.KeyValue{
+		"maxHailSize":         {"GOLF BALL"},
+		"maxWindGust":         {"70 MPH"},
+		"windThreat":          {"MEASURED"},
+		"tornadoDamageThreat": {"SEVERE"},
+		"WMOidentifier":       {"WUUS53"},
+		"AWIPSidentifier":     {"SV"},
+	}
+
+	params, errs := Decode(kv)
+	if len(errs) != 5 {
+		t.Errorf("Decode() returned %d errors, want 5: %v", len(errs), errs)
+	}
+
+	// The other parameters are still decoded
+	if params.MaxWindGust == nil || params.MaxWindGust.String() != "70 mph" {
+		t.Errorf("Max wind gust = %v, want 70 mph", params.MaxWindGust)
+	}
+	if params.MaxHailSize != nil || params.WindThreat != "" || params.TornadoDamageThreat != "" || params.WMOIdentifier != nil || params.AWIPSIdentifier != nil {
+		t.Errorf("Decode() kept invalid parameters: %+v", params)
+	}
+}
+
+func TestKeyValue(t *testing.T) {
+	params := &Parameters{
+		Headline:            "TORNADO WARNING",
+		MaxHailSize:         &Measurement{Value: 0.75, Unit: "in", Qualifier: "<"},
+		MaxWindGust:         &Measurement{Value: 60, Unit: "mph"},
+		TornadoDetection:    DetectionRadarIndicated,
+		TornadoDamageThreat: DamageThreatConsiderable,
+		WMOIdentifier:       &WMOIdentifier{DataType: "WFUS53", Office: "KTOP", Issued: "282141"},
+		AWIPSIdentifier:     &AWIPSIdentifier{Product: "TOR", Office: "TOP"},
+		BlockChannels:       []string{"EAS", "NWEM"},
+	}
+
+	want := capxml.KeyValue{
+		"NWS-headline":            {"TORNADO WARNING"},
+		"NWS-maxHailSize":         {"<0.75 in"},
+		"NWS-maxWindGust":         {"60 mph"},
+		"NWS-tornadoDetection":    {"radar-indicated"},
+		"NWS-tornadoDamageThreat": {"considerable"},
+		"NWS-wmoDataType":         {"WFUS53"},
+		"NWS-wmoOffice":           {"KTOP"},
+		"NWS-wmoIssued":           {"282141"},
+		"NWS-awipsProduct":        {"TOR"},
+		"NWS-awipsOffice":         {"TOP"},
+		"NWS-blockChannel":        {"EAS", "NWEM"},
+	}
+	if got := params.KeyValue(); !reflect.DeepEqual(got, want) {
+		t.Errorf("KeyValue() = %v, want %v", got, want)
+	}
+
+	// Nothing is added for empty parameters
+	if got := new(Parameters).KeyValue(); len(got) != 0 {
+		t.Errorf("KeyValue() of empty parameters = %v", got)
+	}
+}
@@ -0,0 +1,166 @@
+package same
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+const (
+	// SampleRate of the rendered audio, in Hz.
+	SampleRate = 44100
+
+	// AFSK baud rate, and the frequencies of the mark (1)
+	// and space (0) bits, in Hz.
+	baudRate       = 520.83
+	markFrequency  = 2083.3
+	spaceFrequency = 1562.5
+
+	// Frequencies of the two-tone attention signal, in Hz.
+	attentionLow  = 853
+	attentionHigh = 960
+
+	// Frequency of the NOAA Weather Radio attention tone, in Hz.
+	attentionWeather = 1050
+
+	// Byte sent at the start of each burst, 16 times.
+	preamble = 0xab
+
+	// End of message.
+	eom = "NNNN"
+
+	// Amplitude of the audio, out of 1.
+	amplitude = 0.8
+)
+
+// A synth renders the samples of the audio.
+type synth struct {
+	samples []int16
+
+	// Phase of the AFSK signal, kept between bits so it is continuous.
+	phase float64
+
+	// Fractional samples carried between bits.
+	carry float64
+}
+
+func (s *synth) silence(d time.Duration) {
+	n := int(d.Seconds() * SampleRate)
+	s.samples = append(s.samples, make([]int16, n)...)
+}
+
+func (s *synth) bit(mark bool) {
+	frequency := spaceFrequency
+	if mark {
+		frequency = markFrequency
+	}
+
+	s.carry += SampleRate / baudRate
+	n := int(s.carry)
+	s.carry -= float64(n)
+
+	step := 2 * math.Pi * frequency / SampleRate
+	for i := 0; i < n; i++ {
+		s.samples = append(s.samples, int16(amplitude*math.MaxInt16*math.Sin(s.phase)))
+		s.phase = math.Mod(s.phase+step, 2*math.Pi)
+	}
+}
+
+// burst renders the preamble and the data, with the bits
+// of each byte sent least significant first.
+func (s *synth) burst(data string) {
+	bytes := make([]byte, 0, 16+len(data))
+	for i := 0; i < 16; i++ {
+		bytes = append(bytes, preamble)
+	}
+	bytes = append(bytes, data...)
+
+	for _, b := range bytes {
+		for i := uint(0); i < 8; i++ {
+			s.bit(b&(1<<i) != 0)
+		}
+	}
+}
+
+// bursts renders the data three times, each followed by a second of silence.
+func (s *synth) bursts(data string) {
+	for i := 0; i < 3; i++ {
+		s.burst(data)
+		s.silence(time.Second)
+	}
+}
+
+// attention renders the attention signal of the originator: the 1050 Hz
+// tone for the National Weather Service, the two-tone signal otherwise.
+func (s *synth) attention(originator string, d time.Duration) {
+	frequencies := []float64{attentionLow, attentionHigh}
+	if originator == OriginatorWeather {
+		frequencies = []float64{attentionWeather}
+	}
+
+	n := int(d.Seconds() * SampleRate)
+	for i := 0; i < n; i++ {
+		t := float64(i) / SampleRate
+		v := 0.0
+		for _, frequency := range frequencies {
+			v += math.Sin(2 * math.Pi * frequency * t)
+		}
+		v /= float64(len(frequencies))
+		s.samples = append(s.samples, int16(amplitude*math.MaxInt16*v))
+	}
+	s.silence(time.Second)
+}
+
+// Render renders a message for each header: the header, the attention
+// signal for the duration (if non-zero, 8 to 25 seconds) and the end of
+// message, as AFSK audio. The audio is written as a 16-bit mono PCM WAV.
+func Render(w io.Writer, headers []*Header, attention time.Duration) error {
+	s := new(synth)
+	s.silence(time.Second)
+	for _, header := range headers {
+		s.bursts(header.String())
+		if attention > 0 {
+			s.attention(header.Originator, attention)
+		}
+		s.bursts(eom)
+	}
+
+	return writeWAV(w, s.samples)
+}
+
+// writeWAV writes the samples as a 16-bit mono PCM WAV.
+func writeWAV(w io.Writer, samples []int16) error {
+	bw := bufio.NewWriter(w)
+	size := uint32(len(samples) * 2)
+
+	header := []interface{}{
+		[4]byte{'R', 'I', 'F', 'F'},
+		uint32(36 + size),
+		[4]byte{'W', 'A', 'V', 'E'},
+
+		// Format: PCM, mono, 16 bits
+		[4]byte{'f', 'm', 't', ' '},
+		uint32(16),
+		uint16(1),
+		uint16(1),
+		uint32(SampleRate),
+		uint32(SampleRate * 2),
+		uint16(2),
+		uint16(16),
+
+		[4]byte{'d', 'a', 't', 'a'},
+		size,
+	}
+	for _, v := range header {
+		if err := binary.Write(bw, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	if err := binary.Write(bw, binary.LittleEndian, samples); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,187 @@
+package same
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+// power returns the power of the frequency in the samples (Goertzel).
+func power(samples []int16, frequency float64) float64 {
+	coeff := 2 * math.Cos(2*math.Pi*frequency/SampleRate)
+	var s1, s2 float64
+	for _, sample := range samples {
+		s := float64(sample) + coeff*s1 - s2
+		s2, s1 = s1, s
+	}
+	return s1*s1 + s2*s2 - coeff*s1*s2
+}
+
+// demodulate decodes n bytes, sent least significant bit first, from
+// the samples. The bits are taken at their ideal positions, so errors
+// in the bit timing accumulate and corrupt the bytes.
+func demodulate(samples []int16, n int) []byte {
+	bitLength := SampleRate / baudRate
+	decoded := make([]byte, n)
+	for i := 0; i < n*8; i++ {
+		start := int(math.Round(float64(i) * bitLength))
+		end := int(math.Round(float64(i+1) * bitLength))
+		if end > len(samples) {
+			break
+		}
+
+		// Skip the edges, where the previous or next bit may bleed in
+		window := samples[start+4 : end-4]
+		if power(window, markFrequency) > power(window, spaceFrequency) {
+			decoded[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return decoded
+}
+
+// readWAV reads the samples of a 16-bit mono PCM WAV, checking its header.
+func readWAV(t *testing.T, data []byte) []int16 {
+	if len(data) < 44 || string(data[:4]) != "RIFF" || string(data[8:16]) != "WAVEfmt " || string(data[36:40]) != "data" {
+		t.Fatalf("Invalid WAV header: %q", data[:44])
+	}
+
+	var format struct {
+		Format        uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+	}
+	if err := binary.Read(bytes.NewReader(data[20:36]), binary.LittleEndian, &format); err != nil {
+		t.Fatal(err)
+	}
+	if format.Format != 1 || format.Channels != 1 || format.SampleRate != SampleRate || format.BitsPerSample != 16 {
+		t.Fatalf("WAV format = %+v, want 16-bit mono PCM at %d Hz", format, SampleRate)
+	}
+
+	size := binary.LittleEndian.Uint32(data[40:44])
+	if int(size) != len(data)-44 || binary.LittleEndian.Uint32(data[4:8]) != 36+size {
+		t.Fatalf("WAV sizes don't match the %d bytes of data", len(data)-44)
+	}
+
+	samples := make([]int16, size/2)
+	if err := binary.Read(bytes.NewReader(data[44:]), binary.LittleEndian, samples); err != nil {
+		t.Fatal(err)
+	}
+	return samples
+}
+
+func TestBurst(t *testing.T) {
+	header := "ZCZC-WXR-TOR-020177-020149+0045-1482141-KTOP/NWS-"
+
+	s := new(synth)
+	s.burst(header)
+
+	// 520.83 bits per second, without accumulating rounding errors
+	bits := (16 + len(header)) * 8
+	if want := float64(bits) * SampleRate / baudRate; math.Abs(float64(len(s.samples))-want) > 1 {
+		t.Errorf("Burst of %d bits is %d samples, want %.0f", bits, len(s.samples), want)
+	}
+
+	decoded := demodulate(s.samples, 16+len(header))
+	for i := 0; i < 16; i++ {
+		if decoded[i] != 0xab {
+			t.Fatalf("Preamble byte %d = %#x, want 0xab", i, decoded[i])
+		}
+	}
+	if got := string(decoded[16:]); got != header {
+		t.Errorf("Decoded %q, want %q", got, header)
+	}
+}
+
+func TestBitOrder(t *testing.T) {
+	s := new(synth)
+	s.burst("")
+
+	// 0xab, least significant bit first
+	want := []bool{true, true, false, true, false, true, false, true}
+	bitLength := SampleRate / baudRate
+	for i, mark := range want {
+		window := s.samples[int(math.Round(float64(i)*bitLength))+4 : int(math.Round(float64(i+1)*bitLength))-4]
+		if got := power(window, markFrequency) > power(window, spaceFrequency); got != mark {
+			t.Errorf("Bit %d is mark: %v, want %v", i, got, mark)
+		}
+	}
+}
+
+func TestAttention(t *testing.T) {
+	tests := []struct {
+		originator string
+		present    []float64
+		absent     []float64
+	}{
+		{OriginatorWeather, []float64{attentionWeather}, []float64{attentionLow, attentionHigh}},
+		{"CIV", []float64{attentionLow, attentionHigh}, []float64{attentionWeather}},
+		{"EAS", []float64{attentionLow, attentionHigh}, []float64{attentionWeather}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.originator, func(t *testing.T) {
+			s := new(synth)
+			s.attention(test.originator, time.Second)
+
+			// The tone is followed by a second of silence
+			if len(s.samples) != 2*SampleRate {
+				t.Fatalf("Attention is %d samples, want %d", len(s.samples), 2*SampleRate)
+			}
+			tone := s.samples[:SampleRate]
+
+			for _, present := range test.present {
+				for _, absent := range test.absent {
+					if power(tone, present) < 100*power(tone, absent) {
+						t.Errorf("%v Hz is not stronger than %v Hz", present, absent)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	headers := []*Header{
+		{Originator: OriginatorWeather, Event: "TOR", Locations: []string{"020177"}, Purge: 45 * time.Minute, Sender: "KTOP/NWS"},
+		{Originator: OriginatorWeather, Event: "TOR", Locations: []string{"020149"}, Purge: 45 * time.Minute, Sender: "KTOP/NWS"},
+	}
+
+	var buf bytes.Buffer
+	if err := Render(&buf, headers, 8*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	samples := readWAV(t, buf.Bytes())
+
+	// Leading silence
+	for i, sample := range samples[:SampleRate] {
+		if sample != 0 {
+			t.Fatalf("Sample %d = %d, want silence", i, sample)
+		}
+	}
+
+	// Each message: three header bursts, the attention tone, and three
+	// end of message bursts, each followed by a second of silence
+	burst := func(data string) int {
+		s := new(synth)
+		s.burst(data)
+		return len(s.samples)
+	}
+	var want int
+	for _, header := range headers {
+		want += 3*(burst(header.String())+SampleRate) + 9*SampleRate + 3*(burst(eom)+SampleRate)
+	}
+	if got := len(samples) - SampleRate; math.Abs(float64(got-want)) > 6 {
+		t.Errorf("Messages are %d samples, want %d", got, want)
+	}
+
+	// The first burst starts after the leading silence
+	str := headers[0].String()
+	if got := string(demodulate(samples[SampleRate:], 16+len(str))[16:]); got != str {
+		t.Errorf("First burst = %q, want %q", got, str)
+	}
+}
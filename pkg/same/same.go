@@ -0,0 +1,196 @@
+package same
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alerting/alerts-nws/pkg/vtec"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+const (
+	// OriginatorWeather is the originator code of the National Weather Service.
+	OriginatorWeather = "WXR"
+
+	// Most locations a header may contain.
+	maxLocations = 31
+
+	// Longest purge time a header may contain.
+	maxPurge = 99*time.Hour + 30*time.Minute
+)
+
+// ErrNoEvent is returned when an alert has no SAME event code.
+var ErrNoEvent = errors.New("No SAME event code")
+
+var headerRegexp = regexp.MustCompile(`^ZCZC-([A-Z]{3})-([A-Z0-9]{3})-((?:\d{6}-)*\d{6})\+(\d{2})(\d{2})-(\d{3})(\d{2})(\d{2})-([^-]{1,8})-$`)
+
+var locationRegexp = regexp.MustCompile(`^\d{6}$`)
+
+// A Header is a SAME (Specific Area Message Encoding) header.
+type Header struct {
+	// Originator code (ex. WXR).
+	Originator string
+
+	// Event code (ex. TOR).
+	Event string
+
+	// Locations, as PSSCCC codes (ex. 020177).
+	Locations []string
+
+	// How long the message is valid for.
+	Purge time.Duration
+
+	// Time the message was issued.
+	Issued time.Time
+
+	// Identification of the sender (ex. KTOP/NWS).
+	Sender string
+}
+
+// roundPurge rounds the purge time up to a valid increment: 15 minutes
+// up to an hour, and 30 minutes beyond.
+func roundPurge(d time.Duration) time.Duration {
+	increment := 15 * time.Minute
+	if d > time.Hour {
+		increment = 30 * time.Minute
+	}
+
+	if rem := d % increment; rem != 0 {
+		d += increment - rem
+	}
+	if d <= 0 {
+		d = 15 * time.Minute
+	}
+	if d > maxPurge {
+		d = maxPurge
+	}
+	return d
+}
+
+// String returns the header, ex. ZCZC-WXR-TOR-020177+0045-1402205-KTOP/NWS-.
+func (header *Header) String() string {
+	purge := roundPurge(header.Purge)
+	issued := header.Issued.UTC()
+
+	return fmt.Sprintf("ZCZC-%s-%s-%s+%02d%02d-%03d%02d%02d-%s-",
+		header.Originator, header.Event, strings.Join(header.Locations, "-"),
+		int(purge/time.Hour), int(purge%time.Hour/time.Minute),
+		issued.YearDay(), issued.Hour(), issued.Minute(),
+		header.Sender)
+}
+
+// ParseHeader parses a header. As the header does not contain the year,
+// the issued time is in the given year.
+func ParseHeader(str string, year int) (*Header, error) {
+	match := headerRegexp.FindStringSubmatch(str)
+	if match == nil {
+		return nil, fmt.Errorf("Invalid SAME header: %q", str)
+	}
+
+	atoi := func(s string) int {
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+
+	return &Header{
+		Originator: match[1],
+		Event:      match[2],
+		Locations:  strings.Split(match[3], "-"),
+		Purge:      time.Duration(atoi(match[4]))*time.Hour + time.Duration(atoi(match[5]))*time.Minute,
+		Issued: time.Date(year, time.January, 1, atoi(match[7]), atoi(match[8]), 0, 0, time.UTC).
+			AddDate(0, 0, atoi(match[6])-1),
+		Sender: match[9],
+	}, nil
+}
+
+// sender returns the sender of the alert's info: the office of its
+// WMO identifier or VTEC, followed by /NWS.
+func sender(info *capxml.Info) string {
+	office := ""
+	if values := info.Parameters["WMOidentifier"]; len(values) > 0 {
+		if fields := strings.Fields(values[0]); len(fields) >= 2 {
+			office = fields[1]
+		}
+	}
+
+	if office == "" {
+		for _, str := range info.Parameters["VTEC"] {
+			if pvtec, err := vtec.ParsePVTEC(str); err == nil {
+				office = pvtec.Office
+				break
+			}
+		}
+	}
+
+	if len(office) > 4 {
+		office = office[:4]
+	}
+	return office + "/NWS"
+}
+
+// FromAlert returns the headers of the first of the alert's infos with a
+// SAME event code. The originator is taken from the EAS-ORG parameter,
+// the locations from the SAME geocodes, and the purge time from the
+// time between the alert being sent and the info expiring. As a header
+// holds at most 31 locations, a header is returned for every 31.
+func FromAlert(alert *capxml.Alert) ([]*Header, error) {
+	for _, info := range alert.Infos {
+		events := info.EventCodes["SAME"]
+		if len(events) == 0 || events[0] == "" {
+			continue
+		}
+
+		header := &Header{
+			Originator: OriginatorWeather,
+			Event:      strings.ToUpper(events[0]),
+			Issued:     alert.Sent.Time,
+			Sender:     sender(info),
+		}
+
+		if values := info.Parameters["EAS-ORG"]; len(values) > 0 && values[0] != "" {
+			header.Originator = strings.ToUpper(values[0])
+		}
+
+		if info.Expires != nil {
+			header.Purge = info.Expires.Sub(alert.Sent.Time)
+		}
+
+		seen := make(map[string]bool)
+		for _, area := range info.Areas {
+			for _, code := range area.GeoCodes["SAME"] {
+				if len(code) == 5 {
+					code = "0" + code
+				}
+				if !locationRegexp.MatchString(code) || seen[code] {
+					continue
+				}
+				seen[code] = true
+				header.Locations = append(header.Locations, code)
+			}
+		}
+
+		if len(header.Locations) == 0 {
+			return nil, errors.New("No SAME locations")
+		}
+
+		var headers []*Header
+		for i := 0; i < len(header.Locations); i += maxLocations {
+			end := i + maxLocations
+			if end > len(header.Locations) {
+				end = len(header.Locations)
+			}
+
+			h := *header
+			h.Locations = header.Locations[i:end]
+			headers = append(headers, &h)
+		}
+
+		return headers, nil
+	}
+
+	return nil, ErrNoEvent
+}
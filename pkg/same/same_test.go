@@ -0,0 +1,170 @@
+package same
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+func TestHeader(t *testing.T) {
+	issued := time.Date(2019, time.May, 28, 21, 41, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		header *Header
+		want   string
+		purge  time.Duration
+	}{
+		{
+			name: "tornado warning",
+			header: &Header{
+				Originator: OriginatorWeather,
+				Event:      "TOR",
+				Locations:  []string{"020177", "020149"},
+				Purge:      45 * time.Minute,
+				Issued:     issued,
+				Sender:     "KTOP/NWS",
+			},
+			want:  "ZCZC-WXR-TOR-020177-020149+0045-1482141-KTOP/NWS-",
+			purge: 45 * time.Minute,
+		},
+		{
+			name: "purge rounded to 15 minutes",
+			header: &Header{
+				Originator: OriginatorWeather,
+				Event:      "SVR",
+				Locations:  []string{"020161"},
+				Purge:      50 * time.Minute,
+				Issued:     issued,
+				Sender:     "KTOP/NWS",
+			},
+			want:  "ZCZC-WXR-SVR-020161+0100-1482141-KTOP/NWS-",
+			purge: time.Hour,
+		},
+		{
+			name: "purge rounded to 30 minutes",
+			header: &Header{
+				Originator: "CIV",
+				Event:      "CAE",
+				Locations:  []string{"000000"},
+				Purge:      61 * time.Minute,
+				Issued:     time.Date(2019, time.January, 1, 0, 5, 0, 0, time.UTC),
+				Sender:     "KCIV",
+			},
+			want:  "ZCZC-CIV-CAE-000000+0130-0010005-KCIV-",
+			purge: 90 * time.Minute,
+		},
+		{
+			name: "longest purge",
+			header: &Header{
+				Originator: OriginatorWeather,
+				Event:      "FLW",
+				Locations:  []string{"005001"},
+				Purge:      200 * time.Hour,
+				Issued:     time.Date(2019, time.December, 31, 23, 59, 0, 0, time.UTC),
+				Sender:     "KLZK/NWS",
+			},
+			want:  "ZCZC-WXR-FLW-005001+9930-3652359-KLZK/NWS-",
+			purge: maxPurge,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			str := test.header.String()
+			if str != test.want {
+				t.Fatalf("String() = %q, want %q", str, test.want)
+			}
+
+			got, err := ParseHeader(str, test.header.Issued.Year())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := *test.header
+			want.Purge = test.purge
+			if !reflect.DeepEqual(got, &want) {
+				t.Errorf("ParseHeader(%q) = %+v, want %+v", str, got, &want)
+			}
+			if got.String() != str {
+				t.Errorf("String() of the parsed header = %q, want %q", got.String(), str)
+			}
+		})
+	}
+}
+
+func TestParseHeaderInvalid(t *testing.T) {
+	for _, str := range []string{
+		"",
+		"ZCZC-WXR-TOR-020177+0045-1482141-KTOP/NWS",
+		"ZCZC-WXR-TOR-20177+0045-1482141-KTOP/NWS-",
+		"ZCZC-WXR-TOR-020177+0045-1482141-KTOP/NWS/TOO/LONG-",
+		"NNNN",
+	} {
+		if _, err := ParseHeader(str, 2019); err == nil {
+			t.Errorf("ParseHeader(%q) succeeded", str)
+		}
+	}
+}
+
+func TestFromAlert(t *testing.T) {
+	sent := time.Date(2019, time.May, 28, 21, 41, 0, 0, time.UTC)
+	expires := sent.Add(34 * time.Minute)
+
+	// 40 locations, with a duplicate and one missing its leading zero
+	var codes []string
+	for i := 1; i <= 40; i++ {
+		codes = append(codes, fmt.Sprintf("20%03d", i))
+	}
+	codes = append(codes, "020001")
+
+	alert := &capxml.Alert{
+		Sent: capxml.Time{Time: sent},
+		Infos: []*capxml.Info{
+			{
+				Event:      "Tornado Warning",
+				EventCodes: capxml.KeyValue{"SAME": {"tor"}},
+				Expires:    &capxml.Time{Time: expires},
+				Parameters: capxml.KeyValue{
+					"WMOidentifier": {"WFUS53 KTOP 282141"},
+					"EAS-ORG":       {"WXR"},
+				},
+				Areas: []*capxml.Area{
+					{GeoCodes: capxml.KeyValue{"SAME": codes}},
+				},
+			},
+		},
+	}
+
+	headers, err := FromAlert(alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headers) != 2 {
+		t.Fatalf("FromAlert() returned %d header(s), want 2", len(headers))
+	}
+	if len(headers[0].Locations) != maxLocations || len(headers[1].Locations) != 40-maxLocations {
+		t.Errorf("Headers have %d and %d locations, want %d and %d",
+			len(headers[0].Locations), len(headers[1].Locations), maxLocations, 40-maxLocations)
+	}
+	if headers[0].Locations[0] != "020001" || headers[1].Locations[0] != "020032" || headers[1].Locations[8] != "020040" {
+		t.Errorf("Locations = %v, %v", headers[0].Locations, headers[1].Locations)
+	}
+
+	for _, header := range headers {
+		if header.Originator != "WXR" || header.Event != "TOR" || header.Sender != "KTOP/NWS" || header.Purge != 34*time.Minute || !header.Issued.Equal(sent) {
+			t.Errorf("Header = %+v", header)
+		}
+	}
+	if got, want := headers[1].String(), "ZCZC-WXR-TOR-020032-020033-020034-020035-020036-020037-020038-020039-020040+0045-1482141-KTOP/NWS-"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	alert.Infos[0].EventCodes = nil
+	if _, err := FromAlert(alert); err != ErrNoEvent {
+		t.Errorf("FromAlert() without an event code error = %v, want %v", err, ErrNoEvent)
+	}
+}
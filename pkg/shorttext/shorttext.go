@@ -0,0 +1,249 @@
+package shorttext
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+// Lengths of the renderings, in characters (runes).
+const (
+	// LengthShort is the length of short messages (ex. WEA 90 characters).
+	LengthShort = 90
+
+	// LengthSMS is the length of an SMS.
+	LengthSMS = 160
+
+	// LengthLong is the length of long messages (ex. WEA 360 characters).
+	LengthLong = 360
+)
+
+const (
+	// Format of the expiry time, ex. 9:00 PM CDT.
+	timeFormat = "3:04 PM MST"
+
+	// Appended to text that has been cut short.
+	ellipsis = "..."
+)
+
+// DefaultAbbreviations are the abbreviations used, by default,
+// when the full text is too long.
+var DefaultAbbreviations = map[string]string{
+	"Advisory":     "Adv",
+	"Central":      "Cntrl",
+	"Counties":     "Cos",
+	"County":       "Co",
+	"Eastern":      "E",
+	"Northeast":    "NE",
+	"Northern":     "N",
+	"Northwest":    "NW",
+	"Southeast":    "SE",
+	"Southern":     "S",
+	"Southwest":    "SW",
+	"Statement":    "Stmt",
+	"Thunderstorm": "Tstm",
+	"Warning":      "Wrn",
+	"Watch":        "Wch",
+	"Western":      "W",
+	"until":        "til",
+}
+
+// A Renderer renders short texts of alerts.
+type Renderer struct {
+	abbreviations []abbreviation
+}
+
+type abbreviation struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// NewRenderer returns a renderer using the default abbreviations, along
+// with the given abbreviations. An empty abbreviation removes a default.
+func NewRenderer(abbreviations map[string]string) *Renderer {
+	merged := make(map[string]string)
+	for word, abbr := range DefaultAbbreviations {
+		merged[word] = abbr
+	}
+	for word, abbr := range abbreviations {
+		if abbr == "" {
+			delete(merged, word)
+		} else {
+			merged[word] = abbr
+		}
+	}
+
+	// Longest words first, so phrases are abbreviated before their words
+	words := make([]string, 0, len(merged))
+	for word := range merged {
+		words = append(words, word)
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if len(words[i]) != len(words[j]) {
+			return len(words[i]) > len(words[j])
+		}
+		return words[i] < words[j]
+	})
+
+	renderer := new(Renderer)
+	for _, word := range words {
+		renderer.abbreviations = append(renderer.abbreviations, abbreviation{
+			re:          regexp.MustCompile(`\b` + regexp.QuoteMeta(word) + `\b`),
+			replacement: merged[word],
+		})
+	}
+	return renderer
+}
+
+// abbreviate abbreviates the words of the text.
+func (renderer *Renderer) abbreviate(text string) string {
+	for _, abbr := range renderer.abbreviations {
+		text = abbr.re.ReplaceAllLiteralString(text, abbr.replacement)
+	}
+	return text
+}
+
+// areas returns the names of the info's zones, from the zone
+// metadata, or the descriptions of its areas.
+func areas(info *capxml.Info) []string {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if name = strings.TrimSpace(name); name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	for _, area := range info.Areas {
+		for _, name := range area.GeoCodes["UGC-name"] {
+			add(name)
+		}
+	}
+	if len(names) > 0 {
+		return names
+	}
+
+	for _, area := range info.Areas {
+		for _, name := range strings.Split(area.Description, ";") {
+			add(name)
+		}
+	}
+	return names
+}
+
+// threats returns the key threats of the info, from its decoded NWS parameters.
+func threats(info *capxml.Info) []string {
+	var threats []string
+	add := func(label, key string) {
+		if values := info.Parameters["NWS-"+key]; len(values) > 0 && values[0] != "" && values[0] != "base" {
+			threats = append(threats, label+" "+values[0])
+		}
+	}
+
+	add("Tornado", "tornadoDetection")
+	add("Tornado damage", "tornadoDamageThreat")
+	add("Damage", "thunderstormDamageThreat")
+	add("Hail", "maxHailSize")
+	add("Wind", "maxWindGust")
+	return threats
+}
+
+// text builds the text from the event, the first n areas,
+// the expiry time and the threats.
+func text(event string, areas []string, n int, until string, threats []string) string {
+	var b strings.Builder
+	b.WriteString(event)
+
+	if len(areas) > 0 {
+		b.WriteString(" for ")
+		if n == 0 {
+			fmt.Fprintf(&b, "%d areas", len(areas))
+		} else {
+			b.WriteString(strings.Join(areas[:n], ", "))
+			if n < len(areas) {
+				fmt.Fprintf(&b, " +%d more", len(areas)-n)
+			}
+		}
+	}
+
+	if until != "" {
+		b.WriteString(" until ")
+		b.WriteString(until)
+	}
+	b.WriteString(".")
+
+	if len(threats) > 0 {
+		b.WriteString(" ")
+		b.WriteString(strings.Join(threats, ", "))
+		b.WriteString(".")
+	}
+
+	return b.String()
+}
+
+// prefix returns the first n characters of the text.
+func prefix(text string, n int) string {
+	for i := range text {
+		if n == 0 {
+			return text[:i]
+		}
+		n--
+	}
+	return text
+}
+
+// truncate cuts the text to the length in characters, at a word
+// boundary if possible.
+func truncate(text string, length int) string {
+	if utf8.RuneCountInString(text) <= length {
+		return text
+	}
+	if length <= len(ellipsis) {
+		return prefix(text, length)
+	}
+
+	cut := prefix(text, length-len(ellipsis))
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.") + ellipsis
+}
+
+// Render renders the info in at most length characters (runes), with the expiry
+// time in the location. The text is shortened, in order, by abbreviating,
+// dropping threats, listing fewer areas, and finally cutting it short.
+// The same info always renders to the same text.
+func (renderer *Renderer) Render(info *capxml.Info, loc *time.Location, length int) string {
+	until := ""
+	if info.Expires != nil && !info.Expires.IsZero() {
+		if loc == nil {
+			loc = time.UTC
+		}
+		until = info.Expires.In(loc).Format(timeFormat)
+	}
+
+	areas := areas(info)
+	threats := threats(info)
+
+	if str := text(info.Event, areas, len(areas), until, threats); utf8.RuneCountInString(str) <= length {
+		return str
+	}
+
+	var shortest string
+	for n := len(areas); n >= 0; n-- {
+		for t := len(threats); t >= 0; t-- {
+			shortest = renderer.abbreviate(text(info.Event, areas, n, until, threats[:t]))
+			if utf8.RuneCountInString(shortest) <= length {
+				return shortest
+			}
+		}
+	}
+
+	return truncate(shortest, length)
+}
@@ -0,0 +1,125 @@
+package shorttext
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+func testInfo(event string, names ...string) *capxml.Info {
+	expires, _ := time.Parse(time.RFC3339, "2019-05-28T17:15:00-05:00")
+	return &capxml.Info{
+		Event:   event,
+		Expires: &capxml.Time{Time: expires},
+		Parameters: capxml.KeyValue{
+			"NWS-maxHailSize": {"1.00"},
+			"NWS-maxWindGust": {"60 MPH"},
+		},
+		Areas: []*capxml.Area{
+			{
+				Description: strings.Join(names, "; "),
+			},
+		},
+	}
+}
+
+func TestRender(t *testing.T) {
+	loc, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Skip(err)
+	}
+	renderer := NewRenderer(nil)
+
+	tests := []struct {
+		name   string
+		info   *capxml.Info
+		length int
+		want   string
+	}{
+		{
+			name:   "fits",
+			info:   testInfo("Severe Thunderstorm Warning", "Riley", "Pottawatomie"),
+			length: LengthSMS,
+			want:   "Severe Thunderstorm Warning for Riley, Pottawatomie until 5:15 PM CDT. Hail 1.00, Wind 60 MPH.",
+		},
+		{
+			name:   "abbreviated",
+			info:   testInfo("Severe Thunderstorm Warning", "Riley", "Pottawatomie"),
+			length: LengthShort,
+			want:   "Severe Tstm Wrn for Riley, Pottawatomie til 5:15 PM CDT. Hail 1.00, Wind 60 MPH.",
+		},
+		{
+			name:   "fewer areas",
+			info:   testInfo("Flood Warning", "Doña Ana", "Sierra", "Otero", "Lincoln", "Socorro", "Catron", "Grant", "Luna", "Hidalgo"),
+			length: LengthShort,
+			want:   "Flood Wrn for Doña Ana, Sierra, Otero, Lincoln, Socorro, Catron +3 more til 5:15 PM CDT.",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := renderer.Render(test.info, loc, test.length); got != test.want {
+				t.Errorf("Render() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRenderLimits(t *testing.T) {
+	// Multi-byte names, so bytes and characters differ
+	var names []string
+	for _, name := range []string{"Añasco", "Bayamón", "Canóvanas", "Cataño", "Comerío", "Guánica", "Juana Díaz", "Las Marías", "Loíza", "Mayagüez", "Peñuelas", "Río Grande", "Rincón", "San Germán", "San Sebastián"} {
+		names = append(names, name+" Municipio")
+	}
+	info := testInfo("Flash Flood Warning", names...)
+	info.Event = "Flash Flood Warning — Extreme Rainfall Emergency Statement For Southwestern Puerto Rico Municipalities"
+
+	renderer := NewRenderer(nil)
+	for _, length := range []int{LengthShort, LengthSMS, LengthLong, 3, 10} {
+		got := renderer.Render(info, time.UTC, length)
+		if n := utf8.RuneCountInString(got); n > length {
+			t.Errorf("Render(%d) is %d characters: %q", length, n, got)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("Render(%d) = %q, which is not valid UTF-8", length, got)
+		}
+	}
+}
+
+func TestRenderDeterministic(t *testing.T) {
+	info := testInfo("Severe Thunderstorm Warning", "Northern Riley County", "Southeastern Pottawatomie County", "Western Wabaunsee County", "Central Geary County")
+
+	want := NewRenderer(nil).Render(info, time.UTC, LengthShort)
+	for i := 0; i < 20; i++ {
+		if got := NewRenderer(nil).Render(info, time.UTC, LengthShort); got != want {
+			t.Fatalf("Render() = %q, then %q", want, got)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		text   string
+		length int
+		want   string
+	}{
+		{"short", 10, "short"},
+		{"Tornado Warning for Doña Ana County", 20, "Tornado Warning..."},
+		{"Añasco, Bayamón, Canóvanas", 14, "Añasco..."},
+		{"ñññññ", 3, "ñññ"},
+		{"Mayagüez", 8, "Mayagüez"},
+	}
+
+	for _, test := range tests {
+		got := truncate(test.text, test.length)
+		if got != test.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", test.text, test.length, got, test.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncate(%q, %d) = %q, which is not valid UTF-8", test.text, test.length, got)
+		}
+	}
+}
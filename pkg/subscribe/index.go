@@ -0,0 +1,120 @@
+package subscribe
+
+import (
+	"math"
+
+	"github.com/alerting/alerts-nws/pkg/zones"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+	"github.com/lovoo/goka"
+)
+
+// Size of the index's grid cells, in degrees.
+const cellSize = 0.25
+
+type cell struct {
+	x, y int
+}
+
+func cellOf(lon, lat float64) cell {
+	return cell{int(math.Floor(lon / cellSize)), int(math.Floor(lat / cellSize))}
+}
+
+// An Index is a spatial index of subscriptions. Point subscriptions are
+// kept in a grid, so only the points near a polygon are tested against it.
+type Index struct {
+	cells map[cell][]*Subscription
+	ugcs  map[string][]*Subscription
+}
+
+// NewIndex returns an index of the subscriptions.
+func NewIndex(subscriptions []*Subscription) *Index {
+	index := &Index{
+		cells: make(map[cell][]*Subscription),
+		ugcs:  make(map[string][]*Subscription),
+	}
+
+	for _, subscription := range subscriptions {
+		if subscription.UGC != "" {
+			index.ugcs[subscription.UGC] = append(index.ugcs[subscription.UGC], subscription)
+		} else {
+			c := cellOf(subscription.Lon, subscription.Lat)
+			index.cells[c] = append(index.cells[c], subscription)
+		}
+	}
+
+	return index
+}
+
+// loadIndex returns an index of the subscriptions in the view.
+func loadIndex(view *goka.View) (*Index, error) {
+	it, err := view.Iterator()
+	if err != nil {
+		return nil, err
+	}
+	defer it.Release()
+
+	var subscriptions []*Subscription
+	for it.Next() {
+		value, err := it.Value()
+		if err != nil {
+			return nil, err
+		}
+		if subscription, ok := value.(*Subscription); ok {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+
+	return NewIndex(subscriptions), nil
+}
+
+// Len returns the number of subscriptions in the index.
+func (index *Index) Len() int {
+	n := 0
+	for _, subscriptions := range index.cells {
+		n += len(subscriptions)
+	}
+	for _, subscriptions := range index.ugcs {
+		n += len(subscriptions)
+	}
+	return n
+}
+
+// Match returns the subscriptions covered by the info's areas: the points
+// inside the areas' polygons (which include the polygons filled from the
+// UGC codes), and the zones of the areas' UGC codes.
+func (index *Index) Match(info *capxml.Info) []*Subscription {
+	var matches []*Subscription
+	seen := make(map[*Subscription]bool)
+	add := func(subscription *Subscription) {
+		if !seen[subscription] {
+			seen[subscription] = true
+			matches = append(matches, subscription)
+		}
+	}
+
+	for _, area := range info.Areas {
+		for _, ugc := range area.GeoCodes["UGC"] {
+			for _, subscription := range index.ugcs[ugc] {
+				add(subscription)
+			}
+		}
+
+		for _, polygon := range area.Polygons {
+			bounds := zones.Bounds(polygon)
+			min := cellOf(bounds.MinX, bounds.MinY)
+			max := cellOf(bounds.MaxX, bounds.MaxY)
+
+			for x := min.x; x <= max.x; x++ {
+				for y := min.y; y <= max.y; y++ {
+					for _, subscription := range index.cells[cell{x, y}] {
+						if !seen[subscription] && zones.Contains(polygon, subscription.Lon, subscription.Lat) {
+							add(subscription)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return matches
+}
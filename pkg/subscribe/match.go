@@ -0,0 +1,361 @@
+package subscribe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/alerting/alerts-naads/pkg/codec"
+	"github.com/alerting/alerts-nws/pkg/events"
+	"github.com/alerting/alerts-nws/pkg/motion"
+	"github.com/alerting/alerts-nws/pkg/vtec"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+	"github.com/lovoo/goka"
+)
+
+const (
+	// How often the index is rebuilt from the subscription table.
+	indexRefreshInterval = 30 * time.Second
+
+	// How long to remember what a subscriber was notified of,
+	// after the alert expires.
+	notifiedRetention = 7 * 24 * time.Hour
+)
+
+// Config is the configuration for the subscription processors.
+type Config struct {
+	Brokers []string
+
+	// The subscription table is kept by the <Group>-subscriptions group.
+	Group string
+
+	// Topic of stored alerts (see consume.Config.StoredTopic).
+	StoredTopic string
+
+	// Topic of subscription messages, keyed by subscription ID.
+	SubscriptionsTopic string
+
+	// Topic for notifications, keyed by subscriber.
+	NotificationsTopic string
+}
+
+// A match is a loopback message, keyed by subscription ID,
+// sent when an alert covers the subscription.
+type match struct {
+	Notification *Notification `json:"notification"`
+
+	// Keys the subscriber is notified of the alert by: its VTEC event
+	// keys, or its ID if it has no VTEC.
+	Keys []string `json:"keys"`
+
+	// IDs of the alerts referenced by the alert.
+	References []string `json:"references,omitempty"`
+
+	Cancel  bool      `json:"cancel,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+// notifiedKey records a key a subscriber was notified of.
+type notifiedKey struct {
+	Cancelled bool      `json:"cancelled,omitempty"`
+	Expires   time.Time `json:"expires"`
+}
+
+// notified records what a subscription was notified of.
+// The group table is keyed by subscription ID.
+type notified struct {
+	Keys map[string]*notifiedKey `json:"keys"`
+}
+
+type matchCodec struct{}
+
+func (c *matchCodec) Encode(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case *match:
+		return json.Marshal(v)
+	default:
+		return nil, errors.New("Unknown type provided")
+	}
+}
+
+func (c *matchCodec) Decode(data []byte) (interface{}, error) {
+	var m match
+	err := json.Unmarshal(data, &m)
+	return &m, err
+}
+
+type notifiedCodec struct{}
+
+func (c *notifiedCodec) Encode(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case *notified:
+		return json.Marshal(v)
+	default:
+		return nil, errors.New("Unknown type provided")
+	}
+}
+
+func (c *notifiedCodec) Decode(data []byte) (interface{}, error) {
+	var n notified
+	err := json.Unmarshal(data, &n)
+	return &n, err
+}
+
+// eventKeys returns the keys of the info's VTEC events, and whether
+// the alert cancels the events (or the alert, if it has none).
+func eventKeys(alert *capxml.Alert, info *capxml.Info) ([]string, bool) {
+	pvtecs, keys := events.Keys(alert, info)
+	cancel := alert.MessageType == capxml.MessageTypeCancel
+	ended := true
+
+	for _, pvtec := range pvtecs {
+		switch pvtec.Action {
+		case vtec.ActionCancel, vtec.ActionExpire, vtec.ActionUpgrade:
+		default:
+			ended = false
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, cancel
+	}
+	return keys, cancel || ended
+}
+
+// addETA adds the time the storm described by the info's event motion is
+// projected to be closest to the subscription's point to the notification.
+func addETA(notification *Notification, info *capxml.Info, subscription *Subscription) {
+	if subscription.UGC != "" {
+		return
+	}
+
+	str := ""
+	if values := info.Parameters["eventMotionDescription"]; len(values) > 0 {
+		str = values[0]
+	}
+	if str == "" {
+		return
+	}
+
+	m, err := motion.Parse(str)
+	if err != nil {
+		log.Printf("Unable to parse event motion %q: %v", str, err)
+		return
+	}
+
+	eta, distance := m.ETA(motion.Point{Lat: subscription.Lat, Lon: subscription.Lon})
+	notification.ETA = &eta
+	notification.Distance = distance
+}
+
+// collectAlert finds the subscriptions covered by the stored alert,
+// sending a match to each through the loopback topic.
+func collectAlert(index *atomic.Value) func(ctx goka.Context, msg interface{}) {
+	return func(gctx goka.Context, msg interface{}) {
+		alert := msg.(capxml.Alert)
+		idx := index.Load().(*Index)
+
+		var references []string
+		for _, reference := range alert.References {
+			references = append(references, reference.ID())
+		}
+
+		// Each subscription is matched once, by the first info covering it
+		// that the subscription wants
+		matched := make(map[string]bool)
+		for _, info := range alert.Infos {
+			vtecKeys, cancel := eventKeys(&alert, info)
+			keys := vtecKeys
+			if len(keys) == 0 {
+				keys = []string{alert.ID()}
+			}
+
+			expires := alert.Sent.Time
+			if info.Expires != nil {
+				expires = info.Expires.Time
+			}
+
+			for _, subscription := range idx.Match(info) {
+				if matched[subscription.ID] || !subscription.wants(info) {
+					continue
+				}
+				matched[subscription.ID] = true
+
+				notification := &Notification{
+					SubscriptionID: subscription.ID,
+					Subscriber:     subscription.Subscriber,
+					AlertID:        alert.ID(),
+					Event:          info.Event,
+					Headline:       info.Headline,
+					Severity:       info.Severity.String(),
+					Sent:           alert.Sent.Time,
+					EventKeys:      vtecKeys,
+				}
+				addETA(notification, info, subscription)
+
+				gctx.Loopback(subscription.ID, &match{
+					Notification: notification,
+					Keys:         keys,
+					References:   references,
+					Cancel:       cancel,
+					Expires:      expires,
+				})
+			}
+		}
+
+		if len(matched) > 0 {
+			log.Printf("Alert %s covers %d subscription(s)", alert.ID(), len(matched))
+		}
+	}
+}
+
+// collectMatch notifies the subscriber of the match, unless they were
+// already notified of the same VTEC event, or of an alert it references.
+func collectMatch(notificationsTopic goka.Stream) func(ctx goka.Context, msg interface{}) {
+	return func(gctx goka.Context, msg interface{}) {
+		m := msg.(*match)
+
+		n, _ := gctx.Value().(*notified)
+		if n == nil {
+			n = &notified{Keys: make(map[string]*notifiedKey)}
+		}
+
+		// Forget what has long expired
+		now := time.Now()
+		for key, nk := range n.Keys {
+			if now.Sub(nk.Expires) > notifiedRetention {
+				delete(n.Keys, key)
+			}
+		}
+
+		seen, active := false, false
+		for _, key := range append(m.Keys, m.References...) {
+			if nk, ok := n.Keys[key]; ok {
+				seen = true
+				active = active || !nk.Cancelled
+			}
+		}
+
+		notification := m.Notification
+		if m.Cancel {
+			// Only tell the subscriber of cancellations they care about
+			if active {
+				notification.Type = TypeCancel
+				log.Printf("Notifying %s of cancellation %s", notification.Subscriber, notification.AlertID)
+				gctx.Emit(notificationsTopic, notification.Subscriber, notification)
+			}
+
+			for _, key := range append(m.Keys, m.References...) {
+				if nk, ok := n.Keys[key]; ok {
+					nk.Cancelled = true
+				}
+			}
+		} else {
+			if !seen {
+				notification.Type = TypeAlert
+				log.Printf("Notifying %s of %s", notification.Subscriber, notification.AlertID)
+				gctx.Emit(notificationsTopic, notification.Subscriber, notification)
+			}
+
+			for _, key := range m.Keys {
+				n.Keys[key] = &notifiedKey{Expires: m.Expires}
+			}
+		}
+
+		if len(n.Keys) == 0 {
+			gctx.Delete()
+		} else {
+			gctx.SetValue(n)
+		}
+	}
+}
+
+// refreshIndex periodically rebuilds the index from the view.
+func refreshIndex(ctx context.Context, view *goka.View, index *atomic.Value) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(indexRefreshInterval):
+		}
+
+		idx, err := loadIndex(view)
+		if err != nil {
+			log.Println("Unable to load subscriptions:", err)
+			continue
+		}
+		index.Store(idx)
+	}
+}
+
+// Run runs the subscription processors: the processor keeping the
+// subscription table, and the processor matching stored alerts
+// against the subscriptions. Alerts are not matched until the
+// subscription table has been recovered.
+func Run(ctx context.Context, conf Config) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	subscriptionsGroup := goka.Group(conf.Group + "-subscriptions")
+	sp, err := goka.NewProcessor(conf.Brokers, Define(subscriptionsGroup, goka.Stream(conf.SubscriptionsTopic)))
+	if err != nil {
+		return err
+	}
+
+	view, err := NewView(conf.Brokers, subscriptionsGroup)
+	if err != nil {
+		return err
+	}
+
+	errs := make(chan error, 3)
+	go func() {
+		errs <- sp.Run(ctx)
+	}()
+	go func() {
+		errs <- view.Run(ctx)
+	}()
+
+	// Wait for the subscriptions
+	for !view.Recovered() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
+			return err
+		case <-time.After(time.Second):
+		}
+	}
+
+	idx, err := loadIndex(view)
+	if err != nil {
+		return err
+	}
+	log.Printf("Loaded %d subscription(s)", idx.Len())
+
+	var index atomic.Value
+	index.Store(idx)
+	go refreshIndex(ctx, view, &index)
+
+	g := goka.DefineGroup(goka.Group(conf.Group),
+		goka.Input(goka.Stream(conf.StoredTopic), new(codec.Alert), collectAlert(&index)),
+		goka.Loop(new(matchCodec), collectMatch(goka.Stream(conf.NotificationsTopic))),
+		goka.Output(goka.Stream(conf.NotificationsTopic), new(NotificationCodec)),
+		goka.Persist(new(notifiedCodec)),
+	)
+
+	p, err := goka.NewProcessor(conf.Brokers, g)
+	if err != nil {
+		return err
+	}
+	go func() {
+		errs <- p.Run(ctx)
+	}()
+
+	// Stop the remaining processors once one returns
+	err = <-errs
+	cancel()
+	return err
+}
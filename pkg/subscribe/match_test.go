@@ -0,0 +1,300 @@
+package subscribe
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+	"github.com/lovoo/goka"
+)
+
+const motionDescription = "2019-05-20T22:05:00-00:00...storm...235DEG...28KT...38.9,-95.7"
+
+// A testMessage is a message emitted or looped back.
+type testMessage struct {
+	topic goka.Stream
+	key   string
+	value interface{}
+}
+
+// testContext is a goka.Context for a single message, backed by a table.
+// The messages emitted and looped back are recorded.
+type testContext struct {
+	table    map[string]interface{}
+	key      string
+	emitted  *[]testMessage
+	loopback *[]testMessage
+}
+
+func (c *testContext) Topic() goka.Stream                              { return "" }
+func (c *testContext) Key() string                                     { return c.key }
+func (c *testContext) Partition() int32                                { return 0 }
+func (c *testContext) Offset() int64                                   { return 0 }
+func (c *testContext) Value() interface{}                              { return c.table[c.key] }
+func (c *testContext) SetValue(value interface{})                      { c.table[c.key] = value }
+func (c *testContext) Delete()                                         { delete(c.table, c.key) }
+func (c *testContext) Timestamp() time.Time                            { return time.Time{} }
+func (c *testContext) Join(topic goka.Table) interface{}               { return nil }
+func (c *testContext) Lookup(topic goka.Table, key string) interface{} { return nil }
+func (c *testContext) Fail(err error)                                  { panic(err) }
+func (c *testContext) Context() context.Context                        { return context.Background() }
+func (c *testContext) Loopback(key string, value interface{}) {
+	*c.loopback = append(*c.loopback, testMessage{"", key, value})
+}
+func (c *testContext) Emit(topic goka.Stream, key string, value interface{}) {
+	*c.emitted = append(*c.emitted, testMessage{topic, key, value})
+}
+
+// square returns a ring with its south-west corner at (lon, lat).
+func square(lon, lat, size float64) [][]float64 {
+	return [][]float64{
+		{lon, lat},
+		{lon + size, lat},
+		{lon + size, lat + size},
+		{lon, lat + size},
+		{lon, lat},
+	}
+}
+
+func ids(subscriptions []*Subscription) []string {
+	var ids []string
+	for _, subscription := range subscriptions {
+		ids = append(ids, subscription.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestMatch(t *testing.T) {
+	index := NewIndex([]*Subscription{
+		{ID: "inside", Lat: 39.5, Lon: -96.5},
+		{ID: "edge-cell", Lat: 39.1, Lon: -96.9},
+		{ID: "outside", Lat: 39.5, Lon: -95.5},
+		{ID: "far", Lat: 45, Lon: -80},
+		{ID: "zone", UGC: "KSC161"},
+		{ID: "other-zone", UGC: "KSC149"},
+	})
+	if index.Len() != 6 {
+		t.Errorf("Len() = %d, want 6", index.Len())
+	}
+
+	info := &capxml.Info{
+		Areas: []*capxml.Area{
+			{
+				Polygons: []*capxml.Polygon{{Coordinates: [][][]float64{square(-97, 39, 1)}}},
+				GeoCodes: capxml.KeyValue{"UGC": {"KSC161"}},
+			},
+			// Matched again by another area
+			{Polygons: []*capxml.Polygon{{Coordinates: [][][]float64{square(-96.75, 39.25, 0.5)}}}},
+		},
+	}
+	if got, want := ids(index.Match(info)), []string{"edge-cell", "inside", "zone"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Match() = %q, want %q", got, want)
+	}
+
+	if got := index.Match(&capxml.Info{}); len(got) != 0 {
+		t.Errorf("Match() without areas = %q", ids(got))
+	}
+}
+
+func TestWants(t *testing.T) {
+	tornado := &capxml.Info{Event: "Tornado Warning", Severity: capxml.SeverityExtreme}
+	flood := &capxml.Info{Event: "Flood Advisory", Severity: capxml.SeverityMinor}
+	unknown := &capxml.Info{Event: "Special Weather Statement", Severity: capxml.SeverityUnknown}
+
+	tests := []struct {
+		subscription Subscription
+		info         *capxml.Info
+		want         bool
+	}{
+		{Subscription{}, tornado, true},
+		{Subscription{}, unknown, true},
+		{Subscription{Events: []string{"tornado warning"}}, tornado, true},
+		{Subscription{Events: []string{"Tornado Warning", "Flood Warning"}}, flood, false},
+		{Subscription{Severity: "severe"}, tornado, true},
+		{Subscription{Severity: "Severe"}, flood, false},
+		{Subscription{Severity: "minor"}, flood, true},
+		{Subscription{Severity: "minor"}, unknown, false},
+		{Subscription{Severity: "unknown"}, unknown, true},
+		{Subscription{Severity: "dire"}, tornado, false},
+		{Subscription{Events: []string{"Flood Advisory"}, Severity: "moderate"}, flood, false},
+	}
+
+	for _, test := range tests {
+		if got := test.subscription.wants(test.info); got != test.want {
+			t.Errorf("%+v wants(%s, %s) = %v, want %v", test.subscription, test.info.Event, test.info.Severity, got, test.want)
+		}
+	}
+}
+
+func TestAddETA(t *testing.T) {
+	info := &capxml.Info{Parameters: capxml.KeyValue{"eventMotionDescription": {motionDescription}}}
+	storm := time.Date(2019, 5, 20, 22, 5, 0, 0, time.UTC)
+
+	// The storm reaches the point about an hour later
+	notification := &Notification{}
+	addETA(notification, info, &Subscription{Lat: 39.17, Lon: -95.21})
+	if notification.ETA == nil {
+		t.Fatal("ETA is not set")
+	}
+	if d := notification.ETA.Sub(storm.Add(time.Hour)); d < -time.Minute || d > time.Minute {
+		t.Errorf("ETA = %s, want about %s", notification.ETA, storm.Add(time.Hour))
+	}
+	if notification.Distance > 1000 {
+		t.Errorf("Distance = %v, want under 1 km", notification.Distance)
+	}
+
+	for name, test := range map[string]struct {
+		info         *capxml.Info
+		subscription *Subscription
+	}{
+		"zone":      {info, &Subscription{UGC: "KSC161"}},
+		"no motion": {&capxml.Info{}, &Subscription{Lat: 39.17, Lon: -95.21}},
+		"invalid":   {&capxml.Info{Parameters: capxml.KeyValue{"eventMotionDescription": {"storm"}}}, &Subscription{Lat: 39.17, Lon: -95.21}},
+	} {
+		notification := &Notification{}
+		addETA(notification, test.info, test.subscription)
+		if notification.ETA != nil || notification.Distance != 0 {
+			t.Errorf("%s: ETA = %s, %v, want none", name, notification.ETA, notification.Distance)
+		}
+	}
+}
+
+func TestCollectAlert(t *testing.T) {
+	var index atomic.Value
+	index.Store(NewIndex([]*Subscription{
+		{ID: "point", Subscriber: "alice", Lat: 39.17, Lon: -95.21},
+		{ID: "zone", Subscriber: "bob", UGC: "KSC161"},
+		{ID: "floods", Subscriber: "carol", UGC: "KSC161", Events: []string{"Flood Warning"}},
+		{ID: "extreme", Subscriber: "dave", UGC: "KSC161", Severity: "extreme"},
+	}))
+
+	expires := capxml.Time{Time: time.Date(2019, 5, 20, 22, 45, 0, 0, time.UTC)}
+	area := &capxml.Area{
+		Polygons: []*capxml.Polygon{{Coordinates: [][][]float64{square(-96, 39, 1)}}},
+		GeoCodes: capxml.KeyValue{"UGC": {"KSC161"}},
+	}
+	alert := capxml.Alert{
+		Identifier:  "a",
+		Sender:      "w-nws.webmaster@noaa.gov",
+		Sent:        capxml.Time{Time: time.Date(2019, 5, 20, 22, 5, 0, 0, time.UTC)},
+		MessageType: capxml.MessageTypeAlert,
+		Infos: []*capxml.Info{
+			{
+				Event:      "Severe Thunderstorm Warning",
+				Severity:   capxml.SeveritySevere,
+				Expires:    &expires,
+				Parameters: capxml.KeyValue{"eventMotionDescription": {motionDescription}},
+				Areas:      []*capxml.Area{area},
+			},
+			// Only matches the subscriptions the first info didn't
+			{Event: "Flood Warning", Severity: capxml.SeveritySevere, Areas: []*capxml.Area{area}},
+		},
+	}
+
+	var emitted, loopback []testMessage
+	collectAlert(&index)(&testContext{table: make(map[string]interface{}), emitted: &emitted, loopback: &loopback}, alert)
+
+	if len(emitted) != 0 {
+		t.Errorf("Emitted %+v", emitted)
+	}
+
+	matches := make(map[string]*match)
+	for _, msg := range loopback {
+		if _, ok := matches[msg.key]; ok {
+			t.Errorf("Subscription %s is matched more than once", msg.key)
+		}
+		matches[msg.key] = msg.value.(*match)
+	}
+	if len(matches) != 3 || matches["extreme"] != nil {
+		t.Fatalf("Matched %d subscription(s), want point, zone and floods: %+v", len(matches), matches)
+	}
+
+	point := matches["point"]
+	if n := point.Notification; n.Subscriber != "alice" || n.Event != "Severe Thunderstorm Warning" || n.Severity != "Severe" || n.AlertID != alert.ID() {
+		t.Errorf("Notification = %+v", n)
+	}
+	if point.Notification.ETA == nil {
+		t.Error("Point subscription notification has no ETA")
+	}
+	if !reflect.DeepEqual(point.Keys, []string{alert.ID()}) || point.Cancel || !point.Expires.Equal(expires.Time) {
+		t.Errorf("Match = %+v", point)
+	}
+
+	if n := matches["zone"].Notification; n.Event != "Severe Thunderstorm Warning" || n.ETA != nil {
+		t.Errorf("Zone notification = %+v", n)
+	}
+	if n := matches["floods"].Notification; n.Subscriber != "carol" || n.Event != "Flood Warning" {
+		t.Errorf("Flood notification = %+v", n)
+	}
+}
+
+func TestCollectMatch(t *testing.T) {
+	table := make(map[string]interface{})
+	var emitted, loopback []testMessage
+	send := func(m *match) {
+		collectMatch("notifications")(&testContext{table: table, key: "s", emitted: &emitted, loopback: &loopback}, m)
+	}
+	notification := func(id string) *Notification {
+		return &Notification{SubscriptionID: "s", Subscriber: "alice", AlertID: id}
+	}
+	expires := time.Now().Add(time.Hour)
+
+	// The warning is notified, its update isn't
+	send(&match{Notification: notification("new"), Keys: []string{"event"}, Expires: expires})
+	send(&match{Notification: notification("update"), Keys: []string{"event"}, References: []string{"new"}, Expires: expires})
+	if len(emitted) != 1 || emitted[0].topic != "notifications" || emitted[0].key != "alice" {
+		t.Fatalf("Emitted %+v, want the first alert", emitted)
+	}
+	if n := emitted[0].value.(*Notification); n.AlertID != "new" || n.Type != TypeAlert {
+		t.Errorf("Notification = %+v", n)
+	}
+
+	// The cancellation is notified once
+	send(&match{Notification: notification("cancel"), Keys: []string{"event"}, Cancel: true, Expires: expires})
+	send(&match{Notification: notification("cancel-again"), Keys: []string{"event"}, Cancel: true, Expires: expires})
+	if len(emitted) != 2 {
+		t.Fatalf("Emitted %d notifications, want 2", len(emitted))
+	}
+	if n := emitted[1].value.(*Notification); n.AlertID != "cancel" || n.Type != TypeCancel {
+		t.Errorf("Notification = %+v", n)
+	}
+
+	// Cancellations of events the subscriber wasn't notified of are not sent
+	send(&match{Notification: notification("other"), Keys: []string{"other"}, Cancel: true, Expires: expires})
+	if len(emitted) != 2 {
+		t.Errorf("Emitted %+v for an unknown event", emitted[2:])
+	}
+
+	// Long expired keys are forgotten
+	table["s"] = &notified{Keys: map[string]*notifiedKey{"old": {Expires: time.Now().Add(-notifiedRetention - time.Hour)}}}
+	send(&match{Notification: notification("old-cancel"), Keys: []string{"old"}, Cancel: true, Expires: expires})
+	if _, ok := table["s"]; ok || len(emitted) != 2 {
+		t.Errorf("Table = %+v, emitted %d, want the keys forgotten", table["s"], len(emitted))
+	}
+}
+
+func TestCollectSubscription(t *testing.T) {
+	table := make(map[string]interface{})
+	ctx := &testContext{table: table, key: "s"}
+
+	collectSubscription(ctx, &Message{Subscribe: &Subscription{Subscriber: "alice", UGC: "ksc161", Severity: "Severe"}})
+	if s, _ := table["s"].(*Subscription); s == nil || s.ID != "s" || s.UGC != "KSC161" {
+		t.Fatalf("Subscription = %+v", table["s"])
+	}
+
+	// An invalid severity is ignored
+	collectSubscription(ctx, &Message{Subscribe: &Subscription{Subscriber: "alice", Severity: "dire"}})
+	if s := table["s"].(*Subscription); s.Severity != "Severe" {
+		t.Errorf("Subscription = %+v, want it unchanged", s)
+	}
+
+	collectSubscription(ctx, &Message{Unsubscribe: true})
+	if _, ok := table["s"]; ok {
+		t.Error("Subscription was not removed")
+	}
+}
@@ -0,0 +1,198 @@
+package subscribe
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+	"github.com/lovoo/goka"
+)
+
+const (
+	// TypeAlert is the type of notification sent when an alert covers a subscription.
+	TypeAlert = "alert"
+
+	// TypeCancel is the type of notification sent when an alert a
+	// subscriber was notified of is cancelled.
+	TypeCancel = "cancel"
+)
+
+// A Subscription is a location a subscriber wants to be notified of
+// alerts for. The location is either a point, or a UGC code.
+type Subscription struct {
+	ID         string `json:"id"`
+	Subscriber string `json:"subscriber"`
+
+	Lat float64 `json:"lat,omitempty"`
+	Lon float64 `json:"lon,omitempty"`
+
+	// If set, the subscription is for the zone, rather than the point.
+	UGC string `json:"ugc,omitempty"`
+
+	// If set, only alerts for these events (ex. Tornado Warning) are notified.
+	Events []string `json:"events,omitempty"`
+
+	// If set, only alerts at least this severe (ex. Severe) are notified.
+	Severity string `json:"severity,omitempty"`
+}
+
+// wants returns whether the subscription's event and severity filters
+// accept the info.
+func (subscription *Subscription) wants(info *capxml.Info) bool {
+	if len(subscription.Events) > 0 {
+		found := false
+		for _, event := range subscription.Events {
+			if strings.EqualFold(strings.TrimSpace(event), strings.TrimSpace(info.Event)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if subscription.Severity != "" {
+		var min capxml.Severity
+		if err := min.UnmarshalText([]byte(subscription.Severity)); err != nil {
+			return false
+		}
+
+		// Severities are ordered from extreme to minor
+		if min != capxml.SeverityUnknown && (info.Severity == capxml.SeverityUnknown || info.Severity > min) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// A Message is a message on the subscriptions topic, keyed by subscription ID.
+type Message struct {
+	Subscribe   *Subscription `json:"subscribe,omitempty"`
+	Unsubscribe bool          `json:"unsubscribe,omitempty"`
+}
+
+// A Notification is emitted, keyed by subscriber, when an alert
+// covers one of the subscriber's subscriptions.
+type Notification struct {
+	Type           string    `json:"type"`
+	SubscriptionID string    `json:"subscription_id"`
+	Subscriber     string    `json:"subscriber"`
+	AlertID        string    `json:"alert_id"`
+	Event          string    `json:"event"`
+	Headline       string    `json:"headline,omitempty"`
+	Severity       string    `json:"severity"`
+	Sent           time.Time `json:"sent"`
+
+	// Keys of the VTEC events of the alert.
+	EventKeys []string `json:"event_keys,omitempty"`
+
+	// For point subscriptions, when the alert has an event motion: the
+	// time the storm is projected to be closest to the point, and its
+	// distance from the point then, in metres.
+	ETA      *time.Time `json:"eta,omitempty"`
+	Distance float64    `json:"distance,omitempty"`
+}
+
+// MessageCodec encodes and decodes messages.
+type MessageCodec struct{}
+
+// Encode implements the goka.Codec interface.
+func (c *MessageCodec) Encode(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case *Message:
+		return json.Marshal(v)
+	default:
+		return nil, errors.New("Unknown type provided")
+	}
+}
+
+// Decode implements the goka.Codec interface.
+func (c *MessageCodec) Decode(data []byte) (interface{}, error) {
+	var msg Message
+	err := json.Unmarshal(data, &msg)
+	return &msg, err
+}
+
+// SubscriptionCodec encodes and decodes subscriptions.
+type SubscriptionCodec struct{}
+
+// Encode implements the goka.Codec interface.
+func (c *SubscriptionCodec) Encode(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case *Subscription:
+		return json.Marshal(v)
+	default:
+		return nil, errors.New("Unknown type provided")
+	}
+}
+
+// Decode implements the goka.Codec interface.
+func (c *SubscriptionCodec) Decode(data []byte) (interface{}, error) {
+	var subscription Subscription
+	err := json.Unmarshal(data, &subscription)
+	return &subscription, err
+}
+
+// NotificationCodec encodes and decodes notifications.
+type NotificationCodec struct{}
+
+// Encode implements the goka.Codec interface.
+func (c *NotificationCodec) Encode(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case *Notification:
+		return json.Marshal(v)
+	default:
+		return nil, errors.New("Unknown type provided")
+	}
+}
+
+// Decode implements the goka.Codec interface.
+func (c *NotificationCodec) Decode(data []byte) (interface{}, error) {
+	var notification Notification
+	err := json.Unmarshal(data, &notification)
+	return &notification, err
+}
+
+func collectSubscription(gctx goka.Context, msg interface{}) {
+	m := msg.(*Message)
+
+	if m.Unsubscribe {
+		log.Printf("Removing subscription %s", gctx.Key())
+		gctx.Delete()
+		return
+	}
+
+	if m.Subscribe != nil {
+		if m.Subscribe.Severity != "" {
+			var severity capxml.Severity
+			if err := severity.UnmarshalText([]byte(m.Subscribe.Severity)); err != nil {
+				log.Printf("Ignoring subscription %s: %v", gctx.Key(), err)
+				return
+			}
+		}
+
+		m.Subscribe.ID = gctx.Key()
+		m.Subscribe.UGC = strings.ToUpper(m.Subscribe.UGC)
+		log.Printf("Adding subscription %s for %s", m.Subscribe.ID, m.Subscribe.Subscriber)
+		gctx.SetValue(m.Subscribe)
+	}
+}
+
+// Define defines the processor group that keeps the subscription table,
+// from the messages in the topic.
+func Define(group goka.Group, topic goka.Stream) *goka.GroupGraph {
+	return goka.DefineGroup(group,
+		goka.Input(topic, new(MessageCodec), collectSubscription),
+		goka.Persist(new(SubscriptionCodec)),
+	)
+}
+
+// NewView creates a view of the subscription table kept by the group.
+func NewView(brokers []string, group goka.Group, options ...goka.ViewOption) (*goka.View, error) {
+	return goka.NewView(brokers, goka.GroupTable(group), new(SubscriptionCodec), options...)
+}
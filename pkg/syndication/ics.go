@@ -0,0 +1,196 @@
+package syndication
+
+import (
+	"bytes"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alerting/alerts-nws/pkg/active"
+	"github.com/alerting/alerts-nws/pkg/events"
+	"github.com/alerting/alerts-nws/pkg/vtec"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+// ContentTypeICS is the content type of iCalendar documents.
+const ContentTypeICS = "text/calendar; charset=utf-8"
+
+const (
+	// Format of the times in iCalendar documents, in UTC.
+	icsTimeFormat = "20060102T150405Z"
+
+	// Longest line in iCalendar documents, in octets, before folding.
+	icsLineLength = 75
+
+	// Suffix of the UIDs of the events.
+	uidDomain = "alerts-nws"
+)
+
+// A vevent is an event of the calendar.
+type vevent struct {
+	uid      string
+	alert    *capxml.Alert
+	info     *capxml.Info
+	areas    []string
+	begin    time.Time
+	end      time.Time
+	modified time.Time
+}
+
+// uids returns the UIDs of the info: the keys of its VTEC events, or
+// the alert's ID if it has no VTEC. The keys of the events the info ends
+// are returned separately.
+func uids(alert *capxml.Alert, info *capxml.Info) ([]string, []string) {
+	pvtecs, keys := events.Keys(alert, info)
+	if len(pvtecs) == 0 {
+		return []string{alert.ID() + "@" + uidDomain}, nil
+	}
+
+	var ongoing, ended []string
+	for i, pvtec := range pvtecs {
+		switch pvtec.Action {
+		case vtec.ActionCancel, vtec.ActionExpire, vtec.ActionUpgrade:
+			ended = append(ended, keys[i]+"@"+uidDomain)
+		default:
+			ongoing = append(ongoing, keys[i]+"@"+uidDomain)
+		}
+	}
+	return ongoing, ended
+}
+
+// escapeText escapes the text of a property value.
+func escapeText(str string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(str)
+}
+
+// writeLine writes the content line, folded at the line length. The
+// continuation lines start with a space, which counts towards their length.
+func writeLine(buf *bytes.Buffer, name, value string) {
+	line := name + ":" + value
+	for n := icsLineLength; len(line) > n; n = icsLineLength - 1 {
+		// Don't split a character
+		for n > 0 && !utf8.RuneStart(line[n]) {
+			n--
+		}
+		buf.WriteString(line[:n])
+		buf.WriteString("\r\n ")
+		line = line[n:]
+	}
+	buf.WriteString(line)
+	buf.WriteString("\r\n")
+}
+
+// events returns the events of the feed's alerts, by UID. As the alerts
+// are sent for parts of an event, the alerts of the same event are merged:
+// the most recently sent alert describes the event, over all their areas.
+// Events ended by an alert sent after their last update are left out.
+func (feed *Feed) events() []*vevent {
+	var list []*vevent
+	byUID := make(map[string]*vevent)
+	ended := make(map[string]time.Time)
+
+	for _, alert := range feed.Alerts {
+		for _, info := range alert.Infos {
+			begin, end := active.Span(alert, info)
+			areas := strings.Split(areaDesc(info), "; ")
+
+			ongoing, ends := uids(alert, info)
+			for _, uid := range ends {
+				if alert.Sent.After(ended[uid]) {
+					ended[uid] = alert.Sent.Time
+				}
+			}
+
+			for _, uid := range ongoing {
+				event, ok := byUID[uid]
+				if !ok {
+					event = &vevent{uid: uid, alert: alert, info: info, begin: begin, end: end, modified: alert.Sent.Time}
+					byUID[uid] = event
+					list = append(list, event)
+				} else if alert.Sent.After(event.modified) {
+					event.alert, event.info, event.modified = alert, info, alert.Sent.Time
+				}
+
+				if begin.Before(event.begin) {
+					event.begin = begin
+				}
+				if end.After(event.end) {
+					event.end = end
+				}
+				for _, area := range areas {
+					if area != "" && !contains(event.areas, area) {
+						event.areas = append(event.areas, area)
+					}
+				}
+			}
+		}
+	}
+
+	var ongoing []*vevent
+	for _, event := range list {
+		if !ended[event.uid].After(event.modified) {
+			ongoing = append(ongoing, event)
+		}
+	}
+	return ongoing
+}
+
+func contains(list []string, str string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
+// ICS renders the feed as an iCalendar document, with an event from the
+// onset (or effective) time to the end (or expiry) time of each alert.
+// Events keep the UID of their VTEC event, so updates replace them in
+// calendars, and events no longer active are left out.
+func (feed *Feed) ICS() ([]byte, error) {
+	var buf bytes.Buffer
+	writeLine(&buf, "BEGIN", "VCALENDAR")
+	writeLine(&buf, "VERSION", "2.0")
+	writeLine(&buf, "PRODID", "-//alerting//alerts-nws//EN")
+	writeLine(&buf, "CALSCALE", "GREGORIAN")
+	writeLine(&buf, "METHOD", "PUBLISH")
+	writeLine(&buf, "X-WR-CALNAME", escapeText(feed.Title))
+
+	for _, event := range feed.events() {
+		area := strings.Join(event.areas, "; ")
+
+		description := event.info.Headline
+		for _, str := range []string{event.info.Description, event.info.Instruction} {
+			if str != "" {
+				description += "\n\n" + str
+			}
+		}
+
+		writeLine(&buf, "BEGIN", "VEVENT")
+		writeLine(&buf, "UID", event.uid)
+		writeLine(&buf, "DTSTAMP", event.modified.UTC().Format(icsTimeFormat))
+		writeLine(&buf, "LAST-MODIFIED", event.modified.UTC().Format(icsTimeFormat))
+		writeLine(&buf, "DTSTART", event.begin.UTC().Format(icsTimeFormat))
+		if event.end.After(event.begin) {
+			writeLine(&buf, "DTEND", event.end.UTC().Format(icsTimeFormat))
+		}
+		writeLine(&buf, "SUMMARY", escapeText(event.info.Event+" for "+area))
+		writeLine(&buf, "LOCATION", escapeText(area))
+		writeLine(&buf, "DESCRIPTION", escapeText(strings.TrimSpace(description)))
+		writeLine(&buf, "CATEGORIES", escapeText(event.info.Event))
+		writeLine(&buf, "URL", feed.CAPURL(event.alert))
+		writeLine(&buf, "STATUS", "CONFIRMED")
+		writeLine(&buf, "TRANSP", "TRANSPARENT")
+		writeLine(&buf, "END", "VEVENT")
+	}
+
+	writeLine(&buf, "END", "VCALENDAR")
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,155 @@
+package syndication
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+// vtecAlert returns an alert for Riley, KS, with the VTEC string.
+func vtecAlert(id, sent, vtec string, params ...string) *capxml.Alert {
+	info := &capxml.Info{
+		Event:      "Winter Storm Warning",
+		Parameters: capxml.KeyValue{"VTEC": {vtec}},
+		Areas:      []*capxml.Area{{Description: "Riley, KS"}},
+	}
+	for i := 0; i+1 < len(params); i += 2 {
+		info.Parameters[params[i]] = append(info.Parameters[params[i]], params[i+1])
+	}
+
+	return &capxml.Alert{
+		Identifier: id,
+		Sender:     "w-nws.webmaster@noaa.gov",
+		Sent:       *testTime(sent),
+		Infos:      []*capxml.Info{info},
+	}
+}
+
+func icsFeed(alerts ...*capxml.Alert) *Feed {
+	return &Feed{
+		Title: "Active alerts",
+		CAPURL: func(alert *capxml.Alert) string {
+			return "http://example.com/cap/" + alert.Identifier + ".xml"
+		},
+		Alerts: alerts,
+	}
+}
+
+func uidsOf(feed *Feed) []string {
+	var list []string
+	for _, event := range feed.events() {
+		list = append(list, event.uid)
+	}
+	return list
+}
+
+func TestUIDStable(t *testing.T) {
+	issued := vtecAlert("new", "2019-12-31T22:00:00Z", "/O.NEW.KTOP.WS.W.0012.191231T2300Z-200101T1200Z/")
+
+	// An update sent in the next year, with the key stored when it was processed
+	continued := vtecAlert("con", "2020-01-01T03:00:00Z", "/O.CON.KTOP.WS.W.0012.000000T0000Z-200101T1200Z/",
+		"VTEC-key", "KTOP.WS.W.0012.2019")
+	continued.Infos[0].Areas[0].Description = "Geary, KS"
+
+	want := "KTOP.WS.W.0012.2019@" + uidDomain
+	for _, feed := range []*Feed{icsFeed(issued), icsFeed(continued), icsFeed(issued, continued), icsFeed(continued, issued)} {
+		events := feed.events()
+		if len(events) != 1 || events[0].uid != want {
+			t.Fatalf("Events = %q, want %s", uidsOf(feed), want)
+		}
+	}
+
+	// The latest alert describes the event, over the areas of both
+	event := icsFeed(issued, continued).events()[0]
+	if event.alert != continued || strings.Join(event.areas, "; ") != "Riley, KS; Geary, KS" {
+		t.Errorf("Event is described by %s, over %q", event.alert.Identifier, event.areas)
+	}
+
+	// Without VTEC, the alert's ID is used
+	plain := vtecAlert("plain", "2019-12-31T22:00:00Z", "")
+	plain.Infos[0].Parameters = nil
+	if got := uidsOf(icsFeed(plain)); len(got) != 1 || got[0] != plain.ID()+"@"+uidDomain {
+		t.Errorf("UIDs = %q, want the alert's ID", got)
+	}
+}
+
+func TestCancelledEvents(t *testing.T) {
+	issued := vtecAlert("new", "2019-05-28T12:00:00Z", "/O.NEW.KTOP.WS.W.0012.190528T1200Z-190529T1200Z/")
+	cancelled := vtecAlert("can", "2019-05-28T15:00:00Z", "/O.CAN.KTOP.WS.W.0012.000000T0000Z-190529T1200Z/")
+	expired := vtecAlert("exp", "2019-05-29T12:00:00Z", "/O.EXP.KTOP.WS.W.0012.000000T0000Z-190529T1200Z/")
+	extended := vtecAlert("ext", "2019-05-28T18:00:00Z", "/O.EXT.KTOP.WS.W.0012.000000T0000Z-190530T1200Z/")
+
+	// A part of the event is cancelled by the same alert
+	partial := vtecAlert("partial", "2019-05-28T15:00:00Z", "/O.CAN.KTOP.WS.W.0012.000000T0000Z-190529T1200Z/")
+	partial.Infos = append(partial.Infos, vtecAlert("", "", "/O.CON.KTOP.WS.W.0012.000000T0000Z-190529T1200Z/").Infos...)
+
+	tests := []struct {
+		name   string
+		alerts []*capxml.Alert
+		want   int
+	}{
+		{"issued", []*capxml.Alert{issued}, 1},
+		{"cancelled", []*capxml.Alert{issued, cancelled}, 0},
+		{"cancelled first", []*capxml.Alert{cancelled, issued}, 0},
+		{"expired", []*capxml.Alert{issued, expired}, 0},
+		{"only the cancellation", []*capxml.Alert{cancelled}, 0},
+		{"updated after the cancellation", []*capxml.Alert{issued, cancelled, extended}, 1},
+		{"partly cancelled", []*capxml.Alert{issued, partial}, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			feed := icsFeed(test.alerts...)
+			if got := uidsOf(feed); len(got) != test.want {
+				t.Errorf("Events = %q, want %d", got, test.want)
+			}
+
+			b, err := feed.ICS()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Count(string(b), "BEGIN:VEVENT"); got != test.want {
+				t.Errorf("ICS() has %d events, want %d:\n%s", got, test.want, b)
+			}
+		})
+	}
+}
+
+func TestWriteLine(t *testing.T) {
+	for _, value := range []string{
+		"short",
+		strings.Repeat("a", 200),
+		strings.Repeat("é", 100),
+		strings.Repeat("x", 70) + "☂☂☂☂☂☂☂☂☂☂",
+	} {
+		var buf bytes.Buffer
+		writeLine(&buf, "DESCRIPTION", value)
+
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n")
+		for i, line := range lines {
+			if len(line) > icsLineLength {
+				t.Errorf("Line %d is %d octets: %q", i, len(line), line)
+			}
+			if i > 0 && !strings.HasPrefix(line, " ") {
+				t.Errorf("Continuation line %d doesn't start with a space: %q", i, line)
+			}
+			if !utf8.ValidString(line) {
+				t.Errorf("Line %d splits a character: %q", i, line)
+			}
+		}
+
+		// Full lines are used
+		for i, line := range lines[:len(lines)-1] {
+			if len(line) < icsLineLength-utf8.UTFMax {
+				t.Errorf("Line %d is only %d octets", i, len(line))
+			}
+		}
+
+		if got := strings.Replace(buf.String(), "\r\n ", "", -1); got != "DESCRIPTION:"+value+"\r\n" {
+			t.Errorf("Unfolded to %q, want %q", got, value)
+		}
+	}
+}
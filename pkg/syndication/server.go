@@ -0,0 +1,177 @@
+package syndication
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/alerting/alerts-nws/pkg/active"
+	"github.com/alerting/alerts-nws/pkg/archive"
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+	"github.com/lovoo/goka"
+)
+
+// Config is the configuration for the feed server.
+type Config struct {
+	// The active alerts table (see active.Config).
+	Active active.Config
+
+	// Address to listen on (ex. :8080).
+	Addr string
+
+	// Public URL of the server, used for the links in the feeds. If
+	// not set, the host of the request is used.
+	BaseURL string
+}
+
+// A Handler serves the feeds of the active alerts in a view, as Atom,
+// RSS or iCalendar:
+//
+//	/alerts.{atom,rss,ics}          all the alerts
+//	/state/{state}.{atom,rss,ics}   by state (ex. KS)
+//	/zone/{ugc}.{atom,rss,ics}      by zone (ex. KSZ040)
+//	/wfo/{office}.{atom,rss,ics}    by office (ex. TOP)
+//	/cap/{id}.xml                   the CAP document of an alert
+type Handler struct {
+	View    *goka.View
+	BaseURL string
+}
+
+// baseURL returns the public URL of the server.
+func (handler *Handler) baseURL(r *http.Request) string {
+	if handler.BaseURL != "" {
+		return strings.TrimRight(handler.BaseURL, "/")
+	}
+	if r.TLS != nil {
+		return "https://" + r.Host
+	}
+	return "http://" + r.Host
+}
+
+// route returns the filter, the title and the format of the feed at the path.
+func route(p string) (*active.Filter, string, string, bool) {
+	ext := path.Ext(p)
+	name := strings.ToUpper(strings.TrimSuffix(path.Base(p), ext))
+	dir := path.Dir(p)
+
+	switch {
+	case dir == "/" && name == "ALERTS":
+		return new(active.Filter), "Active alerts", ext, true
+	case dir == "/state" && len(name) == 2:
+		return &active.Filter{State: name}, fmt.Sprintf("Active alerts for %s", name), ext, true
+	case dir == "/zone" && len(name) == 6:
+		return &active.Filter{Zone: name}, fmt.Sprintf("Active alerts for %s", name), ext, true
+	case dir == "/wfo" && name != "":
+		return &active.Filter{Office: name}, fmt.Sprintf("Active alerts issued by %s", name), ext, true
+	}
+	return nil, "", "", false
+}
+
+func (handler *Handler) serveCAP(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSuffix(path.Base(r.URL.Path), ".xml")
+
+	value, err := handler.View.Get(id)
+	if err != nil {
+		log.Printf("Unable to get %s: %v", id, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	alert, ok := value.(capxml.Alert)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	b, err := archive.Marshal(&alert)
+	if err != nil {
+		log.Printf("Unable to serialise %s: %v", id, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentTypeCAP)
+	w.Write(b)
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (handler *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if path.Dir(r.URL.Path) == "/cap" && path.Ext(r.URL.Path) == ".xml" {
+		handler.serveCAP(w, r)
+		return
+	}
+
+	filter, title, format, ok := route(r.URL.Path)
+	if !ok || (format != ".atom" && format != ".rss" && format != ".ics") {
+		http.NotFound(w, r)
+		return
+	}
+
+	alerts, err := active.Alerts(handler.View, filter)
+	if err != nil {
+		log.Println("Unable to list alerts:", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	base := handler.baseURL(r)
+	feed := &Feed{
+		Title: title,
+		URL:   base + r.URL.Path,
+		CAPURL: func(alert *capxml.Alert) string {
+			return base + "/cap/" + alert.ID() + ".xml"
+		},
+		Alerts: alerts,
+	}
+
+	var b []byte
+	switch format {
+	case ".atom":
+		w.Header().Set("Content-Type", ContentTypeAtom)
+		b, err = feed.Atom()
+	case ".rss":
+		w.Header().Set("Content-Type", ContentTypeRSS)
+		b, err = feed.RSS()
+	case ".ics":
+		w.Header().Set("Content-Type", ContentTypeICS)
+		b, err = feed.ICS()
+	}
+	if err != nil {
+		log.Println("Unable to render feed:", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Write(b)
+}
+
+// Run runs the processor keeping the active alerts, and serves
+// their feeds once the alerts have been recovered.
+func Run(ctx context.Context, conf Config) error {
+	return active.Run(ctx, conf.Active, func(ctx context.Context, view *goka.View) error {
+		server := &http.Server{
+			Addr:         conf.Addr,
+			Handler:      &Handler{View: view, BaseURL: conf.BaseURL},
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 30 * time.Second,
+		}
+
+		go func() {
+			<-ctx.Done()
+			server.Shutdown(context.Background())
+		}()
+
+		log.Printf("Serving feeds on %s", conf.Addr)
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			return err
+		}
+		return ctx.Err()
+	})
+}
@@ -0,0 +1,93 @@
+package syndication
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alerting/alerts-nws/pkg/active"
+)
+
+func TestRoute(t *testing.T) {
+	tests := []struct {
+		path   string
+		filter *active.Filter
+		title  string
+		format string
+	}{
+		{"/alerts.atom", &active.Filter{}, "Active alerts", ".atom"},
+		{"/alerts.rss", &active.Filter{}, "Active alerts", ".rss"},
+		{"/state/ks.atom", &active.Filter{State: "KS"}, "Active alerts for KS", ".atom"},
+		{"/state/KS.ics", &active.Filter{State: "KS"}, "Active alerts for KS", ".ics"},
+		{"/zone/ksz040.rss", &active.Filter{Zone: "KSZ040"}, "Active alerts for KSZ040", ".rss"},
+		{"/zone/AMZ630.atom", &active.Filter{Zone: "AMZ630"}, "Active alerts for AMZ630", ".atom"},
+		{"/wfo/top.atom", &active.Filter{Office: "TOP"}, "Active alerts issued by TOP", ".atom"},
+		{"/wfo/KTOP.rss", &active.Filter{Office: "KTOP"}, "Active alerts issued by KTOP", ".rss"},
+
+		{"/", nil, "", ""},
+		{"/other.atom", nil, "", ""},
+		{"/state/KAN.atom", nil, "", ""},
+		{"/zone/KSZ40.atom", nil, "", ""},
+		{"/state/KS/extra.atom", nil, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			filter, title, format, ok := route(test.path)
+			if ok != (test.filter != nil) {
+				t.Fatalf("route(%q) ok = %v", test.path, ok)
+			}
+			if !ok {
+				return
+			}
+			if *filter != *test.filter || title != test.title || format != test.format {
+				t.Errorf("route(%q) = %+v, %q, %q, want %+v, %q, %q",
+					test.path, filter, title, format, test.filter, test.title, test.format)
+			}
+		})
+	}
+}
+
+func TestServeHTTPRejected(t *testing.T) {
+	handler := new(Handler)
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodPost, "/alerts.atom", http.StatusMethodNotAllowed},
+		{http.MethodDelete, "/cap/x.xml", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/alerts.json", http.StatusNotFound},
+		{http.MethodGet, "/alerts", http.StatusNotFound},
+		{http.MethodGet, "/county/KSC161.atom", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+		if w.Code != test.status {
+			t.Errorf("%s %s = %d, want %d", test.method, test.path, w.Code, test.status)
+		}
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/alerts.atom", nil)
+	r.Host = "alerts.example.com"
+
+	if got := new(Handler).baseURL(r); got != "http://alerts.example.com" {
+		t.Errorf("baseURL() = %q", got)
+	}
+
+	r.TLS = new(tls.ConnectionState)
+	if got := new(Handler).baseURL(r); got != "https://alerts.example.com" {
+		t.Errorf("baseURL() over TLS = %q", got)
+	}
+
+	handler := &Handler{BaseURL: "https://example.com/feeds/"}
+	if got := handler.baseURL(r); got != "https://example.com/feeds" {
+		t.Errorf("baseURL() with a base URL = %q", got)
+	}
+}
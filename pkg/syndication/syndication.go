@@ -0,0 +1,240 @@
+package syndication
+
+import (
+	"encoding/xml"
+	"strings"
+	"time"
+
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+// Namespaces of the documents.
+const (
+	atomNamespace = "http://www.w3.org/2005/Atom"
+	capNamespace  = "urn:oasis:names:tc:emergency:cap:1.2"
+)
+
+// Content types of the documents.
+const (
+	ContentTypeAtom = "application/atom+xml; charset=utf-8"
+	ContentTypeRSS  = "application/rss+xml; charset=utf-8"
+	ContentTypeCAP  = "application/cap+xml; charset=utf-8"
+)
+
+// A Feed describes the feed of a set of alerts.
+type Feed struct {
+	Title string
+
+	// URL of the feed itself.
+	URL string
+
+	// Returns the URL of an alert's CAP document.
+	CAPURL func(alert *capxml.Alert) string
+
+	Alerts []*capxml.Alert
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published"`
+	Author    atomAuthor `xml:"author"`
+	Title     string     `xml:"title"`
+	Link      atomLink   `xml:"link"`
+	Summary   string     `xml:"summary,omitempty"`
+
+	// CAP elements, as in the NWS CAP ATOM feeds
+	Event     string `xml:"cap:event"`
+	Effective string `xml:"cap:effective,omitempty"`
+	Expires   string `xml:"cap:expires,omitempty"`
+	Status    string `xml:"cap:status"`
+	MsgType   string `xml:"cap:msgType"`
+	Urgency   string `xml:"cap:urgency"`
+	Severity  string `xml:"cap:severity"`
+	Certainty string `xml:"cap:certainty"`
+	AreaDesc  string `xml:"cap:areaDesc,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"feed"`
+	XMLNS    string      `xml:"xmlns,attr"`
+	XMLNSCAP string      `xml:"xmlns:cap,attr"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Updated  string      `xml:"updated"`
+	Link     atomLink    `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Category    string  `xml:"category"`
+	Description string  `xml:"description,omitempty"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// info returns the info of the alert to describe it by: the first in
+// English, or else the first.
+func info(alert *capxml.Alert) *capxml.Info {
+	for _, info := range alert.Infos {
+		if strings.HasPrefix(strings.ToLower(info.Language), "en") {
+			return info
+		}
+	}
+	if len(alert.Infos) > 0 {
+		return alert.Infos[0]
+	}
+	return new(capxml.Info)
+}
+
+// title returns the title of the alert: its headline, or its event.
+func title(info *capxml.Info) string {
+	if info.Headline != "" {
+		return info.Headline
+	}
+	return info.Event
+}
+
+// areaDesc returns the descriptions of the info's areas.
+func areaDesc(info *capxml.Info) string {
+	descs := make([]string, 0, len(info.Areas))
+	for _, area := range info.Areas {
+		descs = append(descs, area.Description)
+	}
+	return strings.Join(descs, "; ")
+}
+
+func formatTime(t *capxml.Time, format string) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.Format(format)
+}
+
+// updated returns the time the feed was last updated: when
+// the most recent alert was sent, or now if there are none.
+func (feed *Feed) updated() time.Time {
+	updated := time.Time{}
+	for _, alert := range feed.Alerts {
+		if alert.Sent.After(updated) {
+			updated = alert.Sent.Time
+		}
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	return updated.UTC()
+}
+
+// Atom renders the feed as an Atom 1.0 document. As in the NWS CAP ATOM
+// feeds, entries are identified by the URL of their CAP document, and
+// were last updated when the alert was sent.
+func (feed *Feed) Atom() ([]byte, error) {
+	doc := &atomFeed{
+		XMLNS:    atomNamespace,
+		XMLNSCAP: capNamespace,
+		ID:       feed.URL,
+		Title:    feed.Title,
+		Updated:  feed.updated().Format(time.RFC3339),
+		Link:     atomLink{Rel: "self", Href: feed.URL},
+	}
+
+	for _, alert := range feed.Alerts {
+		info := info(alert)
+		capURL := feed.CAPURL(alert)
+
+		author := info.SenderName
+		if author == "" {
+			author = alert.Sender
+		}
+
+		doc.Entries = append(doc.Entries, atomEntry{
+			ID:        capURL,
+			Updated:   alert.Sent.Format(time.RFC3339),
+			Published: alert.Sent.Format(time.RFC3339),
+			Author:    atomAuthor{Name: author},
+			Title:     title(info),
+			Link:      atomLink{Rel: "alternate", Type: "application/cap+xml", Href: capURL},
+			Summary:   info.Description,
+			Event:     info.Event,
+			Effective: formatTime(info.Effective, time.RFC3339),
+			Expires:   formatTime(info.Expires, time.RFC3339),
+			Status:    alert.Status.String(),
+			MsgType:   alert.MessageType.String(),
+			Urgency:   info.Urgency.String(),
+			Severity:  info.Severity.String(),
+			Certainty: info.Certainty.String(),
+			AreaDesc:  areaDesc(info),
+		})
+	}
+
+	return marshal(doc)
+}
+
+// RSS renders the feed as an RSS 2.0 document.
+func (feed *Feed) RSS() ([]byte, error) {
+	doc := &rss{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         feed.Title,
+			Link:          feed.URL,
+			Description:   feed.Title,
+			LastBuildDate: feed.updated().Format(time.RFC1123Z),
+		},
+	}
+
+	for _, alert := range feed.Alerts {
+		info := info(alert)
+		capURL := feed.CAPURL(alert)
+
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:       title(info),
+			Link:        capURL,
+			GUID:        rssGUID{IsPermaLink: true, Value: capURL},
+			PubDate:     alert.Sent.Format(time.RFC1123Z),
+			Category:    info.Event,
+			Description: info.Description,
+		})
+	}
+
+	return marshal(doc)
+}
+
+func marshal(doc interface{}) ([]byte, error) {
+	b, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(b, '\n')...), nil
+}
@@ -0,0 +1,204 @@
+package syndication
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+func testTime(str string) *capxml.Time {
+	t, _ := time.Parse(time.RFC3339, str)
+	return &capxml.Time{Time: t}
+}
+
+func testFeed() *Feed {
+	tornado := &capxml.Alert{
+		Identifier:  "tornado",
+		Sender:      "w-nws.webmaster@noaa.gov",
+		Sent:        *testTime("2019-05-28T16:41:00-05:00"),
+		Status:      capxml.StatusActual,
+		MessageType: capxml.MessageTypeAlert,
+		Infos: []*capxml.Info{
+			{
+				Language:    "es-US",
+				Event:       "Aviso de Tornado",
+				Headline:    "Aviso de Tornado emitido",
+				Description: "Un tornado",
+			},
+			{
+				Language:    "en-US",
+				Event:       "Tornado Warning",
+				Headline:    "Tornado Warning issued May 28 at 4:41PM CDT",
+				Description: "A tornado was observed.",
+				SenderName:  "NWS Topeka KS",
+				Urgency:     capxml.UrgencyImmediate,
+				Severity:    capxml.SeverityExtreme,
+				Certainty:   capxml.CertaintyObserved,
+				Effective:   testTime("2019-05-28T16:41:00-05:00"),
+				Expires:     testTime("2019-05-28T17:15:00-05:00"),
+				Areas: []*capxml.Area{
+					{Description: "Riley, KS"},
+					{Description: "Pottawatomie, KS"},
+				},
+			},
+		},
+	}
+	statement := &capxml.Alert{
+		Identifier:  "statement",
+		Sender:      "w-nws.webmaster@noaa.gov",
+		Sent:        *testTime("2019-05-28T17:02:00-05:00"),
+		Status:      capxml.StatusActual,
+		MessageType: capxml.MessageTypeUpdate,
+		Infos: []*capxml.Info{
+			{Event: "Special Weather Statement"},
+		},
+	}
+
+	return &Feed{
+		Title: "Active alerts for KS",
+		URL:   "http://example.com/state/KS.atom",
+		CAPURL: func(alert *capxml.Alert) string {
+			return "http://example.com/cap/" + alert.Identifier + ".xml"
+		},
+		Alerts: []*capxml.Alert{tornado, statement},
+	}
+}
+
+func TestAtom(t *testing.T) {
+	b, err := testFeed().Atom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), xml.Header) {
+		t.Errorf("Atom() is missing the XML header")
+	}
+	for _, want := range []string{
+		`<feed xmlns="http://www.w3.org/2005/Atom" xmlns:cap="urn:oasis:names:tc:emergency:cap:1.2">`,
+		`<link rel="self" href="http://example.com/state/KS.atom"></link>`,
+		`<cap:event>Tornado Warning</cap:event>`,
+		`<cap:areaDesc>Riley, KS; Pottawatomie, KS</cap:areaDesc>`,
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("Atom() is missing %s:\n%s", want, b)
+		}
+	}
+
+	var doc struct {
+		ID      string `xml:"id"`
+		Title   string `xml:"title"`
+		Updated string `xml:"updated"`
+		Entries []struct {
+			ID        string   `xml:"id"`
+			Updated   string   `xml:"updated"`
+			Author    string   `xml:"author>name"`
+			Title     string   `xml:"title"`
+			Link      atomLink `xml:"link"`
+			Summary   string   `xml:"summary"`
+			Event     string   `xml:"urn:oasis:names:tc:emergency:cap:1.2 event"`
+			Expires   string   `xml:"urn:oasis:names:tc:emergency:cap:1.2 expires"`
+			MsgType   string   `xml:"urn:oasis:names:tc:emergency:cap:1.2 msgType"`
+			Severity  string   `xml:"urn:oasis:names:tc:emergency:cap:1.2 severity"`
+			Certainty string   `xml:"urn:oasis:names:tc:emergency:cap:1.2 certainty"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.ID != "http://example.com/state/KS.atom" || doc.Title != "Active alerts for KS" {
+		t.Errorf("Feed = %q %q", doc.ID, doc.Title)
+	}
+	if doc.Updated != "2019-05-28T22:02:00Z" {
+		t.Errorf("Feed updated %s, want when the last alert was sent", doc.Updated)
+	}
+	if len(doc.Entries) != 2 {
+		t.Fatalf("Feed has %d entries, want 2", len(doc.Entries))
+	}
+
+	// The English info describes the alert
+	entry := doc.Entries[0]
+	if entry.ID != "http://example.com/cap/tornado.xml" || entry.Link.Href != entry.ID || entry.Link.Type != "application/cap+xml" {
+		t.Errorf("Entry is identified by %q, linked to %+v", entry.ID, entry.Link)
+	}
+	if entry.Title != "Tornado Warning issued May 28 at 4:41PM CDT" || entry.Author != "NWS Topeka KS" || entry.Summary != "A tornado was observed." {
+		t.Errorf("Entry = %+v", entry)
+	}
+	if entry.Event != "Tornado Warning" || entry.Severity != "Extreme" || entry.Certainty != "Observed" || entry.MsgType != "Alert" {
+		t.Errorf("Entry CAP elements = %+v", entry)
+	}
+	if entry.Updated != "2019-05-28T16:41:00-05:00" || entry.Expires != "2019-05-28T17:15:00-05:00" {
+		t.Errorf("Entry updated %s, expires %s", entry.Updated, entry.Expires)
+	}
+
+	// Without a headline or sender name, the event and sender are used
+	entry = doc.Entries[1]
+	if entry.Title != "Special Weather Statement" || entry.Author != "w-nws.webmaster@noaa.gov" || entry.Expires != "" || entry.MsgType != "Update" {
+		t.Errorf("Entry = %+v", entry)
+	}
+}
+
+func TestRSS(t *testing.T) {
+	b, err := testFeed().RSS()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Version string `xml:"version,attr"`
+		Channel struct {
+			Title         string `xml:"title"`
+			Link          string `xml:"link"`
+			LastBuildDate string `xml:"lastBuildDate"`
+			Items         []struct {
+				Title       string  `xml:"title"`
+				Link        string  `xml:"link"`
+				GUID        rssGUID `xml:"guid"`
+				PubDate     string  `xml:"pubDate"`
+				Category    string  `xml:"category"`
+				Description string  `xml:"description"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.Version != "2.0" || doc.Channel.Title != "Active alerts for KS" || doc.Channel.Link != "http://example.com/state/KS.atom" {
+		t.Errorf("Channel = %+v", doc.Channel)
+	}
+	if doc.Channel.LastBuildDate != "Tue, 28 May 2019 22:02:00 +0000" {
+		t.Errorf("Last built %s, want when the last alert was sent", doc.Channel.LastBuildDate)
+	}
+	if len(doc.Channel.Items) != 2 {
+		t.Fatalf("Channel has %d items, want 2", len(doc.Channel.Items))
+	}
+
+	item := doc.Channel.Items[0]
+	if item.Title != "Tornado Warning issued May 28 at 4:41PM CDT" || item.Category != "Tornado Warning" || item.Description != "A tornado was observed." {
+		t.Errorf("Item = %+v", item)
+	}
+	if item.Link != "http://example.com/cap/tornado.xml" || !item.GUID.IsPermaLink || item.GUID.Value != item.Link {
+		t.Errorf("Item is linked to %q, identified by %+v", item.Link, item.GUID)
+	}
+	if item.PubDate != "Tue, 28 May 2019 16:41:00 -0500" {
+		t.Errorf("Item published %s", item.PubDate)
+	}
+}
+
+func TestEmptyFeed(t *testing.T) {
+	feed := testFeed()
+	feed.Alerts = nil
+
+	for name, render := range map[string]func() ([]byte, error){"Atom": feed.Atom, "RSS": feed.RSS} {
+		b, err := render()
+		if err != nil {
+			t.Fatalf("%s() error = %v", name, err)
+		}
+		if strings.Contains(string(b), "<entry>") || strings.Contains(string(b), "<item>") {
+			t.Errorf("%s() of an empty feed has entries:\n%s", name, b)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package vtec
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// A FloodSeverity represents the severity of a flood.
+type FloodSeverity string
+
+const (
+	// FloodSeverityNone represents no flooding.
+	FloodSeverityNone FloodSeverity = "N"
+
+	// FloodSeverityAreal represents an areal flood or flash flood,
+	// where no gauge is used.
+	FloodSeverityAreal FloodSeverity = "0"
+
+	// FloodSeverityMinor represents minor flooding.
+	FloodSeverityMinor FloodSeverity = "1"
+
+	// FloodSeverityModerate represents moderate flooding.
+	FloodSeverityModerate FloodSeverity = "2"
+
+	// FloodSeverityMajor represents major flooding.
+	FloodSeverityMajor FloodSeverity = "3"
+
+	// FloodSeverityUnknown represents flooding of unknown severity.
+	FloodSeverityUnknown FloodSeverity = "U"
+)
+
+// String returns the name of the flood severity.
+func (severity FloodSeverity) String() string {
+	switch severity {
+	case FloodSeverityNone:
+		return "None"
+	case FloodSeverityAreal:
+		return "Areal"
+	case FloodSeverityMinor:
+		return "Minor"
+	case FloodSeverityModerate:
+		return "Moderate"
+	case FloodSeverityMajor:
+		return "Major"
+	case FloodSeverityUnknown:
+		return "Unknown"
+	}
+	return ""
+}
+
+// An ImmediateCause represents the immediate cause of a flood.
+type ImmediateCause string
+
+var immediateCauses = map[ImmediateCause]string{
+	"ER": "Excessive Rainfall",
+	"SM": "Snowmelt",
+	"RS": "Rain and Snowmelt",
+	"DM": "Dam or Levee Failure",
+	"IJ": "Ice Jam",
+	"GO": "Glacier-Dammed Lake Outburst",
+	"IC": "Rain and/or Snowmelt and/or Ice Jam",
+	"FS": "Upstream Flooding plus Storm Surge",
+	"FT": "Upstream Flooding plus Tidal Effects",
+	"ET": "Elevated Upstream Flow plus Tidal Effects",
+	"WT": "Wind and/or Tidal Effects",
+	"DR": "Upstream Dam or Reservoir Release",
+	"MC": "Other Multiple Causes",
+	"OT": "Other Effects",
+	"UU": "Unknown",
+}
+
+// String returns the description of the immediate cause.
+func (cause ImmediateCause) String() string {
+	return immediateCauses[cause]
+}
+
+// A FloodRecord represents the flood record status.
+type FloodRecord string
+
+const (
+	// FloodRecordNone represents a flood without a near record or record crest.
+	FloodRecordNone FloodRecord = "NO"
+
+	// FloodRecordNear represents a flood with a near record or record crest.
+	FloodRecordNear FloodRecord = "NR"
+
+	// FloodRecordUnknown represents a flood where the record status is unknown.
+	FloodRecordUnknown FloodRecord = "UU"
+
+	// FloodRecordNotApplicable represents an areal flood, where a record is not applicable.
+	FloodRecordNotApplicable FloodRecord = "OO"
+)
+
+// An HVTEC represents a Hydrologic VTEC string.
+type HVTEC struct {
+	// NWS location identifier of the gauge,
+	// or 00000 if the flood is not at a gauge.
+	NWSLI          string
+	FloodSeverity  FloodSeverity
+	ImmediateCause ImmediateCause
+
+	// Begin, Crest and End are zero if the time is not defined.
+	Begin time.Time
+	Crest time.Time
+	End   time.Time
+
+	FloodRecord FloodRecord
+}
+
+// /nwsli.s.ic.yymmddThhnnZ.yymmddThhnnZ.yymmddThhnnZ.fr/
+var hvtecRegexp = regexp.MustCompile(`/([A-Z0-9]{5})\.([0123UN])\.([A-Z]{2})\.([0-9]{6}T[0-9]{4}Z)\.([0-9]{6}T[0-9]{4}Z)\.([0-9]{6}T[0-9]{4}Z)\.(NO|NR|UU|OO)/`)
+
+// ErrNoHVTEC is returned when the string does not contain an H-VTEC string.
+var ErrNoHVTEC = errors.New("No H-VTEC string found")
+
+// ParseHVTEC parses the first H-VTEC string found in str.
+func ParseHVTEC(str string) (*HVTEC, error) {
+	match := hvtecRegexp.FindStringSubmatch(str)
+	if match == nil {
+		return nil, ErrNoHVTEC
+	}
+	return newHVTEC(match)
+}
+
+// ParseAllHVTEC parses all of the H-VTEC strings found in str.
+func ParseAllHVTEC(str string) ([]*HVTEC, error) {
+	var vtecs []*HVTEC
+	for _, match := range hvtecRegexp.FindAllStringSubmatch(str, -1) {
+		vtec, err := newHVTEC(match)
+		if err != nil {
+			return nil, err
+		}
+		vtecs = append(vtecs, vtec)
+	}
+	return vtecs, nil
+}
+
+func newHVTEC(match []string) (*HVTEC, error) {
+	begin, err := parseTime(match[4])
+	if err != nil {
+		return nil, err
+	}
+
+	crest, err := parseTime(match[5])
+	if err != nil {
+		return nil, err
+	}
+
+	end, err := parseTime(match[6])
+	if err != nil {
+		return nil, err
+	}
+
+	return &HVTEC{
+		NWSLI:          match[1],
+		FloodSeverity:  FloodSeverity(match[2]),
+		ImmediateCause: ImmediateCause(match[3]),
+		Begin:          begin,
+		Crest:          crest,
+		End:            end,
+		FloodRecord:    FloodRecord(match[7]),
+	}, nil
+}
+
+// HasGauge returns whether the flood is at a river gauge.
+func (vtec *HVTEC) HasGauge() bool {
+	return vtec.NWSLI != "00000"
+}
+
+// String returns the H-VTEC string.
+func (vtec *HVTEC) String() string {
+	return fmt.Sprintf("/%s.%s.%s.%s.%s.%s.%s/",
+		vtec.NWSLI, string(vtec.FloodSeverity), string(vtec.ImmediateCause),
+		formatTime(vtec.Begin), formatTime(vtec.Crest), formatTime(vtec.End),
+		vtec.FloodRecord)
+}
@@ -0,0 +1,168 @@
+// Package vtec parses Valid Time Event Code (VTEC) strings issued by the
+// National Weather Service.
+//
+// https://www.weather.gov/vtec/
+package vtec
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	// TimeFormat is the format of times in VTEC strings.
+	TimeFormat = "060102T1504Z"
+
+	// Time used in VTEC strings when the time is not defined.
+	undefinedTime = "000000T0000Z"
+)
+
+// A ProductClass represents the class of a product.
+type ProductClass string
+
+const (
+	// ProductClassOperational represents an operational product.
+	ProductClassOperational ProductClass = "O"
+
+	// ProductClassTest represents a test product.
+	ProductClassTest ProductClass = "T"
+
+	// ProductClassExperimental represents an experimental product.
+	ProductClassExperimental ProductClass = "E"
+
+	// ProductClassExperimentalVTEC represents an operational product with experimental VTEC.
+	ProductClassExperimentalVTEC ProductClass = "X"
+)
+
+// An Action represents the action taken on an event.
+type Action string
+
+const (
+	// ActionNew represents a new event.
+	ActionNew Action = "NEW"
+
+	// ActionContinue represents an event that continues.
+	ActionContinue Action = "CON"
+
+	// ActionExtendTime represents an event whose time is extended.
+	ActionExtendTime Action = "EXT"
+
+	// ActionExtendArea represents an event whose area is extended.
+	ActionExtendArea Action = "EXA"
+
+	// ActionExtendAreaTime represents an event whose area and time are extended.
+	ActionExtendAreaTime Action = "EXB"
+
+	// ActionUpgrade represents an event that is upgraded.
+	ActionUpgrade Action = "UPG"
+
+	// ActionCancel represents an event that is cancelled.
+	ActionCancel Action = "CAN"
+
+	// ActionExpire represents an event that is allowed to expire.
+	ActionExpire Action = "EXP"
+
+	// ActionCorrection represents a correction to a previous product.
+	ActionCorrection Action = "COR"
+
+	// ActionRoutine represents a routine product.
+	ActionRoutine Action = "ROU"
+)
+
+// A PVTEC represents a Primary VTEC string.
+type PVTEC struct {
+	ProductClass        ProductClass
+	Action              Action
+	Office              string
+	Phenomena           string
+	Significance        string
+	EventTrackingNumber int
+
+	// Begin and End are zero if the time is not defined (the event
+	// is ongoing, or until further notice).
+	Begin time.Time
+	End   time.Time
+}
+
+// /k.aaa.cccc.pp.s.####.yymmddThhnnZ-yymmddThhnnZ/
+var pvtecRegexp = regexp.MustCompile(`/([OTEX])\.(NEW|CON|EXT|EXA|EXB|UPG|CAN|EXP|COR|ROU)\.([A-Z0-9]{4})\.([A-Z]{2})\.([A-Z])\.([0-9]{4})\.([0-9]{6}T[0-9]{4}Z)-([0-9]{6}T[0-9]{4}Z)/`)
+
+// ErrNoPVTEC is returned when the string does not contain a P-VTEC string.
+var ErrNoPVTEC = errors.New("No P-VTEC string found")
+
+// ParsePVTEC parses the first P-VTEC string found in str.
+func ParsePVTEC(str string) (*PVTEC, error) {
+	match := pvtecRegexp.FindStringSubmatch(str)
+	if match == nil {
+		return nil, ErrNoPVTEC
+	}
+	return newPVTEC(match)
+}
+
+// ParseAllPVTEC parses all of the P-VTEC strings found in str.
+func ParseAllPVTEC(str string) ([]*PVTEC, error) {
+	var vtecs []*PVTEC
+	for _, match := range pvtecRegexp.FindAllStringSubmatch(str, -1) {
+		vtec, err := newPVTEC(match)
+		if err != nil {
+			return nil, err
+		}
+		vtecs = append(vtecs, vtec)
+	}
+	return vtecs, nil
+}
+
+func newPVTEC(match []string) (*PVTEC, error) {
+	etn, err := strconv.Atoi(match[6])
+	if err != nil {
+		return nil, err
+	}
+
+	begin, err := parseTime(match[7])
+	if err != nil {
+		return nil, err
+	}
+
+	end, err := parseTime(match[8])
+	if err != nil {
+		return nil, err
+	}
+
+	return &PVTEC{
+		ProductClass:        ProductClass(match[1]),
+		Action:              Action(match[2]),
+		Office:              match[3],
+		Phenomena:           match[4],
+		Significance:        match[5],
+		EventTrackingNumber: etn,
+		Begin:               begin,
+		End:                 end,
+	}, nil
+}
+
+// parseTime parses a VTEC time, returning the zero time if undefined.
+func parseTime(str string) (time.Time, error) {
+	if str == undefinedTime {
+		return time.Time{}, nil
+	}
+	return time.Parse(TimeFormat, str)
+}
+
+// formatTime formats a VTEC time, using the undefined time if zero.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return undefinedTime
+	}
+	return t.UTC().Format(TimeFormat)
+}
+
+// String returns the P-VTEC string.
+func (vtec *PVTEC) String() string {
+	return fmt.Sprintf("/%s.%s.%s.%s.%s.%04d.%s-%s/",
+		vtec.ProductClass, vtec.Action, vtec.Office, vtec.Phenomena,
+		vtec.Significance, vtec.EventTrackingNumber,
+		formatTime(vtec.Begin), formatTime(vtec.End))
+}
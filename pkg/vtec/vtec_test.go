@@ -0,0 +1,235 @@
+package vtec
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day, hour, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+}
+
+func TestParsePVTEC(t *testing.T) {
+	tests := []struct {
+		name string
+		str  string
+		want *PVTEC
+		err  error
+	}{
+		{
+			name: "tornado warning",
+			str:  "/O.NEW.KTOP.TO.W.0012.190528T2141Z-190528T2215Z/",
+			want: &PVTEC{
+				ProductClass:        ProductClassOperational,
+				Action:              ActionNew,
+				Office:              "KTOP",
+				Phenomena:           "TO",
+				Significance:        "W",
+				EventTrackingNumber: 12,
+				Begin:               date(2019, time.May, 28, 21, 41),
+				End:                 date(2019, time.May, 28, 22, 15),
+			},
+		},
+		{
+			name: "ongoing event",
+			str:  "/O.CON.KDMX.WS.W.0004.000000T0000Z-190119T1200Z/",
+			want: &PVTEC{
+				ProductClass:        ProductClassOperational,
+				Action:              ActionContinue,
+				Office:              "KDMX",
+				Phenomena:           "WS",
+				Significance:        "W",
+				EventTrackingNumber: 4,
+				End:                 date(2019, time.January, 19, 12, 0),
+			},
+		},
+		{
+			name: "until further notice",
+			str:  "/O.EXT.KLZK.FL.W.0057.190530T0300Z-000000T0000Z/",
+			want: &PVTEC{
+				ProductClass:        ProductClassOperational,
+				Action:              ActionExtendTime,
+				Office:              "KLZK",
+				Phenomena:           "FL",
+				Significance:        "W",
+				EventTrackingNumber: 57,
+				Begin:               date(2019, time.May, 30, 3, 0),
+			},
+		},
+		{
+			name: "test product",
+			str:  "/T.NEW.KOAX.TO.W.0999.190601T1200Z-190601T1300Z/",
+			want: &PVTEC{
+				ProductClass:        ProductClassTest,
+				Action:              ActionNew,
+				Office:              "KOAX",
+				Phenomena:           "TO",
+				Significance:        "W",
+				EventTrackingNumber: 999,
+				Begin:               date(2019, time.June, 1, 12, 0),
+				End:                 date(2019, time.June, 1, 13, 0),
+			},
+		},
+		{
+			name: "invalid",
+			str:  "/O.NEW.KTOP.TO.W.12.190528T2141Z-190528T2215Z/",
+			err:  ErrNoPVTEC,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParsePVTEC(test.str)
+			if err != test.err {
+				t.Fatalf("ParsePVTEC(%q) error = %v, want %v", test.str, err, test.err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParsePVTEC(%q) = %+v, want %+v", test.str, got, test.want)
+			}
+			if got != nil && got.String() != test.str {
+				t.Errorf("String() = %q, want %q", got.String(), test.str)
+			}
+		})
+	}
+}
+
+func TestParseAllPVTEC(t *testing.T) {
+	tests := []struct {
+		name string
+		str  string
+		want []string
+	}{
+		{
+			name: "upgrade",
+			str:  "/O.UPG.KDMX.WS.A.0002.190119T0000Z-190120T0000Z/\n/O.NEW.KDMX.WS.W.0004.190119T0000Z-190120T0000Z/",
+			want: []string{
+				"/O.UPG.KDMX.WS.A.0002.190119T0000Z-190120T0000Z/",
+				"/O.NEW.KDMX.WS.W.0004.190119T0000Z-190120T0000Z/",
+			},
+		},
+		{
+			name: "multiple segments",
+			str:  "/O.EXP.KBOU.WW.Y.0010.000000T0000Z-190301T0000Z/ /O.CON.KBOU.WS.W.0005.000000T0000Z-190301T1200Z/ /O.EXA.KBOU.WS.W.0005.000000T0000Z-190301T1200Z/",
+			want: []string{
+				"/O.EXP.KBOU.WW.Y.0010.000000T0000Z-190301T0000Z/",
+				"/O.CON.KBOU.WS.W.0005.000000T0000Z-190301T1200Z/",
+				"/O.EXA.KBOU.WS.W.0005.000000T0000Z-190301T1200Z/",
+			},
+		},
+		{
+			name: "with H-VTEC",
+			str:  "/O.NEW.KLZK.FL.W.0057.190530T0300Z-000000T0000Z/\n/CLKA4.2.ER.190530T0300Z.190602T0000Z.000000T0000Z.NR/",
+			want: []string{
+				"/O.NEW.KLZK.FL.W.0057.190530T0300Z-000000T0000Z/",
+			},
+		},
+		{
+			name: "none",
+			str:  "/CLKA4.2.ER.190530T0300Z.190602T0000Z.000000T0000Z.NR/",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vtecs, err := ParseAllPVTEC(test.str)
+			if err != nil {
+				t.Fatalf("ParseAllPVTEC(%q) error = %v", test.str, err)
+			}
+
+			var got []string
+			for _, vtec := range vtecs {
+				got = append(got, vtec.String())
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseAllPVTEC(%q) = %q, want %q", test.str, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseHVTEC(t *testing.T) {
+	tests := []struct {
+		name string
+		str  string
+		want *HVTEC
+		err  error
+	}{
+		{
+			name: "river flood",
+			str:  "/CLKA4.2.ER.190530T0300Z.190602T0000Z.000000T0000Z.NR/",
+			want: &HVTEC{
+				NWSLI:          "CLKA4",
+				FloodSeverity:  FloodSeverityModerate,
+				ImmediateCause: "ER",
+				Begin:          date(2019, time.May, 30, 3, 0),
+				Crest:          date(2019, time.June, 2, 0, 0),
+				FloodRecord:    FloodRecordNear,
+			},
+		},
+		{
+			name: "areal flood",
+			str:  "/00000.0.ER.000000T0000Z.000000T0000Z.000000T0000Z.OO/",
+			want: &HVTEC{
+				NWSLI:          "00000",
+				FloodSeverity:  FloodSeverityAreal,
+				ImmediateCause: "ER",
+				FloodRecord:    FloodRecordNotApplicable,
+			},
+		},
+		{
+			name: "crest passed",
+			str:  "/NEHN1.1.ER.190318T1530Z.190320T0600Z.190323T1800Z.NO/",
+			want: &HVTEC{
+				NWSLI:          "NEHN1",
+				FloodSeverity:  FloodSeverityMinor,
+				ImmediateCause: "ER",
+				Begin:          date(2019, time.March, 18, 15, 30),
+				Crest:          date(2019, time.March, 20, 6, 0),
+				End:            date(2019, time.March, 23, 18, 0),
+				FloodRecord:    FloodRecordNone,
+			},
+		},
+		{
+			name: "P-VTEC only",
+			str:  "/O.NEW.KLZK.FL.W.0057.190530T0300Z-000000T0000Z/",
+			err:  ErrNoHVTEC,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseHVTEC(test.str)
+			if err != test.err {
+				t.Fatalf("ParseHVTEC(%q) error = %v, want %v", test.str, err, test.err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseHVTEC(%q) = %+v, want %+v", test.str, got, test.want)
+			}
+			if got != nil && got.String() != test.str {
+				t.Errorf("String() = %q, want %q", got.String(), test.str)
+			}
+		})
+	}
+}
+
+func TestParseAllHVTEC(t *testing.T) {
+	str := "/O.NEW.KLZK.FL.W.0057.190530T0300Z-000000T0000Z/\n/CLKA4.2.ER.190530T0300Z.190602T0000Z.000000T0000Z.NR/\n/O.CON.KLZK.FL.W.0051.000000T0000Z-000000T0000Z/\n/DSCA4.1.ER.000000T0000Z.190531T1200Z.000000T0000Z.NO/"
+
+	vtecs, err := ParseAllHVTEC(str)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"CLKA4", "DSCA4"}
+	var got []string
+	for _, vtec := range vtecs {
+		got = append(got, vtec.NWSLI)
+		if !vtec.HasGauge() {
+			t.Errorf("%s has no gauge", vtec.NWSLI)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseAllHVTEC() = %q, want %q", got, want)
+	}
+}
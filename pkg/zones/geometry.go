@@ -0,0 +1,128 @@
+package zones
+
+import (
+	"math"
+	"sort"
+
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+// Number of samples along each axis when estimating coverage.
+const coverageSamples = 40
+
+// A Box is the bounding box of a polygon.
+type Box struct {
+	MinX, MinY float64
+	MaxX, MaxY float64
+}
+
+// Intersects returns whether the two boxes overlap.
+func (box Box) Intersects(other Box) bool {
+	return box.MinX <= other.MaxX && other.MinX <= box.MaxX &&
+		box.MinY <= other.MaxY && other.MinY <= box.MaxY
+}
+
+// Bounds returns the bounding box of the polygon.
+func Bounds(polygon *capxml.Polygon) Box {
+	box := Box{
+		MinX: math.Inf(1),
+		MinY: math.Inf(1),
+		MaxX: math.Inf(-1),
+		MaxY: math.Inf(-1),
+	}
+
+	for _, ring := range polygon.Coordinates {
+		for _, coord := range ring {
+			box.MinX = math.Min(box.MinX, coord[0])
+			box.MinY = math.Min(box.MinY, coord[1])
+			box.MaxX = math.Max(box.MaxX, coord[0])
+			box.MaxY = math.Max(box.MaxY, coord[1])
+		}
+	}
+
+	return box
+}
+
+// Contains returns whether the point (x = lon, y = lat) is inside the polygon.
+func Contains(polygon *capxml.Polygon, x, y float64) bool {
+	inside := false
+
+	for _, ring := range polygon.Coordinates {
+		for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+			xi, yi := ring[i][0], ring[i][1]
+			xj, yj := ring[j][0], ring[j][1]
+
+			if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+				inside = !inside
+			}
+		}
+	}
+
+	return inside
+}
+
+// Coverage estimates the fraction (0-1) of the zone covered by the polygon.
+// The estimate is made by sampling a grid of points over the zone.
+func Coverage(zone *capxml.Polygon, zoneBounds Box, polygon *capxml.Polygon, polygonBounds Box) float64 {
+	if !zoneBounds.Intersects(polygonBounds) {
+		return 0
+	}
+
+	dx := (zoneBounds.MaxX - zoneBounds.MinX) / coverageSamples
+	dy := (zoneBounds.MaxY - zoneBounds.MinY) / coverageSamples
+
+	var inZone, covered int
+	for i := 0; i < coverageSamples; i++ {
+		x := zoneBounds.MinX + (float64(i)+0.5)*dx
+		for j := 0; j < coverageSamples; j++ {
+			y := zoneBounds.MinY + (float64(j)+0.5)*dy
+
+			if !Contains(zone, x, y) {
+				continue
+			}
+			inZone++
+
+			if Contains(polygon, x, y) {
+				covered++
+			}
+		}
+	}
+
+	if inZone == 0 {
+		return 0
+	}
+	return float64(covered) / float64(inZone)
+}
+
+// A ZoneCoverage is the fraction of a zone covered by a polygon.
+type ZoneCoverage struct {
+	UGC      string
+	Coverage float64
+}
+
+// Intersecting returns the zones (UGC codes) where more than the threshold
+// fraction of the zone is covered by the polygon, sorted by UGC code.
+func (set *Set) Intersecting(polygon *capxml.Polygon, threshold float64) []ZoneCoverage {
+	polygonBounds := Bounds(polygon)
+
+	var coverages []ZoneCoverage
+	for ugc, zone := range set.Polygons {
+		zoneBounds, ok := set.bounds[zone]
+		if !ok {
+			zoneBounds = Bounds(zone)
+		}
+
+		coverage := Coverage(zone, zoneBounds, polygon, polygonBounds)
+		if coverage > 0 && coverage > threshold {
+			coverages = append(coverages, ZoneCoverage{
+				UGC:      ugc,
+				Coverage: coverage,
+			})
+		}
+	}
+
+	sort.Slice(coverages, func(i, j int) bool {
+		return coverages[i].UGC < coverages[j].UGC
+	})
+	return coverages
+}
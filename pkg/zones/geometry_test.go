@@ -0,0 +1,106 @@
+package zones
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+)
+
+// rectangle returns a polygon over the longitudes and latitudes.
+func rectangle(minLon, minLat, maxLon, maxLat float64) *capxml.Polygon {
+	return &capxml.Polygon{
+		Coordinates: [][][]float64{{
+			{minLon, minLat},
+			{maxLon, minLat},
+			{maxLon, maxLat},
+			{minLon, maxLat},
+			{minLon, minLat},
+		}},
+	}
+}
+
+func TestBounds(t *testing.T) {
+	got := Bounds(rectangle(-97, 39, -96, 40))
+	if want := (Box{MinX: -97, MinY: 39, MaxX: -96, MaxY: 40}); got != want {
+		t.Errorf("Bounds() = %+v, want %+v", got, want)
+	}
+
+	if !got.Intersects(Box{MinX: -96, MinY: 38, MaxX: -95, MaxY: 39}) {
+		t.Error("Boxes sharing a corner don't intersect")
+	}
+	if got.Intersects(Box{MinX: -95.9, MinY: 39, MaxX: -95, MaxY: 40}) {
+		t.Error("Separate boxes intersect")
+	}
+}
+
+func TestContains(t *testing.T) {
+	// A ring with a hole
+	polygon := rectangle(-97, 39, -96, 40)
+	polygon.Coordinates = append(polygon.Coordinates, rectangle(-96.75, 39.25, -96.25, 39.75).Coordinates[0])
+
+	tests := []struct {
+		x, y float64
+		want bool
+	}{
+		{-96.9, 39.1, true},
+		{-96.5, 39.5, false},
+		{-95.5, 39.5, false},
+		{-96.5, 40.5, false},
+	}
+
+	for _, test := range tests {
+		if got := Contains(polygon, test.x, test.y); got != test.want {
+			t.Errorf("Contains(%v, %v) = %v, want %v", test.x, test.y, got, test.want)
+		}
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	zone := rectangle(-97, 39, -96, 40)
+
+	tests := []struct {
+		name    string
+		polygon *capxml.Polygon
+		want    float64
+	}{
+		{"all", rectangle(-98, 38, -95, 41), 1},
+		{"half", rectangle(-96.5, 38, -95, 41), 0.5},
+		{"quarter", rectangle(-96.5, 39.5, -95, 41), 0.25},
+		{"none", rectangle(-95, 39, -94, 40), 0},
+	}
+
+	for _, test := range tests {
+		got := Coverage(zone, Bounds(zone), test.polygon, Bounds(test.polygon))
+		if math.Abs(got-test.want) > 0.01 {
+			t.Errorf("Coverage(%s) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestIntersecting(t *testing.T) {
+	set := &Set{
+		Polygons: map[string]*capxml.Polygon{
+			"KSZ041": rectangle(-96, 39, -95, 40),
+			"KSZ040": rectangle(-97, 39, -96, 40),
+			"KSZ050": rectangle(-97, 38, -96, 39),
+		},
+	}
+
+	// Three quarters of KSZ040, a quarter of KSZ041 and none of KSZ050
+	polygon := rectangle(-96.75, 39, -95.75, 40)
+
+	var ugcs []string
+	for _, zone := range set.Intersecting(polygon, 0.1) {
+		ugcs = append(ugcs, zone.UGC)
+	}
+	if want := []string{"KSZ040", "KSZ041"}; !reflect.DeepEqual(ugcs, want) {
+		t.Errorf("Intersecting() = %q, want %q", ugcs, want)
+	}
+
+	got := set.Intersecting(polygon, 0.5)
+	if len(got) != 1 || got[0].UGC != "KSZ040" || math.Abs(got[0].Coverage-0.75) > 0.01 {
+		t.Errorf("Intersecting() over half = %+v, want KSZ040 at 0.75", got)
+	}
+}
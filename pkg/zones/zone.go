@@ -0,0 +1,126 @@
+package zones
+
+import (
+	"strconv"
+)
+
+// NWS time zone codes, mapped to IANA time zones.
+// https://www.weather.gov/gis/Counties
+var timeZones = map[byte]string{
+	'V': "America/Puerto_Rico",
+	'E': "America/New_York",
+	'C': "America/Chicago",
+	'M': "America/Denver",
+	'm': "America/Phoenix",
+	'P': "America/Los_Angeles",
+	'A': "America/Anchorage",
+	'H': "Pacific/Honolulu",
+	'h': "America/Adak",
+	'G': "Pacific/Guam",
+	'S': "Pacific/Pago_Pago",
+}
+
+// Marine area codes, used in place of the state in the UGC
+// codes of marine zones (ex. AMZ250).
+// https://www.weather.gov/gis/MarineZones
+var marineAreas = map[string]bool{
+	"AM": true, // Western Atlantic
+	"AN": true, // Western Atlantic (north)
+	"GM": true, // Gulf of Mexico
+	"LC": true, // Lake St. Clair
+	"LE": true, // Lake Erie
+	"LH": true, // Lake Huron
+	"LM": true, // Lake Michigan
+	"LO": true, // Lake Ontario
+	"LS": true, // Lake Superior
+	"PH": true, // Hawaiian waters
+	"PK": true, // Alaskan waters
+	"PM": true, // Marianas waters
+	"PS": true, // American Samoa waters
+	"PZ": true, // Eastern Pacific
+	"SL": true, // St. Lawrence River
+}
+
+// IsMarine returns whether the UGC code is of a marine zone.
+func IsMarine(ugc string) bool {
+	return len(ugc) > 2 && ugc[2] == 'Z' && marineAreas[ugc[:2]]
+}
+
+// State returns the state abbreviation of the UGC code. Marine
+// zones are not in a state, so an empty string is returned.
+func State(ugc string) string {
+	if len(ugc) < 2 || IsMarine(ugc) {
+		return ""
+	}
+	return ugc[:2]
+}
+
+// A Zone represents the metadata of a county or public zone.
+type Zone struct {
+	// UGC code.
+	UGC string
+
+	// State abbreviation.
+	State string
+
+	// Zone or county name.
+	Name string
+
+	// County warning area (the issuing WFO).
+	Office string
+
+	// NWS time zone code. Zones spanning multiple
+	// time zones have more than one code (ex. CE).
+	TimeZone string
+
+	// Fire/emergency area.
+	FEArea string
+
+	// Centroid.
+	Lat float64
+	Lon float64
+}
+
+// newZone creates a zone from the shapefile attributes.
+func newZone(ugc, state string, attribute func(name string) string) *Zone {
+	zone := &Zone{
+		UGC:      ugc,
+		State:    state,
+		Name:     attribute("NAME"),
+		Office:   attribute("CWA"),
+		TimeZone: attribute("TIME_ZONE"),
+		FEArea:   attribute("FE_AREA"),
+	}
+
+	// Counties use COUNTYNAME
+	if zone.Name == "" {
+		zone.Name = attribute("COUNTYNAME")
+	}
+
+	zone.Lat, _ = strconv.ParseFloat(attribute("LAT"), 64)
+	zone.Lon, _ = strconv.ParseFloat(attribute("LON"), 64)
+
+	return zone
+}
+
+// Location returns the IANA time zone of the zone. For zones spanning
+// multiple time zones, the first is used. If the time zone is unknown,
+// an empty string is returned.
+func (zone *Zone) Location() string {
+	if zone.TimeZone == "" {
+		return ""
+	}
+	return timeZones[zone.TimeZone[0]]
+}
+
+// Locations returns the IANA time zones of the zone, one for each
+// of the time zones it spans. Unknown time zones are left out.
+func (zone *Zone) Locations() []string {
+	var names []string
+	for i := 0; i < len(zone.TimeZone); i++ {
+		if name, ok := timeZones[zone.TimeZone[i]]; ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,58 @@
+package zones
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestState(t *testing.T) {
+	tests := []struct {
+		ugc    string
+		state  string
+		marine bool
+	}{
+		{"KSZ040", "KS", false},
+		{"KSC161", "KS", false},
+		{"AMZ630", "", true},
+		{"GMZ656", "", true},
+		{"LMZ740", "", true},
+		{"PZZ130", "", true},
+		// Counties of states sharing a marine area's letters
+		{"AMC001", "AM", false},
+		{"K", "", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+		if got := State(test.ugc); got != test.state {
+			t.Errorf("State(%q) = %q, want %q", test.ugc, got, test.state)
+		}
+		if got := IsMarine(test.ugc); got != test.marine {
+			t.Errorf("IsMarine(%q) = %v, want %v", test.ugc, got, test.marine)
+		}
+	}
+}
+
+func TestLocations(t *testing.T) {
+	tests := []struct {
+		timeZone  string
+		location  string
+		locations []string
+	}{
+		{"C", "America/Chicago", []string{"America/Chicago"}},
+		{"CE", "America/Chicago", []string{"America/Chicago", "America/New_York"}},
+		{"m", "America/Phoenix", []string{"America/Phoenix"}},
+		{"XM", "", []string{"America/Denver"}},
+		{"", "", nil},
+	}
+
+	for _, test := range tests {
+		zone := &Zone{TimeZone: test.timeZone}
+		if got := zone.Location(); got != test.location {
+			t.Errorf("Location() of %q = %q, want %q", test.timeZone, got, test.location)
+		}
+		if got := zone.Locations(); !reflect.DeepEqual(got, test.locations) {
+			t.Errorf("Locations() of %q = %q, want %q", test.timeZone, got, test.locations)
+		}
+	}
+}
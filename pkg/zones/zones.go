@@ -0,0 +1,316 @@
+package zones
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	capxml "github.com/alerting/alerts/pkg/cap/xml"
+	"github.com/fsnotify/fsnotify"
+	shp "github.com/jonas-p/go-shp"
+)
+
+const (
+	// FormatCounty is the UGC format for counties.
+	FormatCounty = "C"
+
+	// FormatPublicZone is the UGC format for public zones.
+	FormatPublicZone = "Z"
+)
+
+// How long to wait for writes to a shapefile to settle before reloading.
+const reloadDelay = 2 * time.Second
+
+// A Set is an immutable set of zone geometries, loaded from shapefiles.
+type Set struct {
+	// Version of the shapefiles the set was loaded from.
+	Version string
+
+	// Polygons keyed by UGC code.
+	Polygons map[string]*capxml.Polygon
+
+	// Polygons keyed by SAME (FIPS6) code.
+	SAMEPolygons map[string]*capxml.Polygon
+
+	// Zone metadata keyed by UGC code.
+	Zones map[string]*Zone
+
+	bounds map[*capxml.Polygon]Box
+}
+
+// A Store holds the active zone geometries. The geometries can be reloaded
+// from disk, replacing the active set atomically.
+type Store struct {
+	// County (UGC-C) shapefile.
+	CountyFile string
+
+	// Public zone (UGC-Z) shapefile.
+	ZoneFile string
+
+	current atomic.Value
+}
+
+// NewStore creates a store and loads the shapefiles into it.
+func NewStore(countyFile, zoneFile string) (*Store, error) {
+	store := &Store{
+		CountyFile: countyFile,
+		ZoneFile:   zoneFile,
+	}
+
+	if err := store.Reload(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Load returns the active set of geometries. The returned set is never
+// modified, so callers should use it for the duration of their work to
+// keep a consistent view.
+func (store *Store) Load() *Set {
+	set, _ := store.current.Load().(*Set)
+	if set == nil {
+		return &Set{}
+	}
+	return set
+}
+
+// Reload loads the shapefiles and swaps them in as the active set.
+// If loading fails, the active set is left unchanged.
+func (store *Store) Reload() error {
+	set := &Set{
+		Polygons:     make(map[string]*capxml.Polygon),
+		SAMEPolygons: make(map[string]*capxml.Polygon),
+		Zones:        make(map[string]*Zone),
+	}
+
+	var versions []string
+
+	if store.CountyFile != "" {
+		log.Println("Loading UGC-C polygons...")
+		version, err := fileVersion(store.CountyFile)
+		if err != nil {
+			return err
+		}
+
+		counties, err := loadShapefile(store.CountyFile, FormatCounty)
+		if err != nil {
+			return err
+		}
+
+		// Merge into 1
+		for k, polygon := range counties.polygons {
+			set.Polygons[k] = polygon
+		}
+		for k, zone := range counties.zones {
+			set.Zones[k] = zone
+		}
+		set.SAMEPolygons = counties.samePolygons
+		versions = append(versions, version)
+	}
+
+	if store.ZoneFile != "" {
+		log.Println("Loading UGC-Z polygons...")
+		version, err := fileVersion(store.ZoneFile)
+		if err != nil {
+			return err
+		}
+
+		publicZones, err := loadShapefile(store.ZoneFile, FormatPublicZone)
+		if err != nil {
+			return err
+		}
+
+		// Merge into 1
+		for k, polygon := range publicZones.polygons {
+			set.Polygons[k] = polygon
+		}
+		for k, zone := range publicZones.zones {
+			set.Zones[k] = zone
+		}
+		versions = append(versions, version)
+	}
+
+	// Pre-compute the bounds, for intersecting
+	set.bounds = make(map[*capxml.Polygon]Box, len(set.Polygons))
+	for _, polygon := range set.Polygons {
+		set.bounds[polygon] = Bounds(polygon)
+	}
+
+	set.Version = strings.Join(versions, ",")
+	store.current.Store(set)
+
+	log.Printf("Done loading polygons, active version: %s", set.Version)
+	return nil
+}
+
+// Watch reloads the shapefiles when they change on disk, or when SIGHUP
+// is received. It runs until the context is cancelled.
+func (store *Store) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// Watch the directories, since files are often replaced
+	// by a rename rather than written in place.
+	files := make(map[string]bool)
+	for _, filename := range []string{store.CountyFile, store.ZoneFile} {
+		if filename == "" {
+			continue
+		}
+		files[filepath.Clean(filename)] = true
+		if err := watcher.Add(filepath.Dir(filename)); err != nil {
+			return err
+		}
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var reload <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-watcher.Errors:
+			log.Println("Error watching shapefiles:", err)
+		case event := <-watcher.Events:
+			if !files[filepath.Clean(event.Name)] || event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Rename) == 0 {
+				continue
+			}
+			log.Printf("Shapefile changed: %s", event)
+			reload = time.After(reloadDelay)
+		case <-hup:
+			log.Println("SIGHUP received, reloading shapefiles")
+			reload = time.After(0)
+		case <-reload:
+			reload = nil
+			if err := store.Reload(); err != nil {
+				log.Println("Unable to reload shapefiles:", err)
+			}
+		}
+	}
+}
+
+// fileVersion returns a version string for the file, made up of
+// its name and checksum.
+func fileVersion(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha1.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s@%s", filepath.Base(filename), hex.EncodeToString(hash.Sum(nil))[:8]), nil
+}
+
+// A shapefile holds the contents of a zone or county shapefile.
+type shapefile struct {
+	// Polygons keyed by UGC code.
+	polygons map[string]*capxml.Polygon
+
+	// Polygons keyed by SAME (FIPS6) code.
+	samePolygons map[string]*capxml.Polygon
+
+	// Metadata keyed by UGC code.
+	zones map[string]*Zone
+}
+
+// attribute returns the value of the named attribute for the current
+// shape, or an empty string if the attribute does not exist.
+func attribute(reader *shp.ZipReader, fields map[string]int, name string) string {
+	if i, ok := fields[name]; ok {
+		return reader.Attribute(i)
+	}
+	return ""
+}
+
+// loadShapefile loads the polygons and metadata from the shapefile, keyed
+// by UGC code. If the shapefile has a FIPS attribute, the polygons are also
+// keyed by SAME (FIPS6) code.
+func loadShapefile(filename, format string) (*shapefile, error) {
+	// Load shapefiles
+	reader, err := shp.OpenZip(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	fields := make(map[string]int)
+	for i, field := range reader.Fields() {
+		fields[field.String()] = i
+	}
+
+	_, hasZone := fields["ZONE"]
+	_, hasFIPS := fields["FIPS"]
+	if _, ok := fields["STATE"]; !ok || (!hasZone && !hasFIPS) {
+		return nil, fmt.Errorf("%s: missing STATE and ZONE/FIPS attributes", filename)
+	}
+
+	result := &shapefile{
+		polygons:     make(map[string]*capxml.Polygon),
+		samePolygons: make(map[string]*capxml.Polygon),
+		zones:        make(map[string]*Zone),
+	}
+	for reader.Next() {
+		_, shape := reader.Shape()
+		pshape := shape.(*shp.Polygon)
+
+		polygon := &capxml.Polygon{
+			Type:        "Polygon",
+			Coordinates: make([][][]float64, 1),
+		}
+		polygon.Coordinates[0] = make([][]float64, pshape.NumPoints)
+
+		for i, coord := range pshape.Points {
+			polygon.Coordinates[0][pshape.NumPoints-int32(i)-1] = []float64{coord.X, coord.Y}
+		}
+
+		// STATE, TYPE, ZONE
+		// https://www.weather.gov/media/alert/CAP_v12_guide_05-16-2017.pdf
+		// https://www.nws.noaa.gov/emwin/winugc.htm
+		state := attribute(reader, fields, "STATE")
+		fips := attribute(reader, fields, "FIPS")
+
+		var ugc string
+		if hasZone {
+			ugc = state + format + attribute(reader, fields, "ZONE")
+		} else if len(fips) == 5 {
+			// County UGCs use the county portion of the FIPS code.
+			ugc = state + format + fips[2:]
+		}
+
+		if ugc != "" {
+			result.polygons[ugc] = polygon
+			result.zones[ugc] = newZone(ugc, state, func(name string) string {
+				return attribute(reader, fields, name)
+			})
+		}
+
+		// SAME codes are the FIPS code, prefixed by the
+		// subdivision (0 for the entire county).
+		if len(fips) == 5 {
+			result.samePolygons["0"+fips] = polygon
+		}
+	}
+
+	return result, nil
+}